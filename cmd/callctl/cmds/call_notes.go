@@ -0,0 +1,160 @@
+package cmds
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+)
+
+func GetCallNotesCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "notes [call-id]",
+		Short: "List the notes of a call",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var result any
+			if err := doJSON(root, http.MethodGet, "/api/calllog/v1/notes", url.Values{"callId": args}, nil, &result); err != nil {
+				logrus.Fatal(err)
+			}
+
+			printJSON(result)
+		},
+	}
+
+	cmd.AddCommand(
+		GetAddCallNoteCommand(root),
+		GetEditCallNoteCommand(root),
+		GetDeleteCallNoteCommand(root),
+	)
+
+	return cmd
+}
+
+func GetAddCallNoteCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "add [call-id] [text...]",
+		Short: "Add a note to a call",
+		Args:  cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			req := map[string]any{
+				"text": strings.Join(args[1:], " "),
+			}
+
+			var result any
+			if err := doJSON(root, http.MethodPost, "/api/calllog/v1/notes", url.Values{"callId": args[:1]}, req, &result); err != nil {
+				logrus.Fatal(err)
+			}
+
+			printJSON(result)
+		},
+	}
+
+	return cmd
+}
+
+func GetEditCallNoteCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "edit [call-id] [note-id] [text...]",
+		Short: "Replace the text of a note",
+		Args:  cobra.MinimumNArgs(3),
+		Run: func(cmd *cobra.Command, args []string) {
+			query := url.Values{
+				"callId": args[:1],
+				"id":     args[1:2],
+			}
+
+			req := map[string]any{
+				"text": strings.Join(args[2:], " "),
+			}
+
+			var result any
+			if err := doJSON(root, http.MethodPut, "/api/calllog/v1/note", query, req, &result); err != nil {
+				logrus.Fatal(err)
+			}
+
+			printJSON(result)
+		},
+	}
+
+	return cmd
+}
+
+func GetDeleteCallNoteCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete [call-id] [note-id]",
+		Short: "Delete a note",
+		Args:  cobra.ExactArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			query := url.Values{
+				"callId": args[:1],
+				"id":     args[1:2],
+			}
+
+			if err := doJSON(root, http.MethodDelete, "/api/calllog/v1/note", query, nil, nil); err != nil {
+				logrus.Fatal(err)
+			}
+		},
+	}
+
+	return cmd
+}
+
+func GetCallTagsCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "tags [call-id]",
+		Short: "List the tags of a call",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var result any
+			if err := doJSON(root, http.MethodGet, "/api/calllog/v1/tags", url.Values{"callId": args}, nil, &result); err != nil {
+				logrus.Fatal(err)
+			}
+
+			printJSON(result)
+		},
+	}
+
+	cmd.AddCommand(
+		&cobra.Command{
+			Use:   "add [call-id] [tags...]",
+			Short: "Add tags to a call",
+			Args:  cobra.MinimumNArgs(2),
+			Run: func(cmd *cobra.Command, args []string) {
+				req := map[string]any{
+					"tags": args[1:],
+				}
+
+				var result any
+				if err := doJSON(root, http.MethodPost, "/api/calllog/v1/tags", url.Values{"callId": args[:1]}, req, &result); err != nil {
+					logrus.Fatal(err)
+				}
+
+				printJSON(result)
+			},
+		},
+		&cobra.Command{
+			Use:   "remove [call-id] [tags...]",
+			Short: "Remove tags from a call",
+			Args:  cobra.MinimumNArgs(2),
+			Run: func(cmd *cobra.Command, args []string) {
+				query := url.Values{
+					"callId": args[:1],
+					"tag":    args[1:],
+				}
+
+				var result any
+				if err := doJSON(root, http.MethodDelete, "/api/calllog/v1/tags", query, nil, &result); err != nil {
+					logrus.Fatal(err)
+				}
+
+				printJSON(result)
+			},
+		},
+	)
+
+	return cmd
+}
@@ -2,11 +2,16 @@ package cmds
 
 import (
 	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/bufbuild/connect-go"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
 	commonv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/common/v1"
 	customerv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/customer/v1"
 	pbx3cxv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/pbx3cx/v1"
@@ -75,6 +80,20 @@ func GetCallLogCommand(root *cli.Root) *cobra.Command {
 		},
 	}
 
+	cmd.AddCommand(
+		GetCallLogDetailsCommand(root),
+		GetNumberQualityReportCommand(root),
+		GetSearchCallLogsCommand(root),
+		GetExportCallLogsCommand(root),
+		GetCustomerTimelineCommand(root),
+		GetCallNotesCommand(root),
+		GetCallTagsCommand(root),
+		GetCallStatisticsCommand(root),
+		GetOpenCallbacksCommand(root),
+		GetMissedCallRulesCommand(root),
+		GetRetentionCommand(root),
+	)
+
 	f := cmd.Flags()
 	{
 		f.StringVar(&fromStr, "from", "", "")
@@ -86,3 +105,319 @@ func GetCallLogCommand(root *cli.Root) *cobra.Command {
 
 	return cmd
 }
+
+func GetCallLogDetailsCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get [id]",
+		Short: "Show a call-log record including all call legs",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var result structs.CallLog
+			if err := doJSON(root, http.MethodGet, "/api/calllog/v1/call", url.Values{"id": args}, nil, &result); err != nil {
+				logrus.Fatal(err)
+			}
+
+			printJSON(result)
+		},
+	}
+
+	return cmd
+}
+
+func GetNumberQualityReportCommand(root *cli.Root) *cobra.Command {
+	var (
+		fromStr   string
+		toStr     string
+		qualities []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "number-quality",
+		Short: "List callers that are not valid phone numbers",
+		Long:  "List callers that are not valid phone numbers (like internal extensions, short codes or unparseable carrier strings) grouped by the caller value received from 3CX.",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, to := parseTimeRangeFlags(fromStr, toStr)
+
+			query := url.Values{}
+			for _, q := range qualities {
+				query.Add("quality", q)
+			}
+			if !from.IsZero() {
+				query.Set("from", from.Format(time.RFC3339))
+			}
+			if !to.IsZero() {
+				query.Set("to", to.Format(time.RFC3339))
+			}
+
+			var result []structs.NumberQualityReportEntry
+			if err := doJSON(root, http.MethodGet, "/api/calllog/v1/number-quality", query, nil, &result); err != nil {
+				logrus.Fatal(err)
+			}
+
+			printJSON(result)
+		},
+	}
+
+	f := cmd.Flags()
+	{
+		f.StringVar(&fromStr, "from", "", "Only report calls after this time (RFC3339)")
+		f.StringVar(&toStr, "to", "", "Only report calls before this time (RFC3339)")
+		f.StringSliceVar(&qualities, "quality", nil, "Only report callers with the given number quality (invalid, unparseable). Defaults to both")
+	}
+
+	return cmd
+}
+
+func GetSearchCallLogsCommand(root *cli.Root) *cobra.Command {
+	var (
+		fromStr    string
+		toStr      string
+		date       string
+		customerId string
+		tags       []string
+		pageSize   int
+		pageToken  string
+		sortBy     string
+		ascending  bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "search [query]",
+		Short: "Search call-logs page by page",
+		Long: "Search call-logs page by page. Use the nextPageToken of the result with --page-token to fetch the next page.\n\n" +
+			"The optional query uses the same syntax as voicemail queries. Supported fields are date, caller, agent,\n" +
+			"inboundNumber (line), callType (type), direction, duration, transferTarget (transfer), error and tags (tag).",
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			from, to := parseTimeRangeFlags(fromStr, toStr)
+
+			query := url.Values{}
+			if len(args) > 0 {
+				query.Set("q", args[0])
+			}
+			if !from.IsZero() {
+				query.Set("from", from.Format(time.RFC3339))
+			}
+			if !to.IsZero() {
+				query.Set("to", to.Format(time.RFC3339))
+			}
+			if date != "" {
+				query.Set("date", date)
+			}
+
+			if customerId != "" {
+				query.Set("customerId", customerId)
+			}
+			for _, t := range tags {
+				query.Add("tag", t)
+			}
+
+			if pageSize > 0 {
+				query.Set("pageSize", strconv.Itoa(pageSize))
+			}
+			if pageToken != "" {
+				query.Set("pageToken", pageToken)
+			}
+			if sortBy != "" {
+				query.Set("sort", sortBy)
+			}
+			if ascending {
+				query.Set("order", "asc")
+			}
+
+			var result any
+			if err := doJSON(root, http.MethodGet, "/api/calllog/v1/search", query, nil, &result); err != nil {
+				logrus.Fatal(err)
+			}
+
+			printJSON(result)
+		},
+	}
+
+	f := cmd.Flags()
+	{
+		f.StringVar(&fromStr, "from", "", "Only list calls after this time (RFC3339)")
+		f.StringVar(&toStr, "to", "", "Only list calls before this time (RFC3339)")
+		f.StringVar(&date, "date", "", "Only list calls at this date (YYYY-MM-DD)")
+		f.StringVar(&customerId, "customer-id", "", "Only list calls of this customer")
+		f.StringSliceVar(&tags, "tag", nil, "Only list calls with any of the given tags")
+		f.IntVar(&pageSize, "page-size", 0, "The number of calls per page. Defaults to 50")
+		f.StringVar(&pageToken, "page-token", "", "The page token returned for the previous page")
+		f.StringVar(&sortBy, "sort", "", "Sort calls by date, duration or caller. Defaults to date")
+		f.BoolVar(&ascending, "asc", false, "Sort in ascending instead of descending order")
+	}
+
+	return cmd
+}
+
+func GetCallStatisticsCommand(root *cli.Root) *cobra.Command {
+	var (
+		fromStr     string
+		toStr       string
+		groupBy     string
+		timezone    string
+		percentiles []string
+	)
+
+	cmd := &cobra.Command{
+		Use:     "statistics",
+		Aliases: []string{"stats"},
+		Short:   "Show call statistics like the number of missed calls and call durations",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, to := parseTimeRangeFlags(fromStr, toStr)
+
+			query := url.Values{}
+			if !from.IsZero() {
+				query.Set("from", from.Format(time.RFC3339))
+			}
+			if !to.IsZero() {
+				query.Set("to", to.Format(time.RFC3339))
+			}
+			if groupBy != "" {
+				query.Set("groupBy", groupBy)
+			}
+			if timezone != "" {
+				query.Set("timezone", timezone)
+			}
+			if len(percentiles) > 0 {
+				query.Set("percentiles", strings.Join(percentiles, ","))
+			}
+
+			var result any
+			if err := doJSON(root, http.MethodGet, "/api/calllog/v1/statistics", query, nil, &result); err != nil {
+				logrus.Fatal(err)
+			}
+
+			printJSON(result)
+		},
+	}
+
+	f := cmd.Flags()
+	{
+		f.StringVar(&fromStr, "from", "", "Only include calls after this time (RFC3339)")
+		f.StringVar(&toStr, "to", "", "Only include calls before this time (RFC3339)")
+		f.StringVar(&groupBy, "group-by", "", "Group statistics by hour, day, inboundNumber, queueExtension or agent")
+		f.StringVar(&timezone, "timezone", "", "The timezone used to group by hour or day (e.g. Europe/Vienna)")
+		f.StringSliceVar(&percentiles, "percentiles", nil, "The duration percentiles to calculate. Defaults to 50,90,95")
+	}
+
+	return cmd
+}
+
+func GetOpenCallbacksCommand(root *cli.Root) *cobra.Command {
+	var (
+		sinceStr       string
+		inboundNumbers []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "callbacks",
+		Short: "List missed calls that have not been called back yet",
+		Run: func(cmd *cobra.Command, args []string) {
+			query := url.Values{}
+			if sinceStr != "" {
+				since, err := time.Parse(time.RFC3339, sinceStr)
+				if err != nil {
+					logrus.Fatal("invalid value for --since")
+				}
+
+				query.Set("since", since.Format(time.RFC3339))
+			}
+			for _, n := range inboundNumbers {
+				query.Add("inboundNumber", n)
+			}
+
+			var result any
+			if err := doJSON(root, http.MethodGet, "/api/calllog/v1/callbacks", query, nil, &result); err != nil {
+				logrus.Fatal(err)
+			}
+
+			printJSON(result)
+		},
+	}
+
+	f := cmd.Flags()
+	{
+		f.StringVar(&sinceStr, "since", "", "Only list calls missed after this time (RFC3339). Defaults to seven days ago")
+		f.StringSliceVar(&inboundNumbers, "inbound-number", nil, "Only list calls to the given inbound numbers")
+	}
+
+	return cmd
+}
+
+func GetRetentionCommand(root *cli.Root) *cobra.Command {
+	var apply bool
+
+	cmd := &cobra.Command{
+		Use:   "retention",
+		Short: "Show which call-log records would be anonymized or deleted by the retention policy",
+		Run: func(cmd *cobra.Command, args []string) {
+			method := http.MethodGet
+			if apply {
+				method = http.MethodPost
+			}
+
+			var result structs.RetentionReport
+			if err := doJSON(root, method, "/api/calllog/v1/retention", nil, nil, &result); err != nil {
+				logrus.Fatal(err)
+			}
+
+			printJSON(result)
+		},
+	}
+
+	cmd.Flags().BoolVar(&apply, "apply", false, "Anonymize and delete the records immediately instead of performing a dry-run")
+
+	return cmd
+}
+
+func GetCustomerTimelineCommand(root *cli.Root) *cobra.Command {
+	var (
+		phoneNumber string
+		pageSize    int
+		pageToken   string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "timeline [customer-id]",
+		Short: "Show calls and voicemails of a customer or phone number, newest first",
+		Long: "Show calls and voicemails of a customer or phone number, newest first. Use the nextPageToken of the\n" +
+			"result with --page-token to fetch the next page.",
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 && phoneNumber == "" {
+				logrus.Fatal("either a customer-id or --phone-number is required")
+			}
+
+			query := url.Values{}
+			if len(args) > 0 {
+				query.Set("customerId", args[0])
+			}
+			if phoneNumber != "" {
+				query.Set("phoneNumber", phoneNumber)
+			}
+			if pageSize > 0 {
+				query.Set("pageSize", strconv.Itoa(pageSize))
+			}
+			if pageToken != "" {
+				query.Set("pageToken", pageToken)
+			}
+
+			var result any
+			if err := doJSON(root, http.MethodGet, "/api/calllog/v1/timeline", query, nil, &result); err != nil {
+				logrus.Fatal(err)
+			}
+
+			printJSON(result)
+		},
+	}
+
+	f := cmd.Flags()
+	{
+		f.StringVar(&phoneNumber, "phone-number", "", "Show the timeline of this phone number")
+		f.IntVar(&pageSize, "page-size", 0, "The number of entries per page. Defaults to 50")
+		f.StringVar(&pageToken, "page-token", "", "The page token returned for the previous page")
+	}
+
+	return cmd
+}
@@ -0,0 +1,117 @@
+package cmds
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+)
+
+func GetExportCallLogsCommand(root *cli.Root) *cobra.Command {
+	var (
+		fromStr        string
+		toStr          string
+		month          string
+		customerId     string
+		inboundNumbers []string
+		tags           []string
+		format         string
+		outputFile     string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "export [query]",
+		Short: "Export call-logs to a CSV or XLSX file",
+		Long: "Export call-logs to a CSV or XLSX file including customer and agent names.\n\n" +
+			"The optional query uses the same syntax as for call-logs search. If --format is not set, it's\n" +
+			"determined by the extension of the output file.",
+		Args: cobra.MaximumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			from, to := parseTimeRangeFlags(fromStr, toStr)
+
+			if month != "" {
+				start, err := time.ParseInLocation("2006-01", month, time.Local)
+				if err != nil {
+					logrus.Fatal("invalid value for --month, expected YYYY-MM")
+				}
+
+				from = start
+				to = start.AddDate(0, 1, 0).Add(-time.Second)
+			}
+
+			if format == "" {
+				format = strings.TrimPrefix(filepath.Ext(outputFile), ".")
+				if format != "xlsx" {
+					format = "csv"
+				}
+			}
+
+			query := url.Values{}
+			query.Set("format", format)
+			if len(args) > 0 {
+				query.Set("q", args[0])
+			}
+			if !from.IsZero() {
+				query.Set("from", from.Format(time.RFC3339))
+			}
+			if !to.IsZero() {
+				query.Set("to", to.Format(time.RFC3339))
+			}
+			if customerId != "" {
+				query.Set("customerId", customerId)
+			}
+			for _, n := range inboundNumbers {
+				query.Add("inboundNumber", n)
+			}
+			for _, t := range tags {
+				query.Add("tag", t)
+			}
+
+			res, err := doRequest(root, http.MethodGet, "/api/calllog/v1/export", query, "", nil)
+			if err != nil {
+				logrus.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			var output io.Writer
+			switch outputFile {
+			case "-":
+				output = os.Stdout
+			default:
+				f, err := os.Create(outputFile)
+				if err != nil {
+					logrus.Fatalf("failed to create output file: %s", err.Error())
+				}
+				defer f.Close()
+
+				output = f
+			}
+
+			if _, err := io.Copy(output, res.Body); err != nil {
+				logrus.Fatalf("failed to write output file: %s", err.Error())
+			}
+		},
+	}
+
+	f := cmd.Flags()
+	{
+		f.StringVar(&fromStr, "from", "", "Only export calls after this time (RFC3339)")
+		f.StringVar(&toStr, "to", "", "Only export calls before this time (RFC3339)")
+		f.StringVar(&month, "month", "", "Only export calls of this month (YYYY-MM). Overwrites --from and --to")
+		f.StringVar(&customerId, "customer-id", "", "Only export calls of this customer")
+		f.StringSliceVar(&inboundNumbers, "inbound-number", nil, "Only export calls to the given inbound numbers")
+		f.StringSliceVar(&tags, "tag", nil, "Only export calls with any of the given tags")
+		f.StringVar(&format, "format", "", "The export format, either csv or xlsx")
+		f.StringVarP(&outputFile, "output", "o", "", "Destination for the export, use - for stdout")
+		cmd.MarkFlagRequired("output")
+	}
+
+	return cmd
+}
@@ -0,0 +1,235 @@
+package cmds
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+)
+
+func GetCDRCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cdr",
+		Short: "Manage call-data-records received from 3CX",
+	}
+
+	cmd.AddCommand(
+		GetListArchivedCDRsCommand(root),
+		GetReplayCDRsCommand(root),
+		GetImportCDRsCommand(root),
+		GetCDRQueueStatsCommand(root),
+		GetCDRListenerStatsCommand(root),
+		GetDeadLettersCommand(root),
+	)
+
+	return cmd
+}
+
+// parseTimeRangeFlags parses the RFC3339 formatted --from and --to flag values.
+func parseTimeRangeFlags(fromStr, toStr string) (time.Time, time.Time) {
+	var from, to time.Time
+
+	if fromStr != "" {
+		var err error
+		from, err = time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			logrus.Fatal("invalid value for --from")
+		}
+	}
+
+	if toStr != "" {
+		var err error
+		to, err = time.Parse(time.RFC3339, toStr)
+		if err != nil {
+			logrus.Fatal("invalid value for --to")
+		}
+	}
+
+	return from, to
+}
+
+func GetListArchivedCDRsCommand(root *cli.Root) *cobra.Command {
+	var (
+		fromStr  string
+		toStr    string
+		outcomes []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "archive [ids...]",
+		Short: "List archived call-data-records",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, to := parseTimeRangeFlags(fromStr, toStr)
+
+			query := url.Values{}
+			for _, id := range args {
+				query.Add("id", id)
+			}
+			for _, o := range outcomes {
+				query.Add("outcome", o)
+			}
+			if !from.IsZero() {
+				query.Set("from", from.Format(time.RFC3339))
+			}
+			if !to.IsZero() {
+				query.Set("to", to.Format(time.RFC3339))
+			}
+
+			var result []structs.RawCDR
+			if err := doJSON(root, http.MethodGet, "/api/cdr/v1/archive", query, nil, &result); err != nil {
+				logrus.Fatal(err)
+			}
+
+			printJSON(result)
+		},
+	}
+
+	f := cmd.Flags()
+	{
+		f.StringVar(&fromStr, "from", "", "Only list records received after this time (RFC3339)")
+		f.StringVar(&toStr, "to", "", "Only list records received before this time (RFC3339)")
+		f.StringSliceVar(&outcomes, "outcome", nil, "Only list records with the given processing outcome")
+	}
+
+	return cmd
+}
+
+func GetReplayCDRsCommand(root *cli.Root) *cobra.Command {
+	var (
+		fromStr  string
+		toStr    string
+		outcomes []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "replay [ids...]",
+		Short: "Process archived call-data-records again",
+		Long:  "Process archived call-data-records again. If neither ids nor --outcome are specified, all failed records are replayed.",
+		Run: func(cmd *cobra.Command, args []string) {
+			from, to := parseTimeRangeFlags(fromStr, toStr)
+
+			req := map[string]any{
+				"ids":      args,
+				"outcomes": outcomes,
+			}
+			if !from.IsZero() {
+				req["from"] = from
+			}
+			if !to.IsZero() {
+				req["to"] = to
+			}
+
+			var result any
+			if err := doJSON(root, http.MethodPost, "/api/cdr/v1/replay", nil, req, &result); err != nil {
+				logrus.Fatal(err)
+			}
+
+			printJSON(result)
+		},
+	}
+
+	f := cmd.Flags()
+	{
+		f.StringVar(&fromStr, "from", "", "Only replay records received after this time (RFC3339)")
+		f.StringVar(&toStr, "to", "", "Only replay records received before this time (RFC3339)")
+		f.StringSliceVar(&outcomes, "outcome", nil, "Only replay records with the given processing outcome")
+	}
+
+	return cmd
+}
+
+func GetImportCDRsCommand(root *cli.Root) *cobra.Command {
+	var (
+		fields  []string
+		version string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "import [file]",
+		Short: "Import a 3CX CDR CSV export",
+		Long:  "Import a 3CX CDR CSV export. Rows that have already been recorded are skipped. Failed rows are printed as newline delimited JSON followed by a summary.",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			f, err := os.Open(args[0])
+			if err != nil {
+				logrus.Fatalf("failed to open file: %s", err)
+			}
+			defer f.Close()
+
+			query := url.Values{}
+			query.Set("name", filepath.Base(args[0]))
+			if len(fields) > 0 {
+				query.Set("fields", strings.Join(fields, ","))
+			}
+			if version != "" {
+				query.Set("version", version)
+			}
+
+			res, err := doRequest(root, http.MethodPost, "/api/cdr/v1/import", query, "text/csv", bufio.NewReader(f))
+			if err != nil {
+				logrus.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			scanner := bufio.NewScanner(res.Body)
+			for scanner.Scan() {
+				fmt.Println(scanner.Text())
+			}
+
+			if err := scanner.Err(); err != nil {
+				logrus.Fatalf("failed to read import result: %s", err)
+			}
+		},
+	}
+
+	f := cmd.Flags()
+	{
+		f.StringSliceVar(&fields, "fields", nil, "The CDR field order of the export. If unset, a header row or the server default is used")
+		f.StringVar(&version, "version", "", "The 3CX CDR format version of the export (v18 or v20). If unset, the server default is used")
+	}
+
+	return cmd
+}
+
+func GetCDRQueueStatsCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "queue",
+		Short: "Show statistics of the CDR ingestion queue",
+		Run: func(cmd *cobra.Command, args []string) {
+			var result any
+			if err := doJSON(root, http.MethodGet, "/api/cdr/v1/queue", nil, nil, &result); err != nil {
+				logrus.Fatal(err)
+			}
+
+			printJSON(result)
+		},
+	}
+
+	return cmd
+}
+
+func GetCDRListenerStatsCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "listener",
+		Short: "Show statistics of the CDR listening server, like the number of rejected peers",
+		Run: func(cmd *cobra.Command, args []string) {
+			var result any
+			if err := doJSON(root, http.MethodGet, "/api/cdr/v1/listener", nil, nil, &result); err != nil {
+				logrus.Fatal(err)
+			}
+
+			printJSON(result)
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,152 @@
+package cmds
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+)
+
+func GetDeadLettersCommand(root *cli.Root) *cobra.Command {
+	var outcomes []string
+
+	cmd := &cobra.Command{
+		Use:     "dead-letters",
+		Aliases: []string{"dl"},
+		Short:   "List call-data-records that failed to be processed",
+		Run: func(cmd *cobra.Command, args []string) {
+			query := url.Values{}
+			for _, o := range outcomes {
+				query.Add("outcome", o)
+			}
+
+			var result []structs.DeadLetter
+			if err := doJSON(root, http.MethodGet, "/api/cdr/v1/dead-letters", query, nil, &result); err != nil {
+				logrus.Fatal(err)
+			}
+
+			printJSON(result)
+		},
+	}
+
+	cmd.Flags().StringSliceVar(&outcomes, "outcome", nil, "Only list dead letters with the given processing outcome")
+
+	cmd.AddCommand(
+		GetDeadLetterCommand(root),
+		GetEditDeadLetterCommand(root),
+		GetRetryDeadLettersCommand(root),
+		GetDeleteDeadLetterCommand(root),
+	)
+
+	return cmd
+}
+
+func GetDeadLetterCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "get [id]",
+		Short: "Show a dead letter",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			var result structs.DeadLetter
+			if err := doJSON(root, http.MethodGet, "/api/cdr/v1/dead-letter", url.Values{"id": args}, nil, &result); err != nil {
+				logrus.Fatal(err)
+			}
+
+			printJSON(result)
+		},
+	}
+
+	return cmd
+}
+
+func GetEditDeadLetterCommand(root *cli.Root) *cobra.Command {
+	var (
+		set     []string
+		columns []string
+		fields  []string
+		version string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "edit [id]",
+		Short: "Edit the columns of a dead letter before retrying it",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			req := map[string]any{
+				"columns": columns,
+				"fields":  fields,
+				"version": version,
+			}
+
+			if len(set) > 0 {
+				values := make(map[string]string, len(set))
+				for _, s := range set {
+					name, value, ok := strings.Cut(s, "=")
+					if !ok {
+						logrus.Fatalf("invalid value for --set: %q, expected field=value", s)
+					}
+
+					values[name] = value
+				}
+
+				req["set"] = values
+			}
+
+			var result structs.DeadLetter
+			if err := doJSON(root, http.MethodPut, "/api/cdr/v1/dead-letter", url.Values{"id": args}, req, &result); err != nil {
+				logrus.Fatal(err)
+			}
+
+			printJSON(result)
+		},
+	}
+
+	f := cmd.Flags()
+	{
+		f.StringArrayVar(&set, "set", nil, "Set the value of a single field (field=value)")
+		f.StringSliceVar(&columns, "columns", nil, "Replace all columns of the record")
+		f.StringSliceVar(&fields, "fields", nil, "Replace the field order of the record")
+		f.StringVar(&version, "version", "", "Change the 3CX CDR format version of the record (v18 or v20)")
+	}
+
+	return cmd
+}
+
+func GetRetryDeadLettersCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "retry [ids...]",
+		Short: "Process dead letters again",
+		Long:  "Process dead letters again. If no ids are specified, all dead letters are retried.",
+		Run: func(cmd *cobra.Command, args []string) {
+			var result any
+			if err := doJSON(root, http.MethodPost, "/api/cdr/v1/dead-letters/retry", nil, map[string]any{"ids": args}, &result); err != nil {
+				logrus.Fatal(err)
+			}
+
+			printJSON(result)
+		},
+	}
+
+	return cmd
+}
+
+func GetDeleteDeadLetterCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete [ids...]",
+		Short: "Discard dead letters",
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			for _, id := range args {
+				if err := doJSON(root, http.MethodDelete, "/api/cdr/v1/dead-letter", url.Values{"id": []string{id}}, nil, nil); err != nil {
+					logrus.Fatal(err)
+				}
+			}
+		},
+	}
+
+	return cmd
+}
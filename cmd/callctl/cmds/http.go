@@ -0,0 +1,94 @@
+package cmds
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+)
+
+// doJSON performs a plain HTTP request against one of the JSON endpoints of the
+// call-service. If body is not nil it is sent as the JSON request body. If result
+// is not nil, the JSON response is decoded into result.
+func doJSON(root *cli.Root, method string, path string, query url.Values, body any, result any) error {
+	var (
+		reader      io.Reader
+		contentType string
+	)
+
+	if body != nil {
+		blob, err := json.Marshal(body)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+
+		reader = bytes.NewReader(blob)
+		contentType = "application/json"
+	}
+
+	res, err := doRequest(root, method, path, query, contentType, reader)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if result == nil {
+		return nil
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
+// doRequest performs a plain HTTP request against the call-service and returns
+// the response if the request succeeded. The caller must close the response body.
+func doRequest(root *cli.Root, method string, path string, query url.Values, contentType string, body io.Reader) (*http.Response, error) {
+	u, err := url.Parse(root.Config().BaseURLS.CallService)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URI: %w", err)
+	}
+
+	u.Path = path
+	u.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(root.Context(), method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare request: %w", err)
+	}
+
+	req.Header.Add("Authorization", "Bearer "+root.Tokens().AccessToken)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	res, err := root.HttpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		defer res.Body.Close()
+
+		msg, _ := io.ReadAll(res.Body)
+
+		return nil, fmt.Errorf("%s: %s", res.Status, bytes.TrimSpace(msg))
+	}
+
+	return res, nil
+}
+
+// printJSON prints v as indented JSON to stdout.
+func printJSON(v any) {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+
+	enc.Encode(v)
+}
@@ -0,0 +1,165 @@
+package cmds
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	commonv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/common/v1"
+	pbx3cxv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/pbx3cx/v1"
+	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+func GetMissedCallRulesCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "missed-call-rules",
+		Short: "List notification rules for missed calls",
+		Run: func(cmd *cobra.Command, args []string) {
+			var result any
+			if err := doJSON(root, http.MethodGet, "/api/calllog/v1/missed-call-rules", nil, nil, &result); err != nil {
+				logrus.Fatal(err)
+			}
+
+			printJSON(result)
+		},
+	}
+
+	cmd.AddCommand(
+		GetAddMissedCallRuleCommand(root),
+		GetDeleteMissedCallRuleCommand(root),
+	)
+
+	return cmd
+}
+
+func GetAddMissedCallRuleCommand(root *cli.Root) *cobra.Command {
+	var (
+		mode            string
+		threshold       int
+		windowMinutes   int
+		name            string
+		description     string
+		subjectTemplate string
+		messageTemplate string
+		users           []string
+		roles           []string
+		times           []string
+		types           []string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "add [inbound-number]",
+		Short: "Add a notification rule for calls missed on an inbound number",
+		Long: "Add a notification rule for calls missed on an inbound number.\n\n" +
+			"The message and subject templates may use {{ .count }}, {{ .name }},\n" +
+			"{{ .inboundNumber }} and {{ .calls }}.",
+		Args: cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			settings := &pbx3cxv1.NotificationSettings{
+				Name:            name,
+				Description:     description,
+				SubjectTemplate: subjectTemplate,
+				MessageTemplate: messageTemplate,
+			}
+
+			switch {
+			case len(users) > 0 && len(roles) > 0:
+				logrus.Fatal("--to-user and --to-role are mutually exclusive")
+
+			case len(users) > 0:
+				userIds, err := root.ResolveUserIds(root.Context(), users)
+				if err != nil {
+					logrus.Fatalf("failed to resolve users: %s", err)
+				}
+
+				settings.Recipients = &pbx3cxv1.NotificationSettings_UserIds{
+					UserIds: &commonv1.StringList{
+						Values: userIds,
+					},
+				}
+
+			case len(roles) > 0:
+				settings.Recipients = &pbx3cxv1.NotificationSettings_RoleIds{
+					RoleIds: &commonv1.StringList{
+						Values: roles,
+					},
+				}
+
+			default:
+				logrus.Fatal("either --to-user or --to-role is required")
+			}
+
+			var err error
+			settings.SendTimes, err = parseSendTimes(times)
+			if err != nil {
+				logrus.Fatal(err)
+			}
+
+			settings.Types, err = parseNotificationTypes(types)
+			if err != nil {
+				logrus.Fatal(err)
+			}
+
+			blob, err := protojson.Marshal(settings)
+			if err != nil {
+				logrus.Fatalf("failed to encode notification settings: %s", err)
+			}
+
+			req := map[string]any{
+				"inboundNumber": args[0],
+				"mode":          mode,
+				"threshold":     threshold,
+				"windowMinutes": windowMinutes,
+				"settings":      json.RawMessage(blob),
+			}
+
+			var result any
+			if err := doJSON(root, http.MethodPost, "/api/calllog/v1/missed-call-rules", nil, req, &result); err != nil {
+				logrus.Fatal(err)
+			}
+
+			printJSON(result)
+		},
+	}
+
+	f := cmd.Flags()
+	{
+		f.StringVar(&mode, "mode", "immediate", "When to notify: immediate, digest (at --send-at) or threshold (--threshold calls within --window minutes)")
+		f.IntVar(&threshold, "threshold", 0, "The number of missed calls required for threshold rules")
+		f.IntVar(&windowMinutes, "window", 0, "The time window in minutes for threshold rules")
+
+		f.StringVar(&name, "name", "", "The name for the notification setting")
+		cmd.MarkFlagRequired("name")
+
+		f.StringVar(&description, "description", "", "An optional description for the notification settings")
+
+		f.StringVar(&subjectTemplate, "subject", "", "The template for the notification subject (only for WebPush and EMail)")
+		f.StringVar(&messageTemplate, "message", "", "The template for the notification message")
+		f.StringSliceVar(&users, "to-user", nil, "A list of users to notify")
+		f.StringSliceVar(&roles, "to-role", nil, "A list of role IDs to notify")
+		f.StringSliceVar(&times, "send-at", nil, "A list of time-of-day (HH:MM) at which digests should be sent")
+
+		f.StringSliceVar(&types, "type", nil, "A list of notification types to send. Valid values are sms, push or mail")
+		cmd.MarkFlagRequired("type")
+	}
+
+	return cmd
+}
+
+func GetDeleteMissedCallRuleCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "delete [id]",
+		Short: "Delete a missed-call notification rule",
+		Args:  cobra.ExactArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := doJSON(root, http.MethodDelete, "/api/calllog/v1/missed-call-rule", url.Values{"id": args}, nil, nil); err != nil {
+				logrus.Fatal(err)
+			}
+		},
+	}
+
+	return cmd
+}
@@ -0,0 +1,141 @@
+package cmds
+
+import (
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+	"github.com/tierklinik-dobersberg/apis/pkg/cli"
+)
+
+func GetPrivacyCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "privacy",
+		Short: "Handle data-subject requests for customers and phone numbers",
+	}
+
+	cmd.AddCommand(
+		GetDataSubjectExportCommand(root),
+		GetDataSubjectEraseCommand(root),
+		GetDataSubjectAuditCommand(root),
+	)
+
+	return cmd
+}
+
+func GetDataSubjectExportCommand(root *cli.Root) *cobra.Command {
+	var (
+		customerId  string
+		phoneNumber string
+		outputFile  string
+	)
+
+	cmd := &cobra.Command{
+		Use:   "export",
+		Short: "Export all call-logs, voicemails and recordings of a customer or phone number as a ZIP archive",
+		Run: func(cmd *cobra.Command, args []string) {
+			query := url.Values{}
+			if customerId != "" {
+				query.Set("customerId", customerId)
+			}
+			if phoneNumber != "" {
+				query.Set("phoneNumber", phoneNumber)
+			}
+
+			res, err := doRequest(root, http.MethodGet, "/api/privacy/v1/export", query, "", nil)
+			if err != nil {
+				logrus.Fatal(err)
+			}
+			defer res.Body.Close()
+
+			var output io.Writer
+			switch outputFile {
+			case "-":
+				output = os.Stdout
+			default:
+				f, err := os.Create(outputFile)
+				if err != nil {
+					logrus.Fatalf("failed to create output file: %s", err.Error())
+				}
+				defer f.Close()
+
+				output = f
+			}
+
+			if _, err := io.Copy(output, res.Body); err != nil {
+				logrus.Fatalf("failed to write output file: %s", err.Error())
+			}
+		},
+	}
+
+	f := cmd.Flags()
+	{
+		f.StringVar(&customerId, "customer-id", "", "The ID of the customer")
+		f.StringVar(&phoneNumber, "phone-number", "", "The phone number of the caller")
+		f.StringVarP(&outputFile, "output", "o", "", "Destination for the ZIP archive, use - for stdout")
+		cmd.MarkFlagRequired("output")
+	}
+
+	return cmd
+}
+
+func GetDataSubjectEraseCommand(root *cli.Root) *cobra.Command {
+	var (
+		customerId  string
+		phoneNumber string
+		anonymize   bool
+	)
+
+	cmd := &cobra.Command{
+		Use:   "erase",
+		Short: "Delete or anonymize all call-logs, voicemails and recordings of a customer or phone number",
+		Run: func(cmd *cobra.Command, args []string) {
+			req := map[string]any{
+				"customerId":  customerId,
+				"phoneNumber": phoneNumber,
+				"mode":        structs.DataSubjectErase,
+			}
+
+			if anonymize {
+				req["mode"] = structs.DataSubjectAnonymize
+			}
+
+			var result structs.DataSubjectAudit
+			if err := doJSON(root, http.MethodPost, "/api/privacy/v1/erase", nil, req, &result); err != nil {
+				logrus.Fatal(err)
+			}
+
+			printJSON(result)
+		},
+	}
+
+	f := cmd.Flags()
+	{
+		f.StringVar(&customerId, "customer-id", "", "The ID of the customer")
+		f.StringVar(&phoneNumber, "phone-number", "", "The phone number of the caller")
+		f.BoolVar(&anonymize, "anonymize", false, "Anonymize call-logs and voicemails instead of deleting them. Recordings are always removed")
+	}
+
+	return cmd
+}
+
+func GetDataSubjectAuditCommand(root *cli.Root) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "audit",
+		Short: "List all data-subject requests",
+		Run: func(cmd *cobra.Command, args []string) {
+			var result []structs.DataSubjectAudit
+			if err := doJSON(root, http.MethodGet, "/api/privacy/v1/audit", nil, nil, &result); err != nil {
+				logrus.Fatal(err)
+			}
+
+			printJSON(result)
+		},
+	}
+
+	return cmd
+}
@@ -169,41 +169,15 @@ func GetAddNotificationSettingsCommand(root *cli.Root) *cobra.Command {
 			}
 
 			// parse and append send times
-			for _, t := range times {
-				parts := strings.Split(t, ":")
-				if len(parts) != 2 {
-					logrus.Fatalf("failed to parse time-of-day %q: %s", t, err)
-				}
-
-				hour, err := strconv.ParseInt(strings.TrimPrefix(parts[0], "0"), 10, 0)
-				if err != nil {
-					logrus.Fatalf("failed to parse time-of-day: invalid hour %q: %s", parts[0], err)
-				}
-
-				minute, err := strconv.ParseInt(strings.TrimPrefix(parts[1], "0"), 10, 0)
-				if err != nil {
-					logrus.Fatalf("failed to parse time-of-day: invalid minute %q: %s", parts[1], err)
-				}
-
-				req.SendTimes = append(req.SendTimes, &commonv1.DayTime{
-					Hour:   int32(hour),
-					Minute: int32(minute),
-				})
+			req.SendTimes, err = parseSendTimes(times)
+			if err != nil {
+				logrus.Fatal(err)
 			}
 
 			// parse and append notification-types
-			for _, t := range types {
-				switch t {
-				case "sms":
-					req.Types = append(req.Types, pbx3cxv1.NotificationType_NOTIFICATION_TYPE_SMS)
-				case "mail", "email":
-					req.Types = append(req.Types, pbx3cxv1.NotificationType_NOTIFICATION_TYPE_MAIL)
-				case "push", "webpush":
-					req.Types = append(req.Types, pbx3cxv1.NotificationType_NOTIFICATION_TYPE_WEBPUSH)
-
-				default:
-					logrus.Fatalf("unsupported or invalid notification type %q", t)
-				}
+			req.Types, err = parseNotificationTypes(types)
+			if err != nil {
+				logrus.Fatal(err)
 			}
 
 			root.Print(req)
@@ -500,3 +474,53 @@ func GetMarkVoiceMailCommand(root *cli.Root) *cobra.Command {
 
 	return cmd
 }
+
+// parseSendTimes parses a list of time-of-day values in the format HH:MM.
+func parseSendTimes(times []string) ([]*commonv1.DayTime, error) {
+	var result []*commonv1.DayTime
+
+	for _, t := range times {
+		parts := strings.Split(t, ":")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("failed to parse time-of-day %q", t)
+		}
+
+		hour, err := strconv.ParseInt(strings.TrimPrefix(parts[0], "0"), 10, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse time-of-day: invalid hour %q: %w", parts[0], err)
+		}
+
+		minute, err := strconv.ParseInt(strings.TrimPrefix(parts[1], "0"), 10, 0)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse time-of-day: invalid minute %q: %w", parts[1], err)
+		}
+
+		result = append(result, &commonv1.DayTime{
+			Hour:   int32(hour),
+			Minute: int32(minute),
+		})
+	}
+
+	return result, nil
+}
+
+// parseNotificationTypes parses a list of notification types (sms, mail or push).
+func parseNotificationTypes(types []string) ([]pbx3cxv1.NotificationType, error) {
+	var result []pbx3cxv1.NotificationType
+
+	for _, t := range types {
+		switch t {
+		case "sms":
+			result = append(result, pbx3cxv1.NotificationType_NOTIFICATION_TYPE_SMS)
+		case "mail", "email":
+			result = append(result, pbx3cxv1.NotificationType_NOTIFICATION_TYPE_MAIL)
+		case "push", "webpush":
+			result = append(result, pbx3cxv1.NotificationType_NOTIFICATION_TYPE_WEBPUSH)
+
+		default:
+			return nil, fmt.Errorf("unsupported or invalid notification type %q", t)
+		}
+	}
+
+	return result, nil
+}
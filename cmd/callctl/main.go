@@ -15,6 +15,8 @@ func main() {
 		cmds.GetInboundNumbersCommand(root),
 		cmds.GetVoiceMailCommand(root),
 		cmds.GetPhoneExtensionsCommand(root),
+		cmds.GetCDRCommand(root),
+		cmds.GetPrivacyCommand(root),
 	)
 
 	if err := root.Execute(); err != nil {
@@ -0,0 +1,134 @@
+package cdr
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// minReconnectDelay is the initial delay before trying to re-connect
+	// to the 3CX CDR socket.
+	minReconnectDelay = time.Second
+
+	// maxReconnectDelay is the upper limit for the exponential back-off
+	// between re-connection attempts.
+	maxReconnectDelay = 2 * time.Minute
+
+	// dialTimeout is the timeout for a single connection attempt.
+	dialTimeout = 10 * time.Second
+)
+
+// Client implements Server for the 3CX PASSIVE socket mode. In this mode, 3CX
+// listens for incoming connections and the Client is responsible for connecting
+// to it. If the connection is lost, the Client re-connects using an exponential
+// back-off.
+type Client struct {
+	wg        sync.WaitGroup
+	addr      string
+	processor Processor
+
+	l *slog.Logger
+}
+
+// NewClient returns a new CDR client that connects to the 3CX CDR socket at addr
+// and passes all received records to p.
+func NewClient(addr string, p Processor, logger *slog.Logger) *Client {
+	return &Client{
+		addr:      addr,
+		processor: p,
+		l:         logger,
+	}
+}
+
+// Start implements Server and starts connecting to the 3CX CDR socket in the background.
+// The client stops as soon as ctx is cancelled.
+func (cli *Client) Start(ctx context.Context) error {
+	cli.wg.Add(1)
+	go cli.run(ctx)
+
+	return nil
+}
+
+// Wait implements Server.
+func (cli *Client) Wait() {
+	cli.wg.Wait()
+}
+
+func (cli *Client) run(ctx context.Context) {
+	defer cli.wg.Done()
+
+	delay := minReconnectDelay
+
+	for {
+		connected, err := cli.connectAndServe(ctx)
+
+		if ctx.Err() != nil {
+			cli.l.Info("CDR client stopped")
+			return
+		}
+
+		// reset the back-off if we had a working connection
+		if connected {
+			delay = minReconnectDelay
+		}
+
+		if err != nil && !errors.Is(err, io.EOF) {
+			cli.l.Error("CDR connection failed", "error", err, "retry-in", delay.String())
+		} else {
+			cli.l.Info("CDR connection closed by peer", "retry-in", delay.String())
+		}
+
+		select {
+		case <-ctx.Done():
+			cli.l.Info("CDR client stopped")
+			return
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+		if delay > maxReconnectDelay {
+			delay = maxReconnectDelay
+		}
+	}
+}
+
+// connectAndServe dials the 3CX CDR socket and processes records until the
+// connection is closed. The returned bool reports whether a connection has
+// been established.
+func (cli *Client) connectAndServe(ctx context.Context) (bool, error) {
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	conn, err := dialer.DialContext(ctx, "tcp", cli.addr)
+	if err != nil {
+		return false, err
+	}
+
+	log := cli.l.With("peer", conn.RemoteAddr().String())
+	log.Info("connected to 3CX CDR socket")
+
+	// make sure we close the connection as soon as the context is cancelled
+	// so processConnection returns.
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+
+		if err := conn.Close(); err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Error("failed to close connection", "error", err)
+		}
+	}()
+
+	return true, processConnection(ctx, conn, cli.processor, log)
+}
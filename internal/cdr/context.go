@@ -0,0 +1,18 @@
+package cdr
+
+import "context"
+
+type peerKey struct{}
+
+// WithPeer returns a new context that carries the address of the peer that
+// sent a call-data-record.
+func WithPeer(ctx context.Context, peer string) context.Context {
+	return context.WithValue(ctx, peerKey{}, peer)
+}
+
+// PeerFromContext returns the peer address stored in ctx, if any.
+func PeerFromContext(ctx context.Context) string {
+	peer, _ := ctx.Value(peerKey{}).(string)
+
+	return peer
+}
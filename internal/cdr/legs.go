@@ -0,0 +1,164 @@
+package cdr
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+)
+
+// legFromRecord converts a single call-data-record into a call leg.
+func legFromRecord(r Record) structs.CallLeg {
+	return structs.CallLeg{
+		HistoryID:        r.HistoryID,
+		From:             r.FromNumber,
+		FromType:         r.FromType,
+		To:               r.ToNumber,
+		ToType:           r.ToType,
+		Final:            r.FinalNumber,
+		FinalType:        r.FinalType,
+		Dialed:           r.DialNumber,
+		FromName:         r.FromDispName,
+		ToName:           r.ToDispName,
+		FinalName:        r.FinalDispName,
+		TimeStart:        r.TimeReceived,
+		TimeAnswered:     r.TimeAnswered,
+		TimeEnd:          r.TimeEnd,
+		DurationSeconds:  uint64(math.Floor(r.Duration.Seconds())),
+		ReasonTerminated: string(r.ReasonTerminated),
+		Chain:            r.Chain,
+		Inbound:          r.Inbound(),
+		Answered:         r.Answered(),
+	}
+}
+
+// summarizeLegs updates the call-level fields of cr based on its call legs.
+// The first leg determines the direction and the caller of the call while
+// the agent and the call type are taken from the last answered leg. If no leg
+// has been answered, the last leg is used. Legs may overlap (e.g. during
+// attended transfers) so the duration is the time between the first answer
+// and the end of the call.
+func (p *ProcessorImpl) summarizeLegs(ctx context.Context, cr *structs.CallLog) {
+	if len(cr.Legs) == 0 {
+		return
+	}
+
+	first := cr.Legs[0]
+	final := cr.Legs[len(cr.Legs)-1]
+	answered := false
+
+	var (
+		timeAnswered time.Time
+		last         = first
+	)
+
+	for _, leg := range cr.Legs {
+		if leg.Answered {
+			final = leg
+			answered = true
+
+			if timeAnswered.IsZero() && !leg.TimeAnswered.IsZero() {
+				timeAnswered = leg.TimeAnswered
+			}
+		}
+
+		if !leg.TimeEnd.Before(last.TimeEnd) {
+			last = leg
+		}
+	}
+
+	cr.Date = first.TimeStart
+	cr.DateStr = first.TimeStart.Format("2006-01-02")
+	cr.FromType = first.FromType
+	cr.ToType = final.FinalType
+	cr.Chain = final.Chain
+
+	// the leg that ended last tells us how the call has been terminated.
+	cr.TimeAnswered = timeAnswered
+	cr.TimeEnd = last.TimeEnd
+	cr.ReasonTerminated = last.ReasonTerminated
+	cr.TerminatedBy = terminatedBy(last)
+
+	switch {
+	case !timeAnswered.IsZero() && !last.TimeEnd.IsZero():
+		cr.DurationSeconds = secondsBetween(timeAnswered, last.TimeEnd)
+	case answered:
+		cr.DurationSeconds = final.DurationSeconds
+	default:
+		cr.DurationSeconds = 0
+	}
+
+	switch {
+	case !timeAnswered.IsZero():
+		cr.RingSeconds = secondsBetween(first.TimeStart, timeAnswered)
+	case !last.TimeEnd.IsZero():
+		cr.RingSeconds = secondsBetween(first.TimeStart, last.TimeEnd)
+	default:
+		cr.RingSeconds = 0
+	}
+
+	previousAgent := cr.Agent
+
+	if first.Inbound {
+		cr.Caller = first.From
+		cr.Direction = "Inbound"
+		cr.InboundNumber = first.Dialed
+		cr.Agent = strings.TrimPrefix(final.Final, "Ext.")
+		cr.CallerName = first.FromName
+		cr.AgentName = final.FinalName
+
+		if answered {
+			cr.CallType = "Inbound"
+		} else {
+			cr.CallType = "Missed"
+		}
+	} else {
+		cr.Caller = first.Dialed
+		cr.Direction = "Outbound"
+		cr.Agent = strings.TrimPrefix(first.From, "Ext.")
+		cr.CallerName = first.FinalName
+		cr.AgentName = first.FromName
+
+		if answered {
+			cr.CallType = "Outbound"
+		} else {
+			cr.CallType = "NotAnswered"
+		}
+	}
+
+	if cr.AgentUserId == "" || cr.Agent != previousAgent {
+		cr.AgentUserId = p.userResolver.GetUserIdForAgent(ctx, cr.Agent)
+	}
+}
+
+// terminatedBy returns who terminated the call leg depending on whether the
+// source or the destination participant of the leg is an external party.
+func terminatedBy(leg structs.CallLeg) string {
+	var participant structs.Type
+
+	switch TerminationReason(leg.ReasonTerminated) {
+	case TerminationReasonSource:
+		participant = leg.FromType
+	case TerminationReasonDest:
+		participant = leg.FinalType
+	default:
+		return ""
+	}
+
+	switch participant {
+	case structs.TypeExternalLine, structs.TypeOutboundRule:
+		return structs.TerminatedByCaller
+	default:
+		return structs.TerminatedByAgent
+	}
+}
+
+func secondsBetween(from, to time.Time) uint64 {
+	if to.Before(from) {
+		return 0
+	}
+
+	return uint64(math.Floor(to.Sub(from).Seconds()))
+}
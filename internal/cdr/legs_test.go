@@ -0,0 +1,130 @@
+package cdr
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+)
+
+type staticResolver map[string]string
+
+func (r staticResolver) GetUserIdForAgent(_ context.Context, agent string) string {
+	return r[agent]
+}
+
+func Test_summarizeLegs(t *testing.T) {
+	p := NewProcessor(nil, nil, staticResolver{"20": "user-20"}, nil, nil)
+
+	start := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	var cr structs.CallLog
+
+	// the transfer leg is received first
+	cr.AddLeg(structs.CallLeg{
+		HistoryID:        "2",
+		From:             "Ext.10",
+		FromType:         structs.TypeExtension,
+		Final:            "Ext.20",
+		FinalType:        structs.TypeExtension,
+		TimeStart:        start.Add(time.Minute),
+		TimeAnswered:     start.Add(time.Minute + 5*time.Second),
+		TimeEnd:          start.Add(2*time.Minute + 5*time.Second),
+		DurationSeconds:  60,
+		ReasonTerminated: TerminationReasonDest,
+		Answered:         true,
+	})
+
+	cr.AddLeg(structs.CallLeg{
+		HistoryID:        "1",
+		From:             "+4312345",
+		FromType:         structs.TypeExternalLine,
+		Final:            "Ext.10",
+		FinalType:        structs.TypeExtension,
+		Dialed:           "1000",
+		TimeStart:        start,
+		TimeAnswered:     start.Add(20 * time.Second),
+		TimeEnd:          start.Add(50 * time.Second),
+		DurationSeconds:  30,
+		ReasonTerminated: TerminationReasonSource,
+		Inbound:          true,
+		Answered:         true,
+	})
+
+	// a re-sent leg must not be added twice
+	cr.AddLeg(cr.Legs[0])
+
+	p.summarizeLegs(context.Background(), &cr)
+
+	if len(cr.Legs) != 2 || cr.Legs[0].HistoryID != "1" {
+		t.Fatalf("unexpected legs: %+v", cr.Legs)
+	}
+
+	if cr.Direction != "Inbound" || cr.CallType != "Inbound" {
+		t.Errorf("unexpected direction %q or call type %q", cr.Direction, cr.CallType)
+	}
+
+	if cr.Caller != "+4312345" || cr.InboundNumber != "1000" {
+		t.Errorf("unexpected caller %q or inbound number %q", cr.Caller, cr.InboundNumber)
+	}
+
+	if cr.Agent != "20" || cr.AgentUserId != "user-20" {
+		t.Errorf("unexpected agent %q (%q)", cr.Agent, cr.AgentUserId)
+	}
+
+	// from the first answer until the end of the transfer leg
+	if cr.DurationSeconds != 105 || !cr.Date.Equal(start) {
+		t.Errorf("unexpected duration %d or date %s", cr.DurationSeconds, cr.Date)
+	}
+
+	if cr.RingSeconds != 20 || !cr.TimeEnd.Equal(start.Add(2*time.Minute+5*time.Second)) {
+		t.Errorf("unexpected ring time %d or end time %s", cr.RingSeconds, cr.TimeEnd)
+	}
+
+	if cr.ReasonTerminated != TerminationReasonDest || cr.TerminatedBy != "agent" {
+		t.Errorf("unexpected termination reason %q (%q)", cr.ReasonTerminated, cr.TerminatedBy)
+	}
+}
+
+func Test_summarizeLegs_overlapping(t *testing.T) {
+	p := NewProcessor(nil, nil, staticResolver{}, nil, nil)
+
+	start := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	var cr structs.CallLog
+
+	// attended transfer: the consultation call overlaps with the original leg
+	cr.AddLeg(structs.CallLeg{
+		HistoryID:       "1",
+		From:            "+4312345",
+		FromType:        structs.TypeExternalLine,
+		Final:           "Ext.10",
+		FinalType:       structs.TypeExtension,
+		TimeStart:       start,
+		TimeAnswered:    start.Add(10 * time.Second),
+		TimeEnd:         start.Add(100 * time.Second),
+		DurationSeconds: 90,
+		Inbound:         true,
+		Answered:        true,
+	})
+
+	cr.AddLeg(structs.CallLeg{
+		HistoryID:       "2",
+		From:            "Ext.10",
+		FromType:        structs.TypeExtension,
+		Final:           "Ext.20",
+		FinalType:       structs.TypeExtension,
+		TimeStart:       start.Add(30 * time.Second),
+		TimeAnswered:    start.Add(40 * time.Second),
+		TimeEnd:         start.Add(120 * time.Second),
+		DurationSeconds: 80,
+		Answered:        true,
+	})
+
+	p.summarizeLegs(context.Background(), &cr)
+
+	if cr.DurationSeconds != 110 {
+		t.Errorf("expected a duration of 110s, got %d", cr.DurationSeconds)
+	}
+}
@@ -3,30 +3,86 @@ package cdr
 import (
 	"bufio"
 	"context"
+	"crypto/tls"
 	"encoding/csv"
 	"log/slog"
 	"net"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
+// handshakeTimeout is the maximum time a peer may take to complete the TLS
+// handshake.
+const handshakeTimeout = 10 * time.Second
+
 type ListeningServer struct {
 	wg        sync.WaitGroup
 	addr      string
 	processor Processor
 
+	tlsConfig    *tls.Config
+	allowedPeers []*net.IPNet
+	rejected     atomic.Uint64
+
+	connLock sync.Mutex
+	conns    map[net.Conn]struct{}
+
 	l *slog.Logger
 }
 
-func NewListeningServer(addr string, p Processor, logger *slog.Logger) *ListeningServer {
+// ListenerStats holds statistics about a ListeningServer.
+type ListenerStats struct {
+	// Connections is the number of open connections.
+	Connections int `json:"connections"`
+	// RejectedPeers counts connections that have been rejected because the
+	// peer is not allowed or failed the TLS handshake.
+	RejectedPeers uint64 `json:"rejectedPeers"`
+	// TLS is set to true if the server requires TLS.
+	TLS bool `json:"tls"`
+}
+
+func NewListeningServer(addr string, p Processor, logger *slog.Logger, opts ...ListenerOption) *ListeningServer {
 	l := &ListeningServer{
 		addr:      addr,
 		l:         logger,
 		processor: p,
+		conns:     make(map[net.Conn]struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(l)
 	}
 
 	return l
 }
 
+// Stats returns the current statistics of the server.
+func (lis *ListeningServer) Stats() ListenerStats {
+	lis.connLock.Lock()
+	defer lis.connLock.Unlock()
+
+	return ListenerStats{
+		Connections:   len(lis.conns),
+		RejectedPeers: lis.rejected.Load(),
+		TLS:           lis.tlsConfig != nil,
+	}
+}
+
+// reject closes conn and counts it as rejected.
+func (lis *ListeningServer) reject(conn net.Conn, reason string, err error) {
+	lis.rejected.Add(1)
+
+	args := []any{"peer", conn.RemoteAddr().String(), "reason", reason}
+	if err != nil {
+		args = append(args, "error", err)
+	}
+
+	lis.l.Warn("rejected CDR connection", args...)
+
+	conn.Close()
+}
+
 func (lis *ListeningServer) Start(ctx context.Context) error {
 	listener, err := net.Listen("tcp", lis.addr)
 	if err != nil {
@@ -38,6 +94,16 @@ func (lis *ListeningServer) Start(ctx context.Context) error {
 		if err := listener.Close(); err != nil {
 			lis.l.Error("failed to close listener", "error", err)
 		}
+
+		// close all open connections so handleConnection returns.
+		lis.connLock.Lock()
+		defer lis.connLock.Unlock()
+
+		for conn := range lis.conns {
+			if err := conn.Close(); err != nil {
+				lis.l.Error("failed to close connection", "peer", conn.RemoteAddr().String(), "error", err)
+			}
+		}
 	}()
 
 	lis.wg.Add(1)
@@ -47,10 +113,32 @@ func (lis *ListeningServer) Start(ctx context.Context) error {
 		for {
 			conn, err := listener.Accept()
 			if err != nil {
-				lis.l.Error("failed to accept connection", "error", err)
+				if ctx.Err() == nil {
+					lis.l.Error("failed to accept connection", "error", err)
+				}
 				return
 			}
 
+			if !lis.peerAllowed(conn.RemoteAddr()) {
+				lis.reject(conn, "peer not allowed", nil)
+
+				continue
+			}
+
+			if lis.tlsConfig != nil {
+				conn = tls.Server(conn, lis.tlsConfig)
+			}
+
+			lis.connLock.Lock()
+			if ctx.Err() != nil {
+				lis.connLock.Unlock()
+				conn.Close()
+
+				return
+			}
+			lis.conns[conn] = struct{}{}
+			lis.connLock.Unlock()
+
 			lis.wg.Add(1)
 			go lis.handleConnection(ctx, conn)
 		}
@@ -59,21 +147,81 @@ func (lis *ListeningServer) Start(ctx context.Context) error {
 	return nil
 }
 
+// Wait implements Server.
+func (lis *ListeningServer) Wait() {
+	lis.wg.Wait()
+}
+
 func (lis *ListeningServer) handleConnection(ctx context.Context, conn net.Conn) {
 	defer lis.wg.Done()
 
+	defer func() {
+		lis.connLock.Lock()
+		defer lis.connLock.Unlock()
+
+		delete(lis.conns, conn)
+		conn.Close()
+	}()
+
+	log := lis.l.With("peer", conn.RemoteAddr().String())
+
+	// complete the TLS handshake so we can reject peers without a valid
+	// client certificate before reading any rows.
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		hsCtx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+		err := tlsConn.HandshakeContext(hsCtx)
+		cancel()
+
+		if err != nil {
+			if ctx.Err() == nil {
+				lis.reject(conn, "TLS handshake failed", err)
+			}
+
+			return
+		}
+	}
+
+	if err := processConnection(ctx, conn, lis.processor, log); err != nil && ctx.Err() == nil {
+		log.Error("failed to read record", "error", err)
+	}
+}
+
+// processConnection reads CSV encoded call-data-records from conn and passes
+// each row to p. If the first row of the connection is a header row, it is used
+// as the field order for all following rows.
+// It returns the error that caused reading to stop.
+func processConnection(ctx context.Context, conn net.Conn, p Processor, log *slog.Logger) error {
+	ctx = WithPeer(ctx, conn.RemoteAddr().String())
+
 	reader := bufio.NewReader(conn)
 	csvReader := csv.NewReader(reader)
 
-	log := lis.l.With("peer", conn.RemoteAddr().String())
+	// The column count is verified by the processor, don't drop the whole
+	// connection if 3CX sends a row with an unexpected number of fields.
+	csvReader.FieldsPerRecord = -1
 
+	first := true
 	for {
 		line, err := csvReader.Read()
 		if err != nil {
-			log.Error("failed to read record", "error", err)
-			return
+			return err
+		}
+
+		if first {
+			first = false
+
+			if order, ok := DetectFieldOrder(line); ok {
+				if fp, ok := p.(FieldOrderProcessor); ok {
+					log.Info("using CDR field order from header row", "fields", line)
+					p = fp.WithFieldOrder(order)
+				} else {
+					log.Warn("ignoring CDR header row, processor does not support custom field orders")
+				}
+
+				continue
+			}
 		}
 
-		lis.processor.Process(ctx, line, log)
+		p.Process(ctx, line, log)
 	}
 }
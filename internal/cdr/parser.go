@@ -0,0 +1,184 @@
+package cdr
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+)
+
+// Supported 3CX CDR format versions.
+const (
+	Version18 = "v18"
+	Version20 = "v20"
+
+	// DefaultVersion is used if no CDR format version is configured.
+	DefaultVersion = Version18
+)
+
+// Parser parses the column values of a specific 3CX CDR format version.
+type Parser interface {
+	// Version returns the CDR format version handled by the parser.
+	Version() string
+
+	// DefaultFieldOrder returns the field order used if neither a field order
+	// is configured nor a header row has been sent.
+	DefaultFieldOrder() []Field
+
+	// ParseTime parses a time-start, time-answered or time-end value.
+	ParseTime(string) (time.Time, error)
+
+	// ParseDuration parses a duration value.
+	ParseDuration(string) (time.Duration, error)
+
+	// ParseType parses a participant type like from-type or final-type.
+	ParseType(string) structs.Type
+}
+
+var parsers = map[string]Parser{
+	Version18: v18Parser{},
+	Version20: v20Parser{},
+}
+
+// ParserForVersion returns the parser for the given CDR format version. If
+// version is empty, the parser for DefaultVersion is returned.
+func ParserForVersion(version string) (Parser, error) {
+	if version == "" {
+		version = DefaultVersion
+	}
+
+	p, ok := parsers[strings.ToLower(strings.TrimSpace(version))]
+	if !ok {
+		return nil, fmt.Errorf("unsupported CDR version %q, supported versions are %s", version, strings.Join(Versions(), ", "))
+	}
+
+	return p, nil
+}
+
+// Versions returns all supported CDR format versions.
+func Versions() []string {
+	versions := make([]string, 0, len(parsers))
+	for v := range parsers {
+		versions = append(versions, v)
+	}
+	sort.Strings(versions)
+
+	return versions
+}
+
+// v18Parser handles the CDR format of 3CX v18 and earlier.
+type v18Parser struct{}
+
+func (v18Parser) Version() string { return Version18 }
+
+func (v18Parser) DefaultFieldOrder() []Field { return defaultFieldOrder }
+
+func (v18Parser) ParseTime(t string) (time.Time, error) {
+	if t == "" {
+		return time.Time{}, nil
+	}
+
+	return time.ParseInLocation("2006.01.02 15:04:05", t, time.UTC)
+}
+
+func (v18Parser) ParseDuration(d string) (time.Duration, error) {
+	return parseDuration(d)
+}
+
+func (v18Parser) ParseType(t string) structs.Type {
+	return structs.Type(t)
+}
+
+// v20Parser handles the CDR format of 3CX v20. In contrast to v18, times are
+// ISO 8601 formatted, durations may contain fractional seconds and participant
+// types use PascalCase names.
+type v20Parser struct{}
+
+// v20FieldOrder is the default field order of 3CX v20 which adds the cdr-id
+// and billing-cost columns to the v18 fields.
+var v20FieldOrder = append(append([]Field{FieldCdrID}, defaultFieldOrder...), FieldBillingCost)
+
+// v20TimeLayouts holds all time layouts accepted by the v20 parser. Times
+// without a zone are in UTC.
+var v20TimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+}
+
+func (v20Parser) Version() string { return Version20 }
+
+func (v20Parser) DefaultFieldOrder() []Field { return v20FieldOrder }
+
+func (v20Parser) ParseTime(t string) (time.Time, error) {
+	t = strings.TrimSpace(t)
+	if t == "" {
+		return time.Time{}, nil
+	}
+
+	for _, layout := range v20TimeLayouts {
+		if parsed, err := time.ParseInLocation(layout, t, time.UTC); err == nil {
+			return parsed.UTC(), nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid time %q", t)
+}
+
+// ParseDuration parses either HH:MM:SS(.fff) or the number of seconds.
+func (v20Parser) ParseDuration(d string) (time.Duration, error) {
+	d = strings.TrimSpace(d)
+	if d == "" {
+		return 0, nil
+	}
+
+	parts := strings.Split(d, ":")
+	if len(parts) != 1 && len(parts) != 3 {
+		return 0, fmt.Errorf("invalid duration %q", d)
+	}
+
+	var total time.Duration
+	for idx, p := range parts {
+		factor := time.Second
+		if len(parts) == 3 {
+			factor = []time.Duration{time.Hour, time.Minute, time.Second}[idx]
+		}
+
+		v, err := strconv.ParseFloat(p, 64)
+		if err != nil || v < 0 {
+			return 0, fmt.Errorf("invalid duration %q", d)
+		}
+
+		total += time.Duration(v * float64(factor))
+	}
+
+	return total, nil
+}
+
+// ParseType converts v20 type names like "ExternalLine" into the v18 names
+// used throughout this service (e.g. "external_line").
+func (v20Parser) ParseType(t string) structs.Type {
+	t = strings.TrimSpace(t)
+
+	var b strings.Builder
+	for idx, r := range t {
+		switch {
+		case r == ' ' || r == '-':
+			b.WriteRune('_')
+		case unicode.IsUpper(r):
+			if idx > 0 && !unicode.IsUpper(rune(t[idx-1])) && t[idx-1] != ' ' && t[idx-1] != '_' {
+				b.WriteRune('_')
+			}
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			b.WriteRune(r)
+		}
+	}
+
+	return structs.Type(b.String())
+}
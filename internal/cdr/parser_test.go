@@ -0,0 +1,116 @@
+package cdr
+
+import (
+	"encoding/csv"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+)
+
+func Test_ParseRecord_fixtures(t *testing.T) {
+	expected := []Record{
+		{
+			HistoryID:        "1001",
+			CallID:           "00000C5E",
+			ReasonTerminated: TerminationReasonSource,
+			TimeReceived:     time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC),
+			TimeAnswered:     time.Date(2024, 1, 2, 10, 0, 20, 0, time.UTC),
+			TimeEnd:          time.Date(2024, 1, 2, 10, 1, 25, 0, time.UTC),
+			Chain:            "Chain: +4312345;1000;Ext.10",
+			Duration:         65 * time.Second,
+			DialNumber:       "1000",
+			FinalType:        structs.TypeExtension,
+			FinalNumber:      "Ext.10",
+			FromType:         structs.TypeExternalLine,
+			FromNumber:       "+4312345",
+			ToDN:             "10",
+			ToType:           structs.TypeExtension,
+			ToNumber:         "Ext.10",
+			FromDispName:     "Max Mustermann",
+			ToDispName:       "Reception",
+			FinalDispName:    "Reception",
+		},
+		{
+			HistoryID:        "1002",
+			CallID:           "00000C5F",
+			ReasonTerminated: TerminationReasonDest,
+			TimeReceived:     time.Date(2024, 1, 2, 11, 0, 0, 0, time.UTC),
+			TimeEnd:          time.Date(2024, 1, 2, 11, 0, 30, 0, time.UTC),
+			Chain:            "Chain: Ext.20;+4398765",
+			DialNumber:       "06641234567",
+			FinalType:        structs.TypeOutboundRule,
+			FinalNumber:      "+4398765",
+			FromDN:           "20",
+			FromType:         structs.TypeExtension,
+			FromNumber:       "Ext.20",
+			ToType:           structs.TypeOutboundRule,
+			ToNumber:         "+4398765",
+			FromDispName:     "Doctor",
+		},
+	}
+
+	for _, version := range Versions() {
+		t.Run(version, func(t *testing.T) {
+			parser, err := ParserForVersion(version)
+			if err != nil {
+				t.Fatalf("failed to get parser: %s", err)
+			}
+
+			f, err := os.Open(filepath.Join("testdata", version+".csv"))
+			if err != nil {
+				t.Fatalf("failed to open fixture: %s", err)
+			}
+			defer f.Close()
+
+			rows, err := csv.NewReader(f).ReadAll()
+			if err != nil {
+				t.Fatalf("failed to read fixture: %s", err)
+			}
+
+			order, ok := DetectFieldOrder(rows[0])
+			if !ok {
+				t.Fatalf("expected header row to be detected: %v", rows[0])
+			}
+
+			if len(rows)-1 != len(expected) {
+				t.Fatalf("unexpected row count %d", len(rows)-1)
+			}
+
+			for idx, row := range rows[1:] {
+				r, err := ParseRecord(parser, row, order, slog.Default())
+				if err != nil {
+					t.Fatalf("row %d: did not expect an error: %s", idx+1, err)
+				}
+
+				if r != expected[idx] {
+					t.Errorf("row %d: unexpected record\n got  %+v\n want %+v", idx+1, r, expected[idx])
+				}
+
+				// the fixtures use the default field order of the version.
+				r, err = ParseRecord(parser, row, nil, slog.Default())
+				if err != nil {
+					t.Fatalf("row %d: did not expect an error using the default field order: %s", idx+1, err)
+				}
+
+				if r != expected[idx] {
+					t.Errorf("row %d: unexpected record using the default field order\n got  %+v\n want %+v", idx+1, r, expected[idx])
+				}
+			}
+		})
+	}
+}
+
+func Test_ParserForVersion(t *testing.T) {
+	p, err := ParserForVersion("")
+	if err != nil || p.Version() != DefaultVersion {
+		t.Errorf("expected the default parser, got %v (%v)", p, err)
+	}
+
+	if _, err := ParserForVersion("v12"); err == nil {
+		t.Error("expected an error for unsupported versions")
+	}
+}
@@ -2,12 +2,16 @@ package cdr
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
-	"math"
+	"net"
 	"strings"
+	"time"
 
 	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
 	pbx3cxv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/pbx3cx/v1"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"google.golang.org/protobuf/proto"
 )
 
@@ -16,9 +20,36 @@ type Processor interface {
 	Process(ctx context.Context, line []string, log *slog.Logger)
 }
 
+// FieldOrderProcessor may be implemented by a Processor that supports
+// changing the CSV field order, e.g. when a connection starts with a header row.
+type FieldOrderProcessor interface {
+	// WithFieldOrder returns a new Processor that uses order instead of the
+	// configured field order.
+	WithFieldOrder(order []Field) Processor
+}
+
 // CallRecord is responsible for persiting an incoming or outgoing call to a customer.
 type CallRecorder interface {
+	// RecordCustomerCall records a new call. If a call-log with one of the
+	// history-ids of the record's legs already exists, it is replaced.
+	// Errors of records that can never be stored must wrap
+	// structs.ErrInvalidCallLog so they are not retried.
 	RecordCustomerCall(context.Context, *structs.CallLog) error
+
+	// CallLogExists reports whether a call-log record for the given call
+	// has already been stored.
+	CallLogExists(ctx context.Context, callID string, historyID string, date time.Time) (bool, error)
+
+	// FindCallLogByCallID returns the call-log record that contains a leg with
+	// historyID or that has been created from call-data-records with the given
+	// call-id around date. If no such record exists, nil is returned.
+	FindCallLogByCallID(ctx context.Context, callID string, historyID string, date time.Time) (*structs.CallLog, error)
+
+	// UpdateCallLog replaces an existing call-log record. If the record has
+	// not been matched yet, the entry created by the 3CX call hook is merged
+	// into it like in RecordCustomerCall. If the record does not exist
+	// anymore, the error wraps structs.ErrInvalidCallLog.
+	UpdateCallLog(ctx context.Context, record *structs.CallLog) error
 }
 
 type UserAgentResolver interface {
@@ -29,86 +60,403 @@ type EventPublisher interface {
 	PublishEvent(proto.Message, bool)
 }
 
+// Archive persists raw call-data-records so they can be replayed later on.
+type Archive interface {
+	SaveCDR(ctx context.Context, row *structs.RawCDR) error
+}
+
+// DeadLetterStore persists call-data-records that failed to be processed.
+type DeadLetterStore interface {
+	SaveDeadLetter(ctx context.Context, dl *structs.DeadLetter) error
+	DeleteDeadLetter(ctx context.Context, id primitive.ObjectID) error
+}
+
+// CallbackLinker marks missed calls as called back when an outbound call to
+// the same number is recorded.
+type CallbackLinker interface {
+	LinkCallbacks(ctx context.Context, outbound *structs.CallLog) error
+}
+
+const (
+	// minDeadLetterRetry is the delay before the first automatic retry of a
+	// transient failure. The delay doubles with each attempt.
+	minDeadLetterRetry = time.Minute
+	// maxDeadLetterRetry is the upper limit for the delay between automatic
+	// retries.
+	maxDeadLetterRetry = 6 * time.Hour
+)
+
 // ProcessorImpl implements the Processor interface using a given
 // CSV field ordering and a call recorder.
 type ProcessorImpl struct {
 	order        []Field
+	version      string
+	peerVersions map[string]string
 	recorder     CallRecorder
 	userResolver UserAgentResolver
 	publisher    EventPublisher
+	archive      Archive
+	deadLetters  DeadLetterStore
+	callbacks    CallbackLinker
 }
 
 // NewProcessor creates and returns a new CDR CSV processor using the provided
-// fieldOrder and the call recorder.
-func NewProcessor(fieldOrder []Field, recorder CallRecorder, userResolver UserAgentResolver, publisher EventPublisher) *ProcessorImpl {
+// fieldOrder and the call recorder. If archive is not nil, each processed row
+// is persisted together with the processing outcome.
+func NewProcessor(fieldOrder []Field, recorder CallRecorder, userResolver UserAgentResolver, publisher EventPublisher, archive Archive) *ProcessorImpl {
 	return &ProcessorImpl{
 		order:        fieldOrder,
 		recorder:     recorder,
 		userResolver: userResolver,
 		publisher:    publisher,
+		archive:      archive,
 	}
 }
 
+// WithFieldOrder implements FieldOrderProcessor.
+func (p *ProcessorImpl) WithFieldOrder(order []Field) Processor {
+	cpy := *p
+	cpy.order = order
+
+	return &cpy
+}
+
+// WithVersions returns a copy of p that parses rows using the CDR format
+// defaultVersion. peerVersions may be used to select a different format
+// version for peers, indexed by their host address.
+func (p *ProcessorImpl) WithVersions(defaultVersion string, peerVersions map[string]string) (*ProcessorImpl, error) {
+	if _, err := ParserForVersion(defaultVersion); err != nil {
+		return nil, err
+	}
+
+	for peer, version := range peerVersions {
+		if _, err := ParserForVersion(version); err != nil {
+			return nil, fmt.Errorf("peer %s: %w", peer, err)
+		}
+	}
+
+	cpy := *p
+	cpy.version = defaultVersion
+	cpy.peerVersions = peerVersions
+
+	return &cpy, nil
+}
+
+// WithCallbacks returns a copy of p that uses linker to mark missed calls as
+// called back when an outbound call is recorded.
+func (p *ProcessorImpl) WithCallbacks(linker CallbackLinker) *ProcessorImpl {
+	cpy := *p
+	cpy.callbacks = linker
+
+	return &cpy
+}
+
+// WithDeadLetters returns a copy of p that stores rows which failed to be
+// processed in store and removes them once they have been processed successfully.
+func (p *ProcessorImpl) WithDeadLetters(store DeadLetterStore) *ProcessorImpl {
+	cpy := *p
+	cpy.deadLetters = store
+
+	return &cpy
+}
+
+// versionFor returns the CDR format version used for rows received from peer.
+func (p *ProcessorImpl) versionFor(peer string) string {
+	host, _, err := net.SplitHostPort(peer)
+	if err != nil {
+		host = peer
+	}
+
+	if v, ok := p.peerVersions[host]; ok {
+		return v
+	}
+
+	if p.version == "" {
+		return DefaultVersion
+	}
+
+	return p.version
+}
+
+// PartitionKey implements Partitioner and returns the call-id of line so all
+// legs of a call are processed in order.
+func (p *ProcessorImpl) PartitionKey(ctx context.Context, line []string) string {
+	order := p.order
+	if order == nil {
+		parser, err := ParserForVersion(p.versionFor(PeerFromContext(ctx)))
+		if err != nil {
+			return ""
+		}
+
+		order = parser.DefaultFieldOrder()
+	}
+
+	for idx, f := range order {
+		if f == FieldCallID && idx < len(line) {
+			return line[idx]
+		}
+	}
+
+	return ""
+}
+
 // Process implements Processor and handles an incoming CDR CSV row.
 func (p *ProcessorImpl) Process(ctx context.Context, line []string, log *slog.Logger) {
-	record, err := CreateRecordFromCSV(line, p.order, log)
+	p.ingest(ctx, line, p.order, "", false, log)
+}
+
+// Ingest processes line like Process but returns the processed row including
+// the outcome. If order is nil, the configured field order is used. If version
+// is empty, the CDR format version configured for the peer is used.
+func (p *ProcessorImpl) Ingest(ctx context.Context, line []string, order []Field, version string, log *slog.Logger) *structs.RawCDR {
+	return p.ingest(ctx, line, order, version, false, log)
+}
+
+// Import processes a historical CDR row, e.g. from a 3CX CDR export. In contrast
+// to Process, rows that have already been stored as a call-log are skipped and
+// reported using structs.CDROutcomeDuplicate. Duplicates are not archived.
+// If version is empty, the configured CDR format version is used.
+func (p *ProcessorImpl) Import(ctx context.Context, line []string, order []Field, version string, log *slog.Logger) *structs.RawCDR {
+	return p.ingest(ctx, line, order, version, true, log)
+}
+
+func (p *ProcessorImpl) ingest(ctx context.Context, line []string, order []Field, version string, skipDuplicates bool, log *slog.Logger) *structs.RawCDR {
+	peer := PeerFromContext(ctx)
+
+	if order == nil {
+		order = p.order
+	}
+
+	if version == "" {
+		version = p.versionFor(peer)
+	}
+
+	// store the field order of the version so rows can be replayed even if
+	// the default version changes.
+	if order == nil {
+		if parser, err := ParserForVersion(version); err == nil {
+			order = parser.DefaultFieldOrder()
+		}
+	}
+
+	row := &structs.RawCDR{
+		Peer:        peer,
+		ReceiveTime: time.Now(),
+		Columns:     line,
+		Fields:      fieldNames(order),
+		Version:     version,
+	}
+
+	p.processRow(ctx, order, row, skipDuplicates, log)
+
+	return row
+}
+
+// Replay processes a previously archived call-data-record again using the
+// field order and CDR format version that were active when the row has been
+// received. The outcome of the replay is stored in the archive.
+func (p *ProcessorImpl) Replay(ctx context.Context, row *structs.RawCDR, log *slog.Logger) error {
+	var order []Field
+	if len(row.Fields) > 0 {
+		order, _ = parseHeader(row.Fields)
+		if order == nil {
+			return fmt.Errorf("invalid field order %v", row.Fields)
+		}
+	}
+
+	log = log.With("cdrId", row.ID.Hex())
+
+	p.processRow(ctx, order, row, false, log)
+
+	if row.Error != "" {
+		return errors.New(row.Error)
+	}
+
+	return nil
+}
+
+func (p *ProcessorImpl) processRow(ctx context.Context, order []Field, row *structs.RawCDR, skipDuplicates bool, log *slog.Logger) {
+	var outcome structs.CDROutcome
+
+	// rows archived before CDR format versions have been introduced
+	// don't have a version and use the v18 format.
+	parser, err := ParserForVersion(row.Version)
 	if err != nil {
-		log.Error("failed to convert call-data-record", "error", err, "data", strings.Join(line, ","))
+		log.Error("failed to get CDR parser", "error", err)
+		outcome = structs.CDROutcomeParseFailed
+	} else {
+		outcome, err = p.process(ctx, parser, order, row.Columns, skipDuplicates, log)
+	}
+
+	row.Outcome = outcome
+	row.Error = ""
+	if err != nil {
+		row.Error = err.Error()
+	}
+	row.Attempts++
+	row.LastProcessed = time.Now()
+
+	if outcome == structs.CDROutcomeDuplicate {
+		return
+	}
+
+	if p.archive != nil {
+		if err := p.archive.SaveCDR(context.Background(), row); err != nil {
+			log.Error("failed to archive call-data-record", "error", err, "data", strings.Join(row.Columns, ","))
+		}
+	}
+
+	if p.deadLetters != nil {
+		p.updateDeadLetter(row, log)
+	}
+}
+
+// updateDeadLetter stores row as a dead letter if processing failed or removes
+// the dead letter after it has been processed successfully.
+func (p *ProcessorImpl) updateDeadLetter(row *structs.RawCDR, log *slog.Logger) {
+	ctx := context.Background()
+
+	if row.Outcome == structs.CDROutcomeSuccess {
+		if row.ID.IsZero() {
+			return
+		}
+
+		if err := p.deadLetters.DeleteDeadLetter(ctx, row.ID); err != nil {
+			log.Error("failed to delete dead letter", "error", err, "id", row.ID.Hex())
+		}
+
 		return
 	}
 
+	// the ID is shared with the archived row, if there's no archive we need
+	// to assign one ourself.
+	if row.ID.IsZero() {
+		row.ID = primitive.NewObjectID()
+	}
+
+	dl := &structs.DeadLetter{
+		ID:  row.ID,
+		CDR: *row,
+		// parsing or converting will fail again unless the row is edited
+		// while storing may succeed later on.
+		Transient: row.Outcome == structs.CDROutcomeRecordFailed,
+	}
+
+	if dl.Transient {
+		delay := maxDeadLetterRetry
+		if row.Attempts < 16 {
+			delay = min(minDeadLetterRetry<<(row.Attempts-1), maxDeadLetterRetry)
+		}
+
+		dl.NextRetry = time.Now().Add(delay)
+	}
+
+	if err := p.deadLetters.SaveDeadLetter(ctx, dl); err != nil {
+		log.Error("failed to store dead letter", "error", err, "data", strings.Join(row.Columns, ","))
+	}
+}
+
+func (p *ProcessorImpl) process(ctx context.Context, parser Parser, order []Field, line []string, skipDuplicates bool, log *slog.Logger) (structs.CDROutcome, error) {
+	record, err := ParseRecord(parser, line, order, log)
+	if err != nil {
+		log.Error("failed to convert call-data-record", "error", err, "data", strings.Join(line, ","))
+		return structs.CDROutcomeParseFailed, err
+	}
+
 	cr, err := p.callLogFromRecord(ctx, record)
 	if err != nil {
 		log.Error("failed to construct call-log-record from CDR", "error", err)
-		return
+		return structs.CDROutcomeConvertFailed, err
 	}
 
-	if err := p.recorder.RecordCustomerCall(context.Background(), &cr); err != nil {
-		log.Error("failed to process call-data-record", "error", err, "data", strings.Join(line, ","))
-		return
+	if skipDuplicates {
+		exists, err := p.recorder.CallLogExists(ctx, cr.CallID, record.HistoryID, cr.Date)
+		if err != nil {
+			log.Error("failed to check for existing call-log record", "error", err)
+			return structs.CDROutcomeRecordFailed, err
+		}
+
+		if exists {
+			return structs.CDROutcomeDuplicate, nil
+		}
+	}
+
+	// check if we already recorded a leg of this call and if, merge the
+	// new leg into the existing call-log.
+	existing, err := p.recorder.FindCallLogByCallID(ctx, cr.CallID, record.HistoryID, cr.Date)
+	if err != nil {
+		log.Error("failed to search for existing call legs", "error", err)
+		return structs.CDROutcomeRecordFailed, err
+	}
+
+	// a re-sent or replayed row updates the call but we don't publish the
+	// call again.
+	resent := existing != nil && existing.HasLeg(record.HistoryID)
+
+	if existing != nil {
+		for _, leg := range cr.Legs {
+			existing.AddLeg(leg)
+		}
+		p.summarizeLegs(ctx, existing)
+
+		cr = *existing
+
+		if err := p.recorder.UpdateCallLog(context.Background(), &cr); err != nil {
+			log.Error("failed to add call leg to call-log", "error", err, "data", strings.Join(line, ","))
+			return recordFailed(err), err
+		}
+	} else {
+		if err := p.recorder.RecordCustomerCall(context.Background(), &cr); err != nil {
+			log.Error("failed to process call-data-record", "error", err, "data", strings.Join(line, ","))
+			return recordFailed(err), err
+		}
+	}
+
+	// failing to link callbacks must not fail the row as the call itself
+	// has been recorded.
+	if p.callbacks != nil {
+		if err := p.callbacks.LinkCallbacks(ctx, &cr); err != nil {
+			log.Error("failed to link callbacks", "error", err, "callId", cr.CallID)
+		}
+	}
+
+	if resent {
+		log.Info("call-data-record has already been recorded", "historyId", record.HistoryID, "callId", cr.CallID)
+
+		return structs.CDROutcomeSuccess, nil
 	}
 
 	p.publisher.PublishEvent(&pbx3cxv1.CallRecordReceived{
 		CallEntry: cr.ToProto(),
 	}, false)
 
+	return structs.CDROutcomeSuccess, nil
+}
+
+// recordFailed returns the outcome of a CDR whose call-log could not be
+// stored. Invalid call-logs fail permanently like conversion errors, all
+// other errors are considered transient and are retried automatically.
+func recordFailed(err error) structs.CDROutcome {
+	if errors.Is(err, structs.ErrInvalidCallLog) {
+		return structs.CDROutcomeConvertFailed
+	}
+
+	return structs.CDROutcomeRecordFailed
 }
 
 func (p *ProcessorImpl) callLogFromRecord(ctx context.Context, r Record) (structs.CallLog, error) {
-	cr := structs.CallLog{}
-
-	cr.DateStr = r.TimeReceived.Format("2006-01-02")
-	cr.Date = r.TimeReceived
-	cr.CallID = r.CallID
-	cr.DurationSeconds = uint64(math.Floor(r.Duration.Seconds()))
-	cr.FromType = r.FromType
-	cr.ToType = r.FinalType
-	cr.Chain = r.Chain
-
-	if r.Inbound() {
-		cr.Caller = r.FromNumber
-		cr.Direction = "Inbound"
-		cr.InboundNumber = r.DialNumber
-		cr.Agent = strings.TrimPrefix(r.FinalNumber, "Ext.")
-
-		if r.Answered() {
-			cr.CallType = "Inbound"
-		} else {
-			cr.CallType = "Missed"
-		}
-	} else {
-		cr.Caller = r.DialNumber
-		cr.Direction = "Outbound"
-		cr.Agent = strings.TrimPrefix(r.FromNumber, "Ext.")
-
-		if r.Answered() {
-			cr.CallType = "Outbound"
-		} else {
-			cr.CallType = "NotAnswered"
-		}
+	// legs are merged by call and history id, rows without them would be
+	// merged into unrelated calls.
+	if r.CallID == "" || r.HistoryID == "" {
+		return structs.CallLog{}, fmt.Errorf("%w: missing call-id or history-id", structs.ErrInvalidCallLog)
+	}
+
+	cr := structs.CallLog{
+		CallID: r.CallID,
 	}
 
-	cr.AgentUserId = p.userResolver.GetUserIdForAgent(ctx, cr.Agent)
+	cr.AddLeg(legFromRecord(r))
+	p.summarizeLegs(ctx, &cr)
 
 	return cr, nil
 }
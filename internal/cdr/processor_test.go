@@ -0,0 +1,129 @@
+package cdr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// failingRecorder fails to store call-logs using err. If existing is set, it
+// is returned as an already recorded leg of the call.
+type failingRecorder struct {
+	err      error
+	existing *structs.CallLog
+}
+
+func (r *failingRecorder) RecordCustomerCall(context.Context, *structs.CallLog) error {
+	return r.err
+}
+
+func (r *failingRecorder) CallLogExists(context.Context, string, string, time.Time) (bool, error) {
+	return false, nil
+}
+
+func (r *failingRecorder) FindCallLogByCallID(context.Context, string, string, time.Time) (*structs.CallLog, error) {
+	if r.existing == nil {
+		return nil, nil
+	}
+
+	cpy := *r.existing
+
+	return &cpy, nil
+}
+
+func (r *failingRecorder) UpdateCallLog(context.Context, *structs.CallLog) error {
+	return r.err
+}
+
+type memoryDeadLetters map[primitive.ObjectID]*structs.DeadLetter
+
+func (m memoryDeadLetters) SaveDeadLetter(_ context.Context, dl *structs.DeadLetter) error {
+	m[dl.ID] = dl
+
+	return nil
+}
+
+func (m memoryDeadLetters) DeleteDeadLetter(_ context.Context, id primitive.ObjectID) error {
+	delete(m, id)
+
+	return nil
+}
+
+func Test_ProcessorImpl_deadLetters(t *testing.T) {
+	order, err := ParseFieldOrder([]string{"historyId", "callId", "time-start", "from-no", "from-type"})
+	if err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+
+	row := []string{"1", "00000C5E", "2024.01.02 10:00:00", "+4312345", "Line"}
+	timeout := errors.New("server selection timeout")
+
+	cases := []struct {
+		Name      string
+		Row       []string
+		Recorder  *failingRecorder
+		Outcome   structs.CDROutcome
+		Transient bool
+	}{
+		{
+			Name:      "transient record failure",
+			Row:       row,
+			Recorder:  &failingRecorder{err: timeout},
+			Outcome:   structs.CDROutcomeRecordFailed,
+			Transient: true,
+		},
+		{
+			Name:     "invalid call-log",
+			Row:      row,
+			Recorder: &failingRecorder{err: fmt.Errorf("%w: invalid caller", structs.ErrInvalidCallLog)},
+			Outcome:  structs.CDROutcomeConvertFailed,
+		},
+		{
+			Name: "deleted call-log",
+			Row:  row,
+			Recorder: &failingRecorder{
+				err:      fmt.Errorf("%w: not found", structs.ErrInvalidCallLog),
+				existing: &structs.CallLog{CallID: "00000C5E"},
+			},
+			Outcome: structs.CDROutcomeConvertFailed,
+		},
+		{
+			Name:     "missing call-id",
+			Row:      []string{"1", "", "2024.01.02 10:00:00", "+4312345", "Line"},
+			Recorder: &failingRecorder{},
+			Outcome:  structs.CDROutcomeConvertFailed,
+		},
+	}
+
+	for _, c := range cases {
+		store := make(memoryDeadLetters)
+		p := NewProcessor(order, c.Recorder, staticResolver{}, nil, nil).WithDeadLetters(store)
+
+		res := p.Ingest(context.Background(), c.Row, nil, "", slog.Default())
+
+		if res.Outcome != c.Outcome {
+			t.Errorf("%s: unexpected outcome %q, expected %q", c.Name, res.Outcome, c.Outcome)
+		}
+
+		dl, ok := store[res.ID]
+		if !ok {
+			t.Errorf("%s: expected a dead letter to be stored", c.Name)
+			continue
+		}
+
+		// the retry worker only picks up transient dead letters.
+		if dl.Transient != c.Transient {
+			t.Errorf("%s: unexpected transient flag %v, expected %v", c.Name, dl.Transient, c.Transient)
+		}
+
+		if dl.NextRetry.IsZero() == c.Transient {
+			t.Errorf("%s: unexpected next retry %s", c.Name, dl.NextRetry)
+		}
+	}
+}
@@ -0,0 +1,243 @@
+package cdr
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+)
+
+// Partitioner may be implemented by a Processor to tell the Queue which rows
+// belong together. Rows with the same partition key are processed in order by
+// the same worker.
+type Partitioner interface {
+	PartitionKey(ctx context.Context, line []string) string
+}
+
+// Ingester may be implemented by a Processor that supports processing rows
+// with a custom field order and CDR format version and reports the result.
+type Ingester interface {
+	Ingest(ctx context.Context, line []string, order []Field, version string, log *slog.Logger) *structs.RawCDR
+}
+
+type queueJob struct {
+	ctx       context.Context
+	line      []string
+	log       *slog.Logger
+	processor Processor
+}
+
+// QueueStats holds statistics about a Queue.
+type QueueStats struct {
+	Depth     int    `json:"depth"`
+	Capacity  int    `json:"capacity"`
+	Workers   int    `json:"workers"`
+	Processed uint64 `json:"processed"`
+}
+
+// Queue is a bounded, in-process queue between the CDR socket readers and a
+// Processor. Rows are processed by a pool of workers. If the queue is full,
+// Process blocks until there's space available so slow processing applies
+// backpressure to the 3CX socket instead of dropping rows.
+type Queue struct {
+	next      Processor
+	capacity  int
+	partition []chan queueJob
+
+	wg        sync.WaitGroup
+	closeOnce sync.Once
+	processed atomic.Uint64
+}
+
+// NewQueue returns a new queue that holds up to size rows and processes them
+// using the given number of workers. Workers are started immediately and run
+// until Close is called.
+func NewQueue(next Processor, size int, workers int) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+
+	perWorker := size / workers
+	if perWorker < 1 {
+		perWorker = 1
+	}
+
+	q := &Queue{
+		next:      next,
+		capacity:  perWorker * workers,
+		partition: make([]chan queueJob, workers),
+	}
+
+	for idx := range q.partition {
+		ch := make(chan queueJob, perWorker)
+		q.partition[idx] = ch
+
+		q.wg.Add(1)
+		go q.worker(ch)
+	}
+
+	return q
+}
+
+func (q *Queue) worker(jobs <-chan queueJob) {
+	defer q.wg.Done()
+
+	for job := range jobs {
+		job.processor.Process(job.ctx, job.line, job.log)
+		q.processed.Add(1)
+	}
+}
+
+// Process implements Processor and enqueues line. It blocks if the queue is full.
+func (q *Queue) Process(ctx context.Context, line []string, log *slog.Logger) {
+	q.enqueue(q.next, ctx, line, log)
+}
+
+// WithFieldOrder implements FieldOrderProcessor. The returned processor shares the
+// queue and the workers with q.
+func (q *Queue) WithFieldOrder(order []Field) Processor {
+	fp, ok := q.next.(FieldOrderProcessor)
+	if !ok {
+		return q
+	}
+
+	return &orderedQueue{
+		q:    q,
+		next: fp.WithFieldOrder(order),
+	}
+}
+
+// Ingest enqueues line like Process and waits until it has been processed
+// using order and version (see ProcessorImpl.Ingest). If ctx is cancelled
+// before, the row is still processed but ctx.Err() is returned.
+func (q *Queue) Ingest(ctx context.Context, line []string, order []Field, version string, log *slog.Logger) (*structs.RawCDR, error) {
+	ig, ok := q.next.(Ingester)
+	if !ok {
+		return nil, fmt.Errorf("processor %T does not support ingestion", q.next)
+	}
+
+	p := &ingestProcessor{
+		next:    ig,
+		order:   order,
+		version: version,
+		done:    make(chan *structs.RawCDR, 1),
+	}
+
+	if pt, ok := q.next.(Partitioner); ok {
+		p.partitioner = pt
+	}
+
+	q.enqueue(p, ctx, line, log)
+
+	select {
+	case row := <-p.done:
+		return row, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (q *Queue) enqueue(p Processor, ctx context.Context, line []string, log *slog.Logger) {
+	idx := 0
+	if pt, ok := p.(Partitioner); ok && len(q.partition) > 1 {
+		h := fnv.New32a()
+		h.Write([]byte(pt.PartitionKey(ctx, line)))
+
+		idx = int(h.Sum32() % uint32(len(q.partition)))
+	}
+
+	// The row must be processed even if ctx is cancelled in the meantime
+	// (e.g. during shutdown) so we must not pass on the cancellation.
+	q.partition[idx] <- queueJob{
+		ctx:       context.WithoutCancel(ctx),
+		line:      line,
+		log:       log,
+		processor: p,
+	}
+}
+
+// Stats returns the current queue statistics.
+func (q *Queue) Stats() QueueStats {
+	depth := 0
+	for _, ch := range q.partition {
+		depth += len(ch)
+	}
+
+	return QueueStats{
+		Depth:     depth,
+		Capacity:  q.capacity,
+		Workers:   len(q.partition),
+		Processed: q.processed.Load(),
+	}
+}
+
+// Close stops accepting new rows and waits until all queued rows have been
+// processed or ctx is cancelled. Process must not be called after Close.
+func (q *Queue) Close(ctx context.Context) error {
+	q.closeOnce.Do(func() {
+		for _, ch := range q.partition {
+			close(ch)
+		}
+	})
+
+	done := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// orderedQueue enqueues rows into a Queue using a processor with a custom
+// field order.
+type orderedQueue struct {
+	q    *Queue
+	next Processor
+}
+
+func (oq *orderedQueue) Process(ctx context.Context, line []string, log *slog.Logger) {
+	oq.q.enqueue(oq.next, ctx, line, log)
+}
+
+// ingestProcessor processes a single row enqueued by Queue.Ingest.
+type ingestProcessor struct {
+	next        Ingester
+	partitioner Partitioner
+	order       []Field
+	version     string
+	done        chan *structs.RawCDR
+}
+
+func (ip *ingestProcessor) Process(ctx context.Context, line []string, log *slog.Logger) {
+	ip.done <- ip.next.Ingest(ctx, line, ip.order, ip.version, log)
+}
+
+// PartitionKey implements Partitioner so the row is processed by the same
+// worker as other rows of the call.
+func (ip *ingestProcessor) PartitionKey(ctx context.Context, line []string) string {
+	if ip.order == nil {
+		if ip.partitioner == nil {
+			return ""
+		}
+
+		return ip.partitioner.PartitionKey(ctx, line)
+	}
+
+	for idx, f := range ip.order {
+		if f == FieldCallID && idx < len(line) {
+			return line[idx]
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,106 @@
+package cdr
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+)
+
+type recordingProcessor struct {
+	sync.Mutex
+	rows map[string][]string
+}
+
+func (p *recordingProcessor) Process(_ context.Context, line []string, _ *slog.Logger) {
+	// give other workers a chance to run
+	time.Sleep(time.Millisecond)
+
+	p.Lock()
+	defer p.Unlock()
+
+	p.rows[line[0]] = append(p.rows[line[0]], line[1])
+}
+
+func (p *recordingProcessor) PartitionKey(_ context.Context, line []string) string {
+	return line[0]
+}
+
+func Test_Queue(t *testing.T) {
+	p := &recordingProcessor{rows: make(map[string][]string)}
+	q := NewQueue(p, 4, 3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	legs := []string{"1", "2", "3", "4", "5"}
+	for _, leg := range legs {
+		for _, call := range []string{"a", "b", "c", "d"} {
+			q.Process(ctx, []string{call, leg}, slog.Default())
+		}
+	}
+
+	// queued rows must still be processed after the context is cancelled
+	cancel()
+
+	if err := q.Close(context.Background()); err != nil {
+		t.Fatalf("failed to close queue: %s", err)
+	}
+
+	if s := q.Stats(); s.Depth != 0 || s.Processed != 20 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+
+	for call, got := range p.rows {
+		if len(got) != len(legs) {
+			t.Fatalf("call %s: expected %d rows, got %v", call, len(legs), got)
+		}
+
+		for idx := range legs {
+			if got[idx] != legs[idx] {
+				t.Errorf("call %s: rows processed out of order: %v", call, got)
+				break
+			}
+		}
+	}
+}
+
+type ingestingProcessor struct {
+	recordingProcessor
+}
+
+func (p *ingestingProcessor) Ingest(ctx context.Context, line []string, order []Field, version string, log *slog.Logger) *structs.RawCDR {
+	p.Process(ctx, line, log)
+
+	return &structs.RawCDR{
+		Columns: line,
+		Version: version,
+		Outcome: structs.CDROutcomeSuccess,
+	}
+}
+
+func Test_Queue_Ingest(t *testing.T) {
+	p := &ingestingProcessor{recordingProcessor{rows: make(map[string][]string)}}
+	q := NewQueue(p, 4, 2)
+
+	q.Process(context.Background(), []string{"a", "1"}, slog.Default())
+
+	row, err := q.Ingest(context.Background(), []string{"a", "2"}, nil, "20", slog.Default())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+
+	if row.Outcome != structs.CDROutcomeSuccess || row.Version != "20" {
+		t.Errorf("unexpected row: %+v", row)
+	}
+
+	if err := q.Close(context.Background()); err != nil {
+		t.Fatalf("failed to close queue: %s", err)
+	}
+
+	if got := p.rows["a"]; len(got) != 2 || got[0] != "1" || got[1] != "2" {
+		t.Errorf("rows processed out of order: %v", got)
+	}
+}
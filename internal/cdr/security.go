@@ -0,0 +1,118 @@
+package cdr
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// ListenerOption configures optional features of a ListeningServer.
+type ListenerOption func(*ListeningServer)
+
+// WithTLS configures the ListeningServer to only accept TLS connections.
+func WithTLS(cfg *tls.Config) ListenerOption {
+	return func(lis *ListeningServer) {
+		lis.tlsConfig = cfg
+	}
+}
+
+// WithAllowedPeers configures the ListeningServer to only accept connections
+// from the given networks. If nets is empty, all peers are allowed.
+func WithAllowedPeers(nets []*net.IPNet) ListenerOption {
+	return func(lis *ListeningServer) {
+		lis.allowedPeers = nets
+	}
+}
+
+// LoadTLSConfig loads the server certificate and key for the CDR listening
+// server. If clientCA is set, peers must present a client certificate signed
+// by one of the certificates in the clientCA file.
+func LoadTLSConfig(certFile, keyFile, clientCA string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load server certificate: %w", err)
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCA != "" {
+		content, err := os.ReadFile(clientCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA: %w", err)
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(content) {
+			return nil, fmt.Errorf("failed to parse client CA %q: no certificates found", clientCA)
+		}
+
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
+
+// ParseAllowedPeers parses a list of CIDR networks or single IP addresses.
+func ParseAllowedPeers(peers []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(peers))
+
+	for _, p := range peers {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid peer address %q", p)
+			}
+
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip = ip.To4()
+				bits = 8 * net.IPv4len
+			}
+
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+
+			continue
+		}
+
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid peer network %q: %w", p, err)
+		}
+
+		nets = append(nets, n)
+	}
+
+	return nets, nil
+}
+
+// peerAllowed reports whether addr is part of the allowed peer networks.
+func (lis *ListeningServer) peerAllowed(addr net.Addr) bool {
+	if len(lis.allowedPeers) == 0 {
+		return true
+	}
+
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return false
+	}
+
+	for _, n := range lis.allowedPeers {
+		if n.Contains(tcpAddr.IP) {
+			return true
+		}
+	}
+
+	return false
+}
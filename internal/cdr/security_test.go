@@ -0,0 +1,34 @@
+package cdr
+
+import (
+	"net"
+	"testing"
+)
+
+func Test_peerAllowed(t *testing.T) {
+	nets, err := ParseAllowedPeers([]string{"10.0.0.0/24", "192.168.1.10", "fd00::/64"})
+	if err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+
+	lis := NewListeningServer(":0", nil, nil, WithAllowedPeers(nets))
+
+	cases := map[string]bool{
+		"10.0.0.5":     true,
+		"10.0.1.5":     false,
+		"192.168.1.10": true,
+		"192.168.1.11": false,
+		"fd00::1":      true,
+		"fd01::1":      false,
+	}
+
+	for ip, expected := range cases {
+		if got := lis.peerAllowed(&net.TCPAddr{IP: net.ParseIP(ip), Port: 1234}); got != expected {
+			t.Errorf("%s: expected %v, got %v", ip, expected, got)
+		}
+	}
+
+	if _, err := ParseAllowedPeers([]string{"not-an-ip"}); err == nil {
+		t.Error("expected an error for invalid peers")
+	}
+}
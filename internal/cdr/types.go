@@ -4,13 +4,20 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"strings"
 	"time"
 
 	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
 )
 
 type Server interface {
+	// Start starts the server in the background. The server stops as soon as
+	// the context is cancelled.
 	Start(context.Context) error
+
+	// Wait blocks until all connections of the server have been closed after
+	// the context passed to Start has been cancelled.
+	Wait()
 }
 
 type TerminationReason string
@@ -46,6 +53,10 @@ const (
 	FieldFromDispName     Field = "from-dispname"
 	FieldToDispName       Field = "to-dispname"
 	FieldFinalDispName    Field = "final-dispname"
+
+	// Fields added by 3CX v20. They are not needed for call-data-records.
+	FieldCdrID       Field = "cdr-id"
+	FieldBillingCost Field = "billing-cost"
 )
 
 var defaultFieldOrder = []Field{
@@ -74,6 +85,139 @@ var defaultFieldOrder = []Field{
 	FieldFinalDispName,
 }
 
+// knownFields holds all fields supported by CreateRecordFromCSV indexed by their
+// lower-case name.
+var knownFields = func() map[string]Field {
+	m := make(map[string]Field, len(v20FieldOrder))
+	for _, f := range append(defaultFieldOrder, v20FieldOrder...) {
+		m[strings.ToLower(string(f))] = f
+	}
+
+	return m
+}()
+
+// ParseField parses name as a CDR field. Field names are matched case-insensitive.
+func ParseField(name string) (Field, error) {
+	f, ok := knownFields[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return "", fmt.Errorf("unknown CDR field %q", name)
+	}
+
+	return f, nil
+}
+
+// ParseFieldOrder parses a list of CDR field names as configured in the 3CX
+// CDR template. If names is empty, nil is returned so the default field order
+// will be used.
+func ParseFieldOrder(names []string) ([]Field, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	order := make([]Field, len(names))
+	for idx, n := range names {
+		f, err := ParseField(n)
+		if err != nil {
+			return nil, err
+		}
+
+		order[idx] = f
+	}
+
+	return order, nil
+}
+
+// DefaultFieldNames returns the names of all fields of the default field order
+// of the given CDR format version. If version is empty or unsupported, the
+// default field order of DefaultVersion is used.
+func DefaultFieldNames(version string) []string {
+	parser, err := ParserForVersion(version)
+	if err != nil {
+		return fieldNames(nil)
+	}
+
+	return fieldNames(parser.DefaultFieldOrder())
+}
+
+// fieldNames returns the names of all fields in order. If order is nil, the
+// default field order is used.
+func fieldNames(order []Field) []string {
+	if order == nil {
+		order = defaultFieldOrder
+	}
+
+	names := make([]string, len(order))
+	for idx, f := range order {
+		names[idx] = string(f)
+	}
+
+	return names
+}
+
+// DetectFieldOrder checks if columns is a header row that declares the CDR
+// field order. A row is considered a header if every column is a known field
+// name or, to support columns added by newer 3CX versions, if at least half of
+// the columns are known field names and all other columns look like field names.
+// Unknown columns are ignored when parsing records.
+func DetectFieldOrder(columns []string) ([]Field, bool) {
+	if len(columns) == 0 {
+		return nil, false
+	}
+
+	order, err := ParseFieldOrder(columns)
+	if err == nil {
+		return order, true
+	}
+
+	order, known := parseHeader(columns)
+	if order == nil || known*2 < len(columns) {
+		return nil, false
+	}
+
+	return order, true
+}
+
+// parseHeader parses the column names of a header row. Unknown columns are
+// kept as is. It returns nil if a column does not look like a field name and
+// the number of known fields otherwise.
+func parseHeader(columns []string) ([]Field, int) {
+	order := make([]Field, len(columns))
+	known := 0
+
+	for idx, c := range columns {
+		f, err := ParseField(c)
+		if err == nil {
+			order[idx] = f
+			known++
+
+			continue
+		}
+
+		name := strings.ToLower(strings.TrimSpace(c))
+		if !isFieldName(name) {
+			return nil, 0
+		}
+
+		order[idx] = Field(name)
+	}
+
+	return order, known
+}
+
+func isFieldName(name string) bool {
+	if name == "" || name[0] < 'a' || name[0] > 'z' {
+		return false
+	}
+
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') && r != '-' && r != '_' {
+			return false
+		}
+	}
+
+	return true
+}
+
 type Record struct {
 	HistoryID string `json:"historyId"`
 	CallID    string `json:"callId"`
@@ -100,22 +244,28 @@ type Record struct {
 	ToDN     string       `json:"to-dn"`
 	ToType   structs.Type `json:"to-type"`
 	ToNumber string       `json:"to-no"`
-}
-
-func parseTime(t string) (time.Time, error) {
-	if t == "" {
-		return time.Time{}, nil
-	}
 
-	return time.ParseInLocation("2006.01.02 15:04:05", t, time.UTC)
+	// Display names of the participants as known by 3CX, e.g. from
+	// the 3CX phonebook.
+	FromDispName  string `json:"from-dispname"`
+	ToDispName    string `json:"to-dispname"`
+	FinalDispName string `json:"final-dispname"`
 }
 
-// CreateRecordFromCSV creates a new Record from it's CSV representation. order defines the CSV field order.
+// CreateRecordFromCSV creates a new Record from it's CSV representation using the
+// 3CX v18 CDR format. order defines the CSV field order.
 // If order is nil, defaultFieldOrder will be used
 func CreateRecordFromCSV(columns []string, order []Field, log *slog.Logger) (Record, error) {
-	// default to the defaultFieldOrder if no order is specified.
+	return ParseRecord(v18Parser{}, columns, order, log)
+}
+
+// ParseRecord creates a new Record from it's CSV representation using parser.
+// order defines the CSV field order. If order is nil, the default field order
+// of the parser will be used.
+func ParseRecord(parser Parser, columns []string, order []Field, log *slog.Logger) (Record, error) {
+	// default to the default field order if no order is specified.
 	if order == nil {
-		order = defaultFieldOrder
+		order = parser.DefaultFieldOrder()
 	}
 
 	// the lenght of the columns and the other must match, otherwise there's likely
@@ -145,28 +295,28 @@ func CreateRecordFromCSV(columns []string, order []Field, log *slog.Logger) (Rec
 			r.ReasonTerminated = TerminationReason(v)
 
 		case FieldTimeStart:
-			t, err := parseTime(v)
+			t, err := parser.ParseTime(v)
 			if err != nil {
 				return r, err
 			}
 			r.TimeReceived = t
 
 		case FieldTimeAnswered:
-			t, err := parseTime(v)
+			t, err := parser.ParseTime(v)
 			if err != nil {
 				return r, err
 			}
 			r.TimeAnswered = t
 
 		case FieldTimeEnd:
-			t, err := parseTime(v)
+			t, err := parser.ParseTime(v)
 			if err != nil {
 				return r, err
 			}
 			r.TimeEnd = t
 
 		case FieldDuration:
-			d, err := parseDuration(v)
+			d, err := parser.ParseDuration(v)
 			if err != nil {
 				return r, err
 			}
@@ -179,23 +329,38 @@ func CreateRecordFromCSV(columns []string, order []Field, log *slog.Logger) (Rec
 			r.DialNumber = v
 
 		case FieldFinalType:
-			r.FinalType = structs.Type(v)
+			r.FinalType = parser.ParseType(v)
 
 		case FieldFinalNumber:
 			r.FinalNumber = v
 
 		case FieldToType:
-			r.ToType = structs.Type(v)
+			r.ToType = parser.ParseType(v)
 
 		case FieldToNumber:
 			r.ToNumber = v
 
 		case FieldFromType:
-			r.FromType = structs.Type(v)
+			r.FromType = parser.ParseType(v)
 
 		case FieldFromNumber:
 			r.FromNumber = v
 
+		case FieldFromDN:
+			r.FromDN = v
+
+		case FieldToDN:
+			r.ToDN = v
+
+		case FieldFromDispName:
+			r.FromDispName = v
+
+		case FieldToDispName:
+			r.ToDispName = v
+
+		case FieldFinalDispName:
+			r.FinalDispName = v
+
 		default:
 			// Field not needed for call-data-records
 		}
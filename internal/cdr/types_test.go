@@ -0,0 +1,53 @@
+package cdr
+
+import (
+	"log/slog"
+	"testing"
+	"time"
+)
+
+func Test_DetectFieldOrder(t *testing.T) {
+	order, ok := DetectFieldOrder([]string{"callId", " TIME-START ", "from-no", "dial-no"})
+	if !ok {
+		t.Fatal("expected header row to be detected")
+	}
+
+	expected := []Field{FieldCallID, FieldTimeStart, FieldFromNumber, FieldDialNumber}
+	if len(order) != len(expected) {
+		t.Fatalf("unexpected field count %d != %d", len(order), len(expected))
+	}
+
+	for idx := range expected {
+		if order[idx] != expected[idx] {
+			t.Errorf("unexpected field at index %d: %s != %s", idx, order[idx], expected[idx])
+		}
+	}
+
+	if _, ok := DetectFieldOrder([]string{"00000C5E", "2024.01.02 10:00:00", "+4312345", "1234"}); ok {
+		t.Error("did not expect a data row to be detected as a header")
+	}
+}
+
+func Test_CreateRecordFromCSV_customOrder(t *testing.T) {
+	order, err := ParseFieldOrder([]string{"dial-no", "callId", "time-start"})
+	if err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+
+	r, err := CreateRecordFromCSV([]string{"1234", "00000C5E", "2024.01.02 10:00:00"}, order, slog.Default())
+	if err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+
+	if r.DialNumber != "1234" || r.CallID != "00000C5E" {
+		t.Errorf("unexpected record %+v", r)
+	}
+
+	if !r.TimeReceived.Equal(time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)) {
+		t.Errorf("unexpected time-start %s", r.TimeReceived)
+	}
+
+	if _, err := ParseFieldOrder([]string{"callId", "not-a-field"}); err == nil {
+		t.Error("expected an error for unknown fields")
+	}
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"context"
+	"sort"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+	pbx3cxv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/pbx3cx/v1"
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+)
+
+// InternalQueues returns all "internal_queue" phone extensions indexed by
+// extension. Calls that ended in an internal queue are reported as missed.
+func (svc *Providers) InternalQueues(ctx context.Context) (map[string]*pbx3cxv1.PhoneExtension, error) {
+	// fetch all known phone extensions
+	extensions, err := svc.Extensions.ListPhoneExtensions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// find any "internal_queue" extensions and create a lookup map by extension
+	internalQueues := make(map[string]*pbx3cxv1.PhoneExtension, len(extensions))
+	for _, e := range extensions {
+		if e.InternalQueue {
+			internalQueues[e.Extension] = e
+		}
+	}
+
+	return internalQueues, nil
+}
+
+// InternalQueueExtensions returns the sorted extensions of all internal queues.
+func (svc *Providers) InternalQueueExtensions(ctx context.Context) ([]string, error) {
+	queues, err := svc.InternalQueues(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, 0, len(queues))
+	for ext := range queues {
+		result = append(result, ext)
+	}
+	sort.Strings(result)
+
+	return result, nil
+}
+
+// LinkCallbacks marks earlier missed calls from the number called by outbound
+// as called back. It does nothing if outbound is not an answered outbound call.
+func (svc *Providers) LinkCallbacks(ctx context.Context, outbound *structs.CallLog) error {
+	if outbound.Direction != "Outbound" || outbound.CallType != "Outbound" {
+		return nil
+	}
+
+	queues, err := svc.InternalQueueExtensions(ctx)
+	if err != nil {
+		return err
+	}
+
+	count, err := svc.CallLogDB.LinkCallback(ctx, outbound, queues)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		log.L(ctx).Info("marked missed calls as called back", "caller", outbound.Caller, "count", count, "agent", outbound.Agent)
+	}
+
+	return nil
+}
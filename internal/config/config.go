@@ -31,8 +31,87 @@ type Config struct {
 	EventsServiceURL           string   `env:"EVENTS_SERVICE_URL" json:"eventsServiceUrl"`
 	NotificationSenderId       string   `env:"NOTIFICATION_SENDER_ID" json:"notificationSenderId"`
 
+	// AdminRoles holds the IDs of roles that are allowed to use administrative
+	// HTTP endpoints (CDR management, retention and data-subject requests).
+	AdminRoles []string `env:"ADMIN_ROLES, default=idm_superuser" json:"adminRoles"`
+
 	CDRMode string `env:"CDR_MODE, default=OFF" json:"cdrMode"` // ACTIVE, PASSIVE, OFF (default)
 	CDRAddr string `env:"CDR_ADDR" json:"cdrAddr"`              // either bind socket (CDR_MODE=ACTIVE) or addr to connect to (CDR_MODE=PASSIVE)
+
+	// CDRFields defines the column order of CDR rows as configured in the 3CX CDR template.
+	// If empty, the default 3CX field order is used. A connection may still override the
+	// field order by sending a header row.
+	CDRFields []string `env:"CDR_FIELDS" json:"cdrFields"`
+
+	// CDRVersion is the 3CX CDR format version (v18 or v20).
+	CDRVersion string `env:"CDR_VERSION, default=v18" json:"cdrVersion"`
+	// CDRPeerVersions may be used to select the CDR format version per peer
+	// address, e.g. while migrating from 3CX v18 to v20.
+	CDRPeerVersions map[string]string `env:"CDR_PEER_VERSIONS" json:"cdrPeerVersions"`
+
+	// CDRTLSCert and CDRTLSKey enable TLS for the CDR listening server (CDR_MODE=ACTIVE).
+	CDRTLSCert string `env:"CDR_TLS_CERT" json:"cdrTlsCert"`
+	CDRTLSKey  string `env:"CDR_TLS_KEY" json:"cdrTlsKey"`
+	// CDRTLSClientCA may be set to require and verify client certificates.
+	CDRTLSClientCA string `env:"CDR_TLS_CLIENT_CA" json:"cdrTlsClientCa"`
+	// CDRAllowedPeers is a list of IP addresses or CIDR networks that are allowed
+	// to connect to the CDR listening server. If empty, all peers are allowed.
+	CDRAllowedPeers []string `env:"CDR_ALLOWED_PEERS" json:"cdrAllowedPeers"`
+
+	// CDRWebhookToken is the secret token required to post call-data-records to
+	// the CDR webhook. The webhook is disabled if empty.
+	CDRWebhookToken string `env:"CDR_WEBHOOK_TOKEN" json:"cdrWebhookToken"`
+
+	// CDRQueueSize is the maximum number of received CDR rows that are buffered
+	// before reading from the CDR socket is paused.
+	CDRQueueSize int `env:"CDR_QUEUE_SIZE, default=1000" json:"cdrQueueSize"`
+	// CDRWorkers is the number of workers that process received CDR rows.
+	CDRWorkers int `env:"CDR_WORKERS, default=4" json:"cdrWorkers"`
+
+	// CallMatchWindowSeconds is the maximum time difference in seconds between
+	// a call-data-record and the entry created by the 3CX call hook for them to
+	// be merged if the entry cannot be matched by call-id.
+	CallMatchWindowSeconds int `env:"CALL_MATCH_WINDOW_SECONDS, default=120" json:"callMatchWindowSeconds"`
+
+	// RetentionAnonymizeAfterDays is the number of days after which caller
+	// numbers and customers are removed from call-log records. Records are
+	// never anonymized if zero. Archived call-data-records and dead letters
+	// cannot be attributed to an inbound number and are deleted after the
+	// shorter period of the default policy.
+	RetentionAnonymizeAfterDays int `env:"RETENTION_ANONYMIZE_AFTER_DAYS" json:"retentionAnonymizeAfterDays"`
+	// RetentionDeleteAfterDays is the number of days after which call-log
+	// records are deleted. Records are never deleted if zero.
+	RetentionDeleteAfterDays int `env:"RETENTION_DELETE_AFTER_DAYS" json:"retentionDeleteAfterDays"`
+	// RetentionPolicies overrides the retention settings for calls to specific
+	// inbound numbers. Only supported in the configuration file. The policies
+	// do not apply to archived call-data-records and dead letters.
+	RetentionPolicies []RetentionPolicy `json:"retentionPolicies"`
+	// RetentionDryRun may be set to true to only log which records would be
+	// anonymized or deleted.
+	RetentionDryRun bool `env:"RETENTION_DRY_RUN" json:"retentionDryRun"`
+}
+
+// RetentionPolicy configures how long call-log records of calls to the given
+// inbound numbers are kept.
+type RetentionPolicy struct {
+	InboundNumbers     []string `json:"inboundNumbers"`
+	AnonymizeAfterDays int      `json:"anonymizeAfterDays"`
+	DeleteAfterDays    int      `json:"deleteAfterDays"`
+}
+
+// RetentionEnabled reports whether any retention setting is configured.
+func (cfg *Config) RetentionEnabled() bool {
+	if cfg.RetentionAnonymizeAfterDays > 0 || cfg.RetentionDeleteAfterDays > 0 {
+		return true
+	}
+
+	for _, p := range cfg.RetentionPolicies {
+		if p.AnonymizeAfterDays > 0 || p.DeleteAfterDays > 0 {
+			return true
+		}
+	}
+
+	return false
 }
 
 func LoadConfig(ctx context.Context, path string) (*Config, error) {
@@ -98,6 +177,25 @@ func LoadConfig(ctx context.Context, path string) (*Config, error) {
 		return nil, fmt.Errorf("missing events-service URL")
 	}
 
+	if cfg.CallMatchWindowSeconds < 0 {
+		return nil, fmt.Errorf("callMatchWindowSeconds must not be negative")
+	}
+
+	// validate retention settings
+	if cfg.RetentionAnonymizeAfterDays < 0 || cfg.RetentionDeleteAfterDays < 0 {
+		return nil, fmt.Errorf("retention days must not be negative")
+	}
+
+	for idx, p := range cfg.RetentionPolicies {
+		if len(p.InboundNumbers) == 0 {
+			return nil, fmt.Errorf("retentionPolicies[%d]: missing inboundNumbers", idx)
+		}
+
+		if p.AnonymizeAfterDays < 0 || p.DeleteAfterDays < 0 {
+			return nil, fmt.Errorf("retentionPolicies[%d]: retention days must not be negative", idx)
+		}
+	}
+
 	// validate CDR settings
 	switch strings.ToLower(cfg.CDRMode) {
 	case "active": // ACTIVE Socket mode in 3cx means they will connect, we can use a default here
@@ -106,6 +204,14 @@ func LoadConfig(ctx context.Context, path string) (*Config, error) {
 			cfg.CDRAddr = ":3031"
 		}
 
+		if (cfg.CDRTLSCert == "") != (cfg.CDRTLSKey == "") {
+			return nil, fmt.Errorf("CDR_TLS_CERT and CDR_TLS_KEY must be set together")
+		}
+
+		if cfg.CDRTLSClientCA != "" && cfg.CDRTLSCert == "" {
+			return nil, fmt.Errorf("CDR_TLS_CLIENT_CA requires CDR_TLS_CERT and CDR_TLS_KEY")
+		}
+
 	case "passive": // PASSIVE Socket mode in 3cx means they are listening so we __need__ an address
 		if cfg.CDRAddr == "" {
 			return nil, fmt.Errorf("missing CDR_ADDR if CDR_MODE != OFF")
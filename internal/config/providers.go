@@ -43,10 +43,14 @@ type Providers struct {
 	Customer customerv1connect.CustomerServiceClient
 	Events   eventsv1connect.EventServiceClient
 
-	CallLogDB       database.Database
-	OverwriteDB     oncalloverwrite.Database
-	MailboxDatabase database.MailboxDatabase
-	Extensions      database.ExtensionDatabase
+	CallLogDB        database.Database
+	OverwriteDB      oncalloverwrite.Database
+	MailboxDatabase  database.MailboxDatabase
+	Extensions       database.ExtensionDatabase
+	CDRArchive       database.CDRDatabase
+	DeadLetters      database.DeadLetterDatabase
+	MissedCallRules  database.MissedCallRuleDatabase
+	DataSubjectAudit database.DataSubjectAuditDatabase
 
 	Config Config
 }
@@ -64,7 +68,7 @@ func NewProviders(ctx context.Context, cfg Config) (*Providers, error) {
 		return nil, fmt.Errorf("failed to ping mongodb: %w", err)
 	}
 
-	callogDB, err := database.New(ctx, cfg.Database, cfg.Country, mongoCli)
+	callogDB, err := database.New(ctx, cfg.Database, cfg.Country, time.Duration(cfg.CallMatchWindowSeconds)*time.Second, mongoCli)
 	if err != nil {
 		return nil, fmt.Errorf("failed to perpare calllog db: %w", err)
 	}
@@ -84,18 +88,42 @@ func NewProviders(ctx context.Context, cfg Config) (*Providers, error) {
 		return nil, fmt.Errorf("failed to create phone-extension database: %w", err)
 	}
 
+	cdrDB, err := database.NewCDRDatabase(ctx, mongoCli.Database(cfg.Database))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare cdr-archive db: %w", err)
+	}
+
+	deadLetterDB, err := database.NewDeadLetterDatabase(ctx, mongoCli.Database(cfg.Database))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare cdr-dead-letters db: %w", err)
+	}
+
+	missedCallRuleDB, err := database.NewMissedCallRuleDatabase(ctx, mongoCli.Database(cfg.Database))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare missed-call-rules db: %w", err)
+	}
+
+	auditDB, err := database.NewDataSubjectAuditDatabase(ctx, mongoCli.Database(cfg.Database))
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare data-subject-audit db: %w", err)
+	}
+
 	p := &Providers{
-		Roster:          rosterv1connect.NewRosterServiceClient(httpClient, cfg.RosterdURL),
-		Users:           idmv1connect.NewUserServiceClient(httpClient, cfg.IdmURL),
-		Notify:          idmv1connect.NewNotifyServiceClient(httpClient, cfg.IdmURL),
-		Roles:           idmv1connect.NewRoleServiceClient(httpClient, cfg.IdmURL),
-		Customer:        customerv1connect.NewCustomerServiceClient(cli.NewInsecureHttp2Client(), cfg.CustomerServiceURL),
-		Events:          eventsv1connect.NewEventServiceClient(cli.NewInsecureHttp2Client(), cfg.EventsServiceURL),
-		Config:          cfg,
-		CallLogDB:       callogDB,
-		OverwriteDB:     overwriteDB,
-		MailboxDatabase: mailboxDB,
-		Extensions:      extDB,
+		Roster:           rosterv1connect.NewRosterServiceClient(httpClient, cfg.RosterdURL),
+		Users:            idmv1connect.NewUserServiceClient(httpClient, cfg.IdmURL),
+		Notify:           idmv1connect.NewNotifyServiceClient(httpClient, cfg.IdmURL),
+		Roles:            idmv1connect.NewRoleServiceClient(httpClient, cfg.IdmURL),
+		Customer:         customerv1connect.NewCustomerServiceClient(cli.NewInsecureHttp2Client(), cfg.CustomerServiceURL),
+		Events:           eventsv1connect.NewEventServiceClient(cli.NewInsecureHttp2Client(), cfg.EventsServiceURL),
+		Config:           cfg,
+		CallLogDB:        callogDB,
+		OverwriteDB:      overwriteDB,
+		MailboxDatabase:  mailboxDB,
+		Extensions:       extDB,
+		CDRArchive:       cdrDB,
+		DeadLetters:      deadLetterDB,
+		MissedCallRules:  missedCallRuleDB,
+		DataSubjectAudit: auditDB,
 	}
 
 	return p, nil
@@ -0,0 +1,107 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/database"
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+)
+
+// ApplyRetention anonymizes and deletes call-log records according to the
+// configured retention policies. Archived call-data-records and dead letters
+// hold the raw caller numbers as well but cannot be attributed to an inbound
+// number, so they are deleted when the shorter period of the default policy
+// expires and kept if the default policy is not configured. If dryRun is
+// set, records are only counted.
+func (svc *Providers) ApplyRetention(ctx context.Context, now time.Time, dryRun bool) (*structs.RetentionReport, error) {
+	report := &structs.RetentionReport{
+		DryRun: dryRun,
+		Time:   now,
+	}
+
+	cfg := svc.Config
+
+	var overridden []string
+
+	rules := make([]database.RetentionRule, 0, len(cfg.RetentionPolicies)+1)
+	for _, p := range cfg.RetentionPolicies {
+		overridden = append(overridden, p.InboundNumbers...)
+
+		rules = append(rules, database.RetentionRule{
+			InboundNumbers:  p.InboundNumbers,
+			AnonymizeBefore: daysBefore(now, p.AnonymizeAfterDays),
+			DeleteBefore:    daysBefore(now, p.DeleteAfterDays),
+		})
+	}
+
+	// the default policy applies to all inbound numbers that don't have their
+	// own policy.
+	rules = append(rules, database.RetentionRule{
+		ExcludeInboundNumbers: overridden,
+		AnonymizeBefore:       daysBefore(now, cfg.RetentionAnonymizeAfterDays),
+		DeleteBefore:          daysBefore(now, cfg.RetentionDeleteAfterDays),
+	})
+
+	for _, rule := range rules {
+		if rule.AnonymizeBefore.IsZero() && rule.DeleteBefore.IsZero() {
+			continue
+		}
+
+		anonymized, deleted, err := svc.CallLogDB.ApplyRetention(ctx, rule, dryRun)
+		if err != nil {
+			return report, err
+		}
+
+		report.Policies = append(report.Policies, structs.RetentionPolicyReport{
+			InboundNumbers:  rule.InboundNumbers,
+			AnonymizeBefore: rule.AnonymizeBefore,
+			DeleteBefore:    rule.DeleteBefore,
+			Anonymized:      anonymized,
+			Deleted:         deleted,
+		})
+	}
+
+	rawDays := cfg.RetentionAnonymizeAfterDays
+	if rawDays <= 0 || (cfg.RetentionDeleteAfterDays > 0 && cfg.RetentionDeleteAfterDays < rawDays) {
+		rawDays = cfg.RetentionDeleteAfterDays
+	}
+
+	if rawDays <= 0 {
+		return report, nil
+	}
+
+	report.RawCDRsBefore = daysBefore(now, rawDays)
+
+	cdrQuery := new(database.CDRQuery).Before(report.RawCDRsBefore)
+	dlQuery := new(database.DeadLetterQuery).CreatedBefore(report.RawCDRsBefore)
+
+	var err error
+	if dryRun {
+		report.RawCDRs, err = svc.CDRArchive.CountCDRs(ctx, cdrQuery)
+		if err == nil {
+			report.DeadLetters, err = svc.DeadLetters.CountDeadLetters(ctx, dlQuery)
+		}
+	} else {
+		report.RawCDRs, err = svc.CDRArchive.DeleteCDRs(ctx, cdrQuery)
+		if err == nil {
+			report.DeadLetters, err = svc.DeadLetters.DeleteDeadLetters(ctx, dlQuery)
+		}
+	}
+
+	if err != nil {
+		return report, fmt.Errorf("failed to apply retention to raw call-data-records: %w", err)
+	}
+
+	return report, nil
+}
+
+// daysBefore returns the time days before now or the zero time if days is zero.
+func daysBefore(now time.Time, days int) time.Time {
+	if days <= 0 {
+		return time.Time{}
+	}
+
+	return now.AddDate(0, 0, -days)
+}
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+func (db *callRecordDatabase) AddCallNote(ctx context.Context, id primitive.ObjectID, note structs.CallNote) error {
+	res, err := db.callRecords.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$push": bson.M{
+			"notes": note,
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to perform update operation: %w", err)
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (db *callRecordDatabase) UpdateCallNote(ctx context.Context, id primitive.ObjectID, noteID primitive.ObjectID, text string) error {
+	res, err := db.callRecords.UpdateOne(ctx, bson.M{"_id": id, "notes._id": noteID}, bson.M{
+		"$set": bson.M{
+			"notes.$.text":      text,
+			"notes.$.updatedAt": time.Now(),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to perform update operation: %w", err)
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (db *callRecordDatabase) DeleteCallNote(ctx context.Context, id primitive.ObjectID, noteID primitive.ObjectID) error {
+	res, err := db.callRecords.UpdateOne(ctx, bson.M{"_id": id, "notes._id": noteID}, bson.M{
+		"$pull": bson.M{
+			"notes": bson.M{"_id": noteID},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to perform update operation: %w", err)
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (db *callRecordDatabase) AddCallTags(ctx context.Context, id primitive.ObjectID, tags []string) ([]string, error) {
+	return db.updateCallTags(ctx, id, bson.M{
+		"$addToSet": bson.M{
+			"tags": bson.M{"$each": tags},
+		},
+	})
+}
+
+func (db *callRecordDatabase) RemoveCallTags(ctx context.Context, id primitive.ObjectID, tags []string) ([]string, error) {
+	return db.updateCallTags(ctx, id, bson.M{
+		"$pull": bson.M{
+			"tags": bson.M{"$in": tags},
+		},
+	})
+}
+
+func (db *callRecordDatabase) updateCallTags(ctx context.Context, id primitive.ObjectID, update bson.M) ([]string, error) {
+	opts := options.FindOneAndUpdate().
+		SetReturnDocument(options.After).
+		SetProjection(bson.M{"tags": 1})
+
+	res := db.callRecords.FindOneAndUpdate(ctx, bson.M{"_id": id}, update, opts)
+	if err := res.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+
+		return nil, fmt.Errorf("failed to perform update operation: %w", err)
+	}
+
+	var record structs.CallLog
+	if err := res.Decode(&record); err != nil {
+		return nil, fmt.Errorf("failed to decode document: %w", err)
+	}
+
+	return record.Tags, nil
+}
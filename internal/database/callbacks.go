@@ -0,0 +1,99 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// openCallbackFilter returns a filter that matches all missed inbound calls
+// that have not been called back yet.
+func openCallbackFilter(internalQueues []string) bson.M {
+	return bson.M{
+		// anonymous callers cannot be called back
+		"caller": bson.M{
+			"$ne": "anonymous",
+		},
+		"direction": "Inbound",
+		"calledBack": bson.M{
+			"$exists": false,
+		},
+		"$expr": bson.M{
+			"$eq": bson.A{
+				callStatusExpression(internalQueues),
+				structs.CallStatusMissed,
+			},
+		},
+	}
+}
+
+func (db *callRecordDatabase) LinkCallback(ctx context.Context, outbound *structs.CallLog, internalQueues []string) (int64, error) {
+	if outbound.Direction != "Outbound" || outbound.CallType != "Outbound" {
+		return 0, nil
+	}
+
+	// there's no way to call back anonymous callers and we cannot tell if
+	// unparseable numbers are the same.
+	switch outbound.NumberQuality {
+	case structs.NumberQualityAnonymous, structs.NumberQualityUnparseable:
+		return 0, nil
+	}
+
+	if outbound.Caller == "" || outbound.ID.IsZero() {
+		return 0, nil
+	}
+
+	filter := openCallbackFilter(internalQueues)
+	filter["caller"] = outbound.Caller
+	filter["date"] = bson.M{
+		"$lt": outbound.Date,
+	}
+
+	res, err := db.callRecords.UpdateMany(ctx, filter, bson.M{
+		"$set": bson.M{
+			"calledBack": structs.Callback{
+				CallID:      outbound.ID,
+				Time:        outbound.Date,
+				Agent:       outbound.Agent,
+				AgentUserId: outbound.AgentUserId,
+			},
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to perform update operation: %w", err)
+	}
+
+	return res.ModifiedCount, nil
+}
+
+func (db *callRecordDatabase) FindOpenCallbacks(ctx context.Context, inboundNumbers []string, since time.Time, internalQueues []string) ([]structs.CallLog, error) {
+	filter := openCallbackFilter(internalQueues)
+
+	if len(inboundNumbers) > 0 {
+		filter["inboundNumber"] = bson.M{
+			"$in": inboundNumbers,
+		}
+	}
+
+	if !since.IsZero() {
+		filter["date"] = bson.M{
+			"$gte": since,
+		}
+	}
+
+	cursor, err := db.callRecords.Find(ctx, filter, options.Find().SetSort(bson.M{"date": -1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform find operation: %w", err)
+	}
+
+	var result []structs.CallLog
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode documents: %w", err)
+	}
+
+	return result, nil
+}
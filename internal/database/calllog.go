@@ -2,7 +2,9 @@ package database
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"time"
 
 	"github.com/hashicorp/go-multierror"
@@ -23,7 +25,8 @@ type Database interface {
 
 	// RecordCustomerCall records a call that has been associated with a customer.
 	// When called, RecordCustomerCall searches for an "unidentified" calllog that
-	// was recorded at the same time and replaces that entry.
+	// has the same call-id or, if there is none, was recorded for the same
+	// caller within the match window and replaces that entry.
 	RecordCustomerCall(ctx context.Context, record *structs.CallLog) error
 
 	// Search searches for all records that match query.
@@ -31,23 +34,114 @@ type Database interface {
 
 	Search2(ctx context.Context, opts ...QueryOption) ([]structs.CallLog, error)
 
+	// StreamSearch streams all records that match query. Callers that stop
+	// reading before the channels are closed must cancel ctx.
 	StreamSearch(ctx context.Context, query *SearchQuery) (<-chan structs.CallLog, <-chan error)
 
+	// SearchPage returns a single page of records that match query. The page
+	// size, the page token and the sort order are taken from query.
+	SearchPage(ctx context.Context, query *SearchQuery) (*SearchResult, error)
+
+	// CallLogExists reports whether a call-log record containing a leg with the
+	// given 3CX history-id, or for the given 3CX call-id recorded at date exists.
+	CallLogExists(ctx context.Context, callID string, historyID string, date time.Time) (bool, error)
+
+	// FindCallLogByCallID returns the call-log record that contains a leg with
+	// the given 3CX history-id or that has been created from call-data-records
+	// with the given 3CX call-id within +/- 12 hours of date.
+	// If no record exists, nil is returned.
+	FindCallLogByCallID(ctx context.Context, callID string, historyID string, date time.Time) (*structs.CallLog, error)
+
+	// GetCallLog returns the call-log record with the given ID.
+	GetCallLog(ctx context.Context, id string) (*structs.CallLog, error)
+
+	// UpdateCallLog replaces an existing call-log record. If the record has
+	// not been matched yet, the entry created by the 3CX call hook is merged
+	// into it like in RecordCustomerCall. If the record does not exist, the
+	// error wraps both ErrNotFound and structs.ErrInvalidCallLog.
+	UpdateCallLog(ctx context.Context, record *structs.CallLog) error
+
 	FindDistinctNumbersWithoutCustomers(ctx context.Context) ([]string, error)
 
 	UpdateUnmatchedNumber(ctx context.Context, number string, customerId string) error
+
+	// NumberQualityReport returns all callers between from and to that are not
+	// valid phone numbers, grouped by the raw caller value. If qualities is
+	// empty, invalid and unparseable callers are reported.
+	NumberQualityReport(ctx context.Context, from, to time.Time, qualities []string) ([]structs.NumberQualityReportEntry, error)
+
+	// CallStatistics aggregates call statistics over all records matching
+	// query. It returns the overall statistics and, if query.GroupBy is set,
+	// the statistics for each group.
+	CallStatistics(ctx context.Context, query StatisticsQuery) (*structs.CallStatistics, []structs.CallStatistics, error)
+
+	// LinkCallback marks all earlier missed inbound calls from the number
+	// called by outbound as called back. Calls that ended in one of the
+	// internalQueues count as missed. It returns the number of updated
+	// records.
+	LinkCallback(ctx context.Context, outbound *structs.CallLog, internalQueues []string) (int64, error)
+
+	// FindOpenCallbacks returns all missed inbound calls since the given time
+	// that have not been called back yet. If inboundNumbers is not empty,
+	// only calls to those numbers are returned.
+	FindOpenCallbacks(ctx context.Context, inboundNumbers []string, since time.Time, internalQueues []string) ([]structs.CallLog, error)
+
+	// ApplyRetention deletes and anonymizes all records selected by rule and
+	// returns the number of affected records. If dryRun is set, records are
+	// only counted.
+	ApplyRetention(ctx context.Context, rule RetentionRule, dryRun bool) (anonymized int64, deleted int64, err error)
+
+	// FindDataSubjectCallLogs returns all records of the customer or the
+	// phone numbers of subject.
+	FindDataSubjectCallLogs(ctx context.Context, subject DataSubject) ([]structs.CallLog, error)
+
+	// FindTimelineCallLogs returns up to limit records of the customer or the
+	// phone numbers of subject, newest first. If before is set, only records
+	// before the entry it points to are returned.
+	FindTimelineCallLogs(ctx context.Context, subject DataSubject, before *PageToken, limit int) ([]structs.CallLog, error)
+
+	// FindCallbacks returns all outbound calls to one of numbers after the
+	// given time, oldest first.
+	FindCallbacks(ctx context.Context, numbers []string, after time.Time) ([]structs.CallLog, error)
+
+	// DeleteCallLogs deletes all records with the given IDs.
+	DeleteCallLogs(ctx context.Context, ids []primitive.ObjectID) (int64, error)
+
+	// AnonymizeCallLogs anonymizes all records with the given IDs.
+	AnonymizeCallLogs(ctx context.Context, ids []primitive.ObjectID) (int64, error)
+
+	// AddCallNote adds note to the record with the given ID.
+	AddCallNote(ctx context.Context, id primitive.ObjectID, note structs.CallNote) error
+
+	// UpdateCallNote replaces the text of a note of the record with the
+	// given ID.
+	UpdateCallNote(ctx context.Context, id primitive.ObjectID, noteID primitive.ObjectID, text string) error
+
+	// DeleteCallNote removes a note from the record with the given ID.
+	DeleteCallNote(ctx context.Context, id primitive.ObjectID, noteID primitive.ObjectID) error
+
+	// AddCallTags adds tags to the record with the given ID and returns the
+	// tags of the record.
+	AddCallTags(ctx context.Context, id primitive.ObjectID, tags []string) ([]string, error)
+
+	// RemoveCallTags removes tags from the record with the given ID and
+	// returns the remaining tags of the record.
+	RemoveCallTags(ctx context.Context, id primitive.ObjectID, tags []string) ([]string, error)
 }
 
 type callRecordDatabase struct {
 	callRecords *mongo.Collection
 	country     string
+	matchWindow time.Duration
 }
 
-// New creates a new client.
-func New(ctx context.Context, dbName, country string, cli *mongo.Client) (Database, error) {
+// New creates a new client. matchWindow is the maximum time difference between
+// a record and an "unidentified" entry that is matched by caller.
+func New(ctx context.Context, dbName, country string, matchWindow time.Duration, cli *mongo.Client) (Database, error) {
 	db := &callRecordDatabase{
 		callRecords: cli.Database(dbName).Collection("callogs"),
 		country:     country,
+		matchWindow: matchWindow,
 	}
 
 	if err := db.setup(ctx); err != nil {
@@ -84,11 +178,55 @@ func (db *callRecordDatabase) setup(ctx context.Context) error {
 			},
 			Options: options.Index().SetSparse(true),
 		},
+		{
+			Keys: bson.D{
+				{Key: "callID", Value: 1},
+			},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys: bson.D{
+				{Key: "tags", Value: 1},
+			},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys: bson.D{
+				{Key: "numberQuality", Value: 1},
+			},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys: bson.D{
+				{Key: "caller", Value: 1},
+				{Key: "direction", Value: 1},
+				{Key: "date", Value: -1},
+			},
+		},
 	})
 	if err != nil {
 		return fmt.Errorf("failed to create indexes: %w", err)
 	}
 
+	// 3CX history-ids are unique so each call-data-record may only be stored
+	// once. Creating the index fails if there are already duplicate records
+	// which need to be cleaned up manually. Don't prevent the service from
+	// starting in that case.
+	if _, err := db.callRecords.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "legs.historyId", Value: 1},
+		},
+		Options: options.Index().
+			SetUnique(true).
+			SetPartialFilterExpression(bson.M{
+				"legs.historyId": bson.M{
+					"$exists": true,
+				},
+			}),
+	}); err != nil {
+		log.L(ctx).Error("failed to create unique history-id index, duplicate call-data-records need to be removed", "error", err)
+	}
+
 	return nil
 }
 
@@ -142,6 +280,146 @@ func (db *callRecordDatabase) CreateUnidentified(ctx context.Context, record *st
 	return nil
 }
 
+func (db *callRecordDatabase) CallLogExists(ctx context.Context, callID string, historyID string, date time.Time) (bool, error) {
+	var or bson.A
+
+	if historyID != "" {
+		or = append(or, bson.M{"legs.historyId": historyID})
+	}
+
+	if callID != "" {
+		or = append(or,
+			bson.M{"callID": callID, "date": date},
+			bson.M{"callID": callID, "legs.timeStart": date},
+		)
+	}
+
+	if len(or) == 0 {
+		return false, nil
+	}
+
+	count, err := db.callRecords.CountDocuments(ctx, bson.M{
+		"$or": or,
+	}, options.Count().SetLimit(1))
+	if err != nil {
+		return false, fmt.Errorf("failed to count documents: %w", err)
+	}
+
+	return count > 0, nil
+}
+
+func (db *callRecordDatabase) FindCallLogByCallID(ctx context.Context, callID string, historyID string, date time.Time) (*structs.CallLog, error) {
+	var or bson.A
+
+	if historyID != "" {
+		or = append(or, bson.M{"legs.historyId": historyID})
+	}
+
+	// 3CX may re-use call-ids (e.g. after a restart) so we only search for calls
+	// that happened around the same time.
+	if callID != "" {
+		or = append(or, bson.M{
+			"callID": callID,
+			"legs.0": bson.M{
+				"$exists": true,
+			},
+			"date": bson.M{
+				"$gte": date.Add(-12 * time.Hour),
+				"$lte": date.Add(12 * time.Hour),
+			},
+		})
+	}
+
+	if len(or) == 0 {
+		return nil, nil
+	}
+
+	res := db.callRecords.FindOne(ctx, bson.M{
+		"$or": or,
+	}, options.FindOne().SetSort(bson.M{"date": -1}))
+
+	if err := res.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to perform find operation: %w", err)
+	}
+
+	var record structs.CallLog
+	if err := res.Decode(&record); err != nil {
+		return nil, fmt.Errorf("failed to decode document: %w", err)
+	}
+
+	return &record, nil
+}
+
+func (db *callRecordDatabase) GetCallLog(ctx context.Context, id string) (*structs.CallLog, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse id: %w", err)
+	}
+
+	res := db.callRecords.FindOne(ctx, bson.M{"_id": oid})
+	if err := res.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+
+		return nil, fmt.Errorf("failed to perform find operation: %w", err)
+	}
+
+	var record structs.CallLog
+	if err := res.Decode(&record); err != nil {
+		return nil, fmt.Errorf("failed to decode document: %w", err)
+	}
+
+	return &record, nil
+}
+
+func (db *callRecordDatabase) UpdateCallLog(ctx context.Context, record *structs.CallLog) error {
+	if err := db.perpareRecord(ctx, record); err != nil {
+		return err
+	}
+
+	// the leg that contains the external caller may be received after other
+	// legs of the call so the entry created by the call hook can only be
+	// matched now.
+	var unidentified *structs.CallLog
+	if record.MatchedBy == "" {
+		existing, matchedBy, err := db.findUnidentified(ctx, record)
+		if err != nil {
+			return err
+		}
+
+		if existing != nil && existing.ID != record.ID {
+			mergeUnidentified(record, existing, matchedBy)
+			unidentified = existing
+		}
+	}
+
+	res, err := db.callRecords.ReplaceOne(ctx, bson.M{"_id": record.ID}, record)
+	if err != nil {
+		return fmt.Errorf("failed to perform replace operation: %w", err)
+	}
+
+	// the record has been deleted in the meantime, e.g. by a data subject
+	// request, retrying would create it again.
+	if res.MatchedCount == 0 {
+		return fmt.Errorf("%w: %w", structs.ErrInvalidCallLog, ErrNotFound)
+	}
+
+	if unidentified != nil {
+		if _, err := db.callRecords.DeleteOne(ctx, bson.M{"_id": unidentified.ID}); err != nil {
+			return fmt.Errorf("failed to delete merged call-log %s: %w", unidentified.ID.Hex(), err)
+		}
+
+		log.L(ctx).Info("merged unidentified calllog customer-record", "matchedBy", record.MatchedBy, "caller", record.Caller, "customerSource", record.CustomerSource, "customerId", record.CustomerID, "id", record.ID.Hex())
+	}
+
+	return nil
+}
+
 func (db *callRecordDatabase) UpdateUnmatchedNumber(ctx context.Context, number string, customerId string) error {
 	res, err := db.callRecords.UpdateMany(ctx, bson.M{
 		"caller": number,
@@ -175,6 +453,15 @@ func (db *callRecordDatabase) FindDistinctNumbersWithoutCustomers(ctx context.Co
 		"customerID": bson.M{
 			"$exists": false,
 		},
+		// there's no point in searching customers for callers that are
+		// not phone numbers.
+		"numberQuality": bson.M{
+			"$ne": structs.NumberQualityUnparseable,
+		},
+		// anonymized records must not be linked to customers again.
+		"anonymizedAt": bson.M{
+			"$exists": false,
+		},
 	})
 
 	if err != nil {
@@ -192,51 +479,227 @@ func (db *callRecordDatabase) FindDistinctNumbersWithoutCustomers(ctx context.Co
 	return result, nil
 }
 
-func (db *callRecordDatabase) RecordCustomerCall(ctx context.Context, record *structs.CallLog) error {
-	if record.ID.IsZero() {
-		record.ID = primitive.NewObjectID()
+func (db *callRecordDatabase) NumberQualityReport(ctx context.Context, from, to time.Time, qualities []string) ([]structs.NumberQualityReportEntry, error) {
+	if len(qualities) == 0 {
+		qualities = []string{
+			structs.NumberQualityInvalid,
+			structs.NumberQualityUnparseable,
+		}
+	}
+
+	match := bson.M{
+		"numberQuality": bson.M{
+			"$in": qualities,
+		},
+	}
+
+	dateFilter := bson.M{}
+	if !from.IsZero() {
+		dateFilter["$gte"] = from
+	}
+	if !to.IsZero() {
+		dateFilter["$lte"] = to
+	}
+	if len(dateFilter) > 0 {
+		match["date"] = dateFilter
+	}
+
+	cursor, err := db.callRecords.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$sort", Value: bson.M{"date": -1}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":           "$rawCaller",
+			"caller":        bson.M{"$first": "$caller"},
+			"numberQuality": bson.M{"$first": "$numberQuality"},
+			"count":         bson.M{"$sum": 1},
+			"firstSeen":     bson.M{"$min": "$date"},
+			"lastSeen":      bson.M{"$max": "$date"},
+			"callIds":       bson.M{"$push": "$_id"},
+		}}},
+		{{Key: "$addFields", Value: bson.M{
+			"callIds": bson.M{"$slice": bson.A{"$callIds", 10}},
+		}}},
+		{{Key: "$sort", Value: bson.D{
+			{Key: "count", Value: -1},
+			{Key: "_id", Value: 1},
+		}}},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform aggregation: %w", err)
+	}
+
+	var result []structs.NumberQualityReportEntry
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode documents: %w", err)
 	}
 
+	return result, nil
+}
+
+func (db *callRecordDatabase) RecordCustomerCall(ctx context.Context, record *structs.CallLog) error {
 	log := log.L(ctx)
 	if err := db.perpareRecord(ctx, record); err != nil {
 		return err
 	}
 
-	// load all records that happened on the same date with the same caller
-	opts := options.Find().SetSort(bson.M{
-		"date": -1,
-	})
-	filter := bson.M{
-		"datestr": record.DateStr,
-		"caller":  record.Caller,
-		"durationSeconds": bson.M{
-			"$exists": false,
-		},
+	existing, matchedBy, err := db.findUnidentified(ctx, record)
+	if err != nil {
+		return err
 	}
 
-	cursor, err := db.callRecords.Find(ctx, filter, opts)
+	if existing != nil {
+		record.ID = existing.ID
+		mergeUnidentified(record, existing, matchedBy)
+
+		result := db.callRecords.FindOneAndReplace(ctx, bson.M{"_id": record.ID}, record)
+		if result.Err() != nil {
+			return fmt.Errorf("failed to find and replace document %s: %w", record.ID, result.Err())
+		}
+
+		log.Info("replaced unidentified calllog customer-record", "matchedBy", matchedBy, "caller", record.Caller, "customerSource", record.CustomerSource, "customerId", record.CustomerID, "record", record)
+	} else if historyIDs := record.HistoryIDs(); len(historyIDs) > 0 {
+		if err := db.upsertByHistoryID(ctx, historyIDs, record); err != nil {
+			return err
+		}
+
+		log.Info("recorded customer-record", "customerSource", record.CustomerSource, "customerId", record.CustomerID, "caller", record.Caller, "id", record.ID.Hex())
+	} else {
+		if record.ID.IsZero() {
+			record.ID = primitive.NewObjectID()
+		}
+
+		res, err := db.callRecords.InsertOne(ctx, record)
+		if err != nil {
+			return fmt.Errorf("failed to insert document: %w", err)
+		}
+
+		if oid, ok := res.InsertedID.(primitive.ObjectID); ok {
+			res.InsertedID = oid
+		}
+
+		log.Info("created new customer-record", "customerSource", record.CustomerSource, "customerId", record.CustomerID, "caller", record.Caller)
+	}
+
+	return nil
+}
+
+// mergeUnidentified copies the values of the entry created by the 3CX call
+// hook that are not part of call-data-records to record.
+func mergeUnidentified(record *structs.CallLog, existing *structs.CallLog, matchedBy string) {
+	record.MatchedBy = matchedBy
+	record.TransferTarget = existing.TransferTarget
+	record.Error = existing.Error
+	record.TransferFrom = existing.TransferFrom
+	record.Notes = append(record.Notes, existing.Notes...)
+	for _, tag := range existing.Tags {
+		if !slices.Contains(record.Tags, tag) {
+			record.Tags = append(record.Tags, tag)
+		}
+	}
+
+	// keep the call-id of the call-data-record, it's required to correlate
+	// further call legs.
+	if record.CallID == "" {
+		record.CallID = existing.CallID
+	}
+
+	if record.InboundNumber == "" {
+		record.InboundNumber = existing.InboundNumber
+	}
+
+	if record.CustomerID == "" {
+		record.CustomerID = existing.CustomerID
+		record.CustomerSource = existing.CustomerSource
+	}
+
+	if record.FromType == "" {
+		record.FromType = existing.FromType
+	}
+	if record.ToType == "" {
+		record.ToType = existing.ToType
+	}
+}
+
+// findUnidentified returns the "unidentified" entry created by the 3CX call
+// hook for record and the strategy that matched it. Entries are matched by
+// call-id first. If there's none, the entry of the same caller that is
+// closest to record within the match window is used. Entries with a
+// different call-id are never matched.
+// If no entry matches, nil is returned.
+func (db *callRecordDatabase) findUnidentified(ctx context.Context, record *structs.CallLog) (*structs.CallLog, string, error) {
+	log := log.L(ctx)
+
+	// entries that have already been merged with a call-data-record must not
+	// be matched again.
+	unidentified := func() bson.M {
+		return bson.M{
+			"durationSeconds": bson.M{"$exists": false},
+			"matchedBy":       bson.M{"$exists": false},
+			"legs.0":          bson.M{"$exists": false},
+		}
+	}
+
+	// 3CX may re-use call-ids (e.g. after a restart) so we only search for calls
+	// that happened around the same time.
+	if record.CallID != "" {
+		filter := unidentified()
+		filter["callID"] = record.CallID
+		filter["date"] = bson.M{
+			"$gte": record.Date.Add(-12 * time.Hour),
+			"$lte": record.Date.Add(12 * time.Hour),
+		}
+
+		res := db.callRecords.FindOne(ctx, filter, options.FindOne().SetSort(bson.M{"date": -1}))
+		if err := res.Err(); err == nil {
+			var existing structs.CallLog
+			if err := res.Decode(&existing); err != nil {
+				return nil, "", fmt.Errorf("failed to decode document: %w", err)
+			}
+
+			return &existing, structs.MatchedByCallID, nil
+		} else if !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, "", fmt.Errorf("failed to perform find operation: %w", err)
+		}
+	}
+
+	if db.matchWindow <= 0 {
+		return nil, "", nil
+	}
+
+	filter := unidentified()
+	filter["caller"] = record.Caller
+	filter["date"] = bson.M{
+		"$gte": record.Date.Add(-db.matchWindow),
+		"$lte": record.Date.Add(db.matchWindow),
+	}
+
+	if record.CallID != "" {
+		filter["callID"] = bson.M{"$in": bson.A{nil, ""}}
+	}
+
+	cursor, err := db.callRecords.Find(ctx, filter)
 	if err != nil {
-		return fmt.Errorf("failed to retrieve documents: %w", err)
+		return nil, "", fmt.Errorf("failed to retrieve documents: %w", err)
 	}
 	defer cursor.Close(ctx)
 
-	// we accept any records that happened +/- 2 minutes
-	lower := record.Date.Add(-2 * time.Minute)
-	upper := record.Date.Add(+2 * time.Minute)
-	var found bool
-	var existing structs.CallLog
+	var (
+		found   *structs.CallLog
+		minDiff time.Duration
+	)
 
 	for cursor.Next(ctx) {
+		var existing structs.CallLog
 		if err := cursor.Decode(&existing); err != nil {
 			log.Error("failed to decode existing calllog record", "error", err)
 
 			continue
 		}
 
-		if lower.Before(existing.Date) && upper.After(existing.Date) {
-			found = true
-
-			break
+		diff := existing.Date.Sub(record.Date).Abs()
+		if found == nil || diff < minDiff {
+			found = &existing
+			minDiff = diff
 		}
 	}
 	// we only log error here and still create the record.
@@ -244,48 +707,50 @@ func (db *callRecordDatabase) RecordCustomerCall(ctx context.Context, record *st
 		log.Error("failed to search for unidentified calllog records", "error", cursor.Err())
 	}
 
-	if found {
-		// copy existing values to the new record
-		record.ID = existing.ID
-		record.TransferTarget = existing.TransferTarget
-		record.Error = existing.Error
-		record.TransferFrom = existing.TransferFrom
-		record.CallID = existing.CallID
+	if found == nil {
+		return nil, "", nil
+	}
 
-		if record.InboundNumber == "" {
-			record.InboundNumber = existing.InboundNumber
-		}
+	return found, structs.MatchedByTimeWindow, nil
+}
 
-		if record.CustomerID == "" {
-			record.CustomerID = existing.CustomerID
-		}
+// upsertByHistoryID replaces the call-log record that contains one of the
+// history-ids or inserts record if there is none. record.ID is updated to the
+// ID of the stored document.
+func (db *callRecordDatabase) upsertByHistoryID(ctx context.Context, historyIDs []string, record *structs.CallLog) error {
+	filter := bson.M{
+		"legs.historyId": bson.M{
+			"$in": historyIDs,
+		},
+	}
 
-		if record.FromType == "" {
-			record.FromType = existing.FromType
-		}
-		if record.ToType == "" {
-			record.ToType = existing.ToType
-		}
+	opts := options.FindOneAndReplace().
+		SetUpsert(true).
+		SetReturnDocument(options.After)
 
-		result := db.callRecords.FindOneAndReplace(ctx, bson.M{"_id": record.ID}, record)
-		if result.Err() != nil {
-			return fmt.Errorf("failed to find and replace document %s: %w", record.ID, result.Err())
-		}
+	// the _id of an existing document cannot be changed.
+	cpy := *record
+	cpy.ID = primitive.NilObjectID
 
-		log.Info("replaced unidentified calllog customer-record", "caller", record.Caller, "customerSource", record.CustomerSource, "customerId", record.CustomerID, "record", record)
-	} else {
-		res, err := db.callRecords.InsertOne(ctx, record)
-		if err != nil {
-			return fmt.Errorf("failed to insert document: %w", err)
-		}
+	res := db.callRecords.FindOneAndReplace(ctx, filter, cpy, opts)
 
-		if oid, ok := res.InsertedID.(primitive.ObjectID); ok {
-			res.InsertedID = oid
-		}
+	// concurrent upserts for the same history-id may fail due to the unique
+	// index. In that case, the document does exist now so simply retry.
+	if mongo.IsDuplicateKeyError(res.Err()) {
+		res = db.callRecords.FindOneAndReplace(ctx, filter, cpy, opts)
+	}
 
-		log.Info("created new customer-record", "customerSource", record.CustomerSource, "customerId", record.CustomerID, "caller", record.Caller)
+	if err := res.Err(); err != nil {
+		return fmt.Errorf("failed to upsert document: %w", err)
 	}
 
+	var stored structs.CallLog
+	if err := res.Decode(&stored); err != nil {
+		return fmt.Errorf("failed to decode document: %w", err)
+	}
+
+	record.ID = stored.ID
+
 	return nil
 }
 
@@ -314,10 +779,14 @@ func (db *callRecordDatabase) StreamSearch(ctx context.Context, query *SearchQue
 	results := make(chan structs.CallLog, 1)
 	errs := make(chan error, 1)
 
-	filter := query.Build()
+	if query == nil {
+		query = new(SearchQuery)
+	}
+
+	filter := query.filter()
 	log.L(ctx).Debug("searching for call-log records", "filter", filter)
 
-	opts := options.Find().SetSort(bson.M{"date": -1})
+	opts := options.Find().SetSort(query.sortOptions())
 	cursor, err := db.callRecords.Find(ctx, filter, opts)
 	if err != nil {
 		errs <- fmt.Errorf("failed to retrieve documents: %w", err)
@@ -332,10 +801,31 @@ func (db *callRecordDatabase) StreamSearch(ctx context.Context, query *SearchQue
 		for cursor.Next(ctx) {
 			var result structs.CallLog
 
+			// the caller may stop reading at any time so we must not block
+			// once ctx is cancelled.
 			if err := cursor.Decode(&result); err != nil {
-				errs <- err
-			} else {
-				results <- result
+				select {
+				case errs <- err:
+				case <-ctx.Done():
+					return
+				}
+
+				continue
+			}
+
+			select {
+			case results <- result:
+			case <-ctx.Done():
+				return
+			}
+		}
+
+		// the cursor stops on network errors and timeouts as well, callers
+		// must not treat that as the end of the result set.
+		if err := cursor.Err(); err != nil {
+			select {
+			case errs <- fmt.Errorf("failed to iterate documents: %w", err):
+			case <-ctx.Done():
 			}
 		}
 	}()
@@ -343,10 +833,49 @@ func (db *callRecordDatabase) StreamSearch(ctx context.Context, query *SearchQue
 	return results, errs
 }
 
+func (db *callRecordDatabase) SearchPage(ctx context.Context, query *SearchQuery) (*SearchResult, error) {
+	if query == nil {
+		query = new(SearchQuery)
+	}
+
+	total, err := db.callRecords.CountDocuments(ctx, query.baseFilter())
+	if err != nil {
+		return nil, fmt.Errorf("failed to count documents: %w", err)
+	}
+
+	filter := query.filter()
+	log.L(ctx).Debug("searching for call-log page", "filter", filter, "pageSize", query.pageSize)
+
+	cursor, err := db.callRecords.Find(ctx, filter, query.findOptions())
+	if err != nil {
+		return nil, fmt.Errorf("failed to retrieve documents: %w", err)
+	}
+
+	result := &SearchResult{
+		Total: total,
+	}
+	if err := cursor.All(ctx, &result.Results); err != nil {
+		return nil, fmt.Errorf("failed to decode documents: %w", err)
+	}
+
+	if query.pageSize > 0 && len(result.Results) > query.pageSize {
+		result.Results = result.Results[:query.pageSize]
+		result.NextPageToken = query.nextPageToken(result.Results[query.pageSize-1])
+	}
+
+	return result, nil
+}
+
 func (db *callRecordDatabase) perpareRecord(ctx context.Context, record *structs.CallLog) error {
+	// records may be prepared multiple times (e.g. when updated), keep the
+	// caller as it has been received from 3CX.
+	if record.RawCaller == "" {
+		record.RawCaller = record.Caller
+	}
+
 	formattedNumber := record.Caller
 
-	if record.Caller != "Anonymous" {
+	if record.Caller != "Anonymous" && record.Caller != "anonymous" {
 		/*
 			var callerType string
 			if record.Direction == "Inbound" {
@@ -359,13 +888,25 @@ func (db *callRecordDatabase) perpareRecord(ctx context.Context, record *structs
 		*/
 		parsed, err := phonenumbers.Parse(record.Caller, db.country)
 		if err != nil {
-			log.L(ctx).Error("failed to parse caller phone number", "caller", record.Caller, "error", err)
-			return err
+			// still store the call using the raw caller value, internal
+			// extensions, short codes and some carrier strings cannot be
+			// parsed as phone numbers.
+			log.L(ctx).Warn("failed to parse caller phone number, storing raw value", "caller", record.Caller, "error", err)
+
+			record.NumberQuality = structs.NumberQualityUnparseable
+		} else {
+			formattedNumber = phonenumbers.Format(parsed, phonenumbers.INTERNATIONAL)
+
+			if phonenumbers.IsValidNumber(parsed) {
+				record.NumberQuality = structs.NumberQualityValid
+			} else {
+				record.NumberQuality = structs.NumberQualityInvalid
+			}
 		}
-		formattedNumber = phonenumbers.Format(parsed, phonenumbers.INTERNATIONAL)
 		//}
 	} else {
 		formattedNumber = "anonymous"
+		record.NumberQuality = structs.NumberQualityAnonymous
 	}
 
 	record.Caller = formattedNumber
@@ -0,0 +1,221 @@
+package database
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+	"github.com/tierklinik-dobersberg/apis/pkg/ql/bsonql"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// callLogValueConverters convert string values of the query language into the
+// types stored in the callogs collection.
+var callLogValueConverters = map[string]func(string) (any, error){
+	"durationSeconds": parseDurationSeconds,
+	"error": func(s string) (any, error) {
+		return strconv.ParseBool(s)
+	},
+	"callType":  parseCallType,
+	"direction": canonicalValue("Inbound", "Outbound"),
+}
+
+// valueSet is returned by value converters if a value is stored using
+// different spellings. convertFilterValues matches all of them.
+type valueSet []any
+
+// parseCallType parses a call type. Not answered calls are stored as either
+// "NotAnswered" or "Notanswered" (see callStatusExpression).
+func parseCallType(s string) (any, error) {
+	v, err := canonicalValue("Inbound", "Outbound", "Missed", "NotAnswered")(s)
+	if err != nil {
+		return nil, err
+	}
+
+	if v == "NotAnswered" {
+		return valueSet{"NotAnswered", "Notanswered"}, nil
+	}
+
+	return v, nil
+}
+
+// parseDurationSeconds parses either a plain number of seconds or a Go
+// duration string like "30s" or "1m30s".
+func parseDurationSeconds(s string) (any, error) {
+	if secs, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return int64(secs), nil
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid duration %q", s)
+	}
+
+	return int64(d / time.Second), nil
+}
+
+// canonicalValue returns a converter that matches values case-insensitive
+// against the allowed values.
+func canonicalValue(allowed ...string) func(string) (any, error) {
+	return func(s string) (any, error) {
+		for _, a := range allowed {
+			if strings.EqualFold(a, s) {
+				return a, nil
+			}
+		}
+
+		return nil, fmt.Errorf("invalid value %q, expected one of %s", s, strings.Join(allowed, ", "))
+	}
+}
+
+// Query restricts the search to records matching query using the
+// query-language syntax also supported for voicemails. See
+// structs.CallLogModel for the supported fields.
+func (q *SearchQuery) Query(query string) error {
+	parser := &bsonql.BSONQL{
+		Schema: structs.CallLogModel,
+	}
+
+	filter, err := parser.Parse(query)
+	if err != nil {
+		return fmt.Errorf("failed to parse query: %w", err)
+	}
+
+	converted, err := convertFilterValues(filter, "")
+	if err != nil {
+		return err
+	}
+
+	q.ql = converted.(bson.M)
+
+	return nil
+}
+
+// baseFilter returns the filter of the query without pagination.
+func (q *SearchQuery) baseFilter() bson.M {
+	filter := q.Build()
+
+	if len(q.ql) == 0 {
+		return filter
+	}
+
+	if len(filter) == 0 {
+		return q.ql
+	}
+
+	return bson.M{
+		"$and": bson.A{
+			filter,
+			q.ql,
+		},
+	}
+}
+
+// convertFilterValues walks a query-language filter and converts all string
+// values of fields that have a converter in callLogValueConverters.
+func convertFilterValues(node any, field string) (any, error) {
+	switch v := node.(type) {
+	case bson.M:
+		// keys may change when value sets are expanded so the result is
+		// stored in a new map.
+		result := make(bson.M, len(v))
+
+		for key, value := range v {
+			child := key
+			if strings.HasPrefix(key, "$") {
+				child = field
+			}
+
+			converted, err := convertFilterValues(value, child)
+			if err != nil {
+				return nil, err
+			}
+
+			key, converted = expandValueSet(key, converted)
+			result[key] = converted
+		}
+
+		return result, nil
+
+	case map[string]any:
+		return convertFilterValues(bson.M(v), field)
+
+	case bson.D:
+		for idx, e := range v {
+			child := e.Key
+			if strings.HasPrefix(e.Key, "$") {
+				child = field
+			}
+
+			converted, err := convertFilterValues(e.Value, child)
+			if err != nil {
+				return nil, err
+			}
+
+			v[idx].Key, v[idx].Value = expandValueSet(e.Key, converted)
+		}
+
+		return v, nil
+
+	case bson.A:
+		result := make(bson.A, 0, len(v))
+
+		for _, e := range v {
+			converted, err := convertFilterValues(e, field)
+			if err != nil {
+				return nil, err
+			}
+
+			// e.g. {"$in": [...]}
+			if set, ok := converted.(valueSet); ok {
+				result = append(result, set...)
+			} else {
+				result = append(result, converted)
+			}
+		}
+
+		return result, nil
+
+	case []any:
+		return convertFilterValues(bson.A(v), field)
+
+	case string:
+		conv, ok := callLogValueConverters[field]
+		if !ok {
+			return v, nil
+		}
+
+		converted, err := conv(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s: %w", field, err)
+		}
+
+		return converted, nil
+
+	default:
+		return v, nil
+	}
+}
+
+// expandValueSet replaces a value set of key with a filter that matches all
+// values of the set.
+func expandValueSet(key string, value any) (string, any) {
+	set, ok := value.(valueSet)
+	if !ok {
+		return key, value
+	}
+
+	switch {
+	case key == "$eq":
+		return "$in", bson.A(set)
+	case key == "$ne":
+		return "$nin", bson.A(set)
+	case !strings.HasPrefix(key, "$"):
+		return key, bson.M{"$in": bson.A(set)}
+	default:
+		// other operators like $gt cannot match multiple values.
+		return key, set[0]
+	}
+}
@@ -0,0 +1,134 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func Test_parseDurationSeconds(t *testing.T) {
+	cases := []struct {
+		I   string
+		E   int64
+		Err bool
+	}{
+		{"0", 0, false},
+		{"90", 90, false},
+		{"30s", 30, false},
+		{"1m30s", 90, false},
+		{"1h", 3600, false},
+		{"1.5s", 1, false},
+		{"", 0, true},
+		{"-1", 0, true},
+		{"abc", 0, true},
+	}
+
+	for _, c := range cases {
+		res, err := parseDurationSeconds(c.I)
+		if c.Err {
+			if err == nil {
+				t.Errorf("%q: expected an error", c.I)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: did not expect an error: %s", c.I, err)
+			continue
+		}
+
+		if res != c.E {
+			t.Errorf("%q: unexpected result %v != %d", c.I, res, c.E)
+		}
+	}
+}
+
+func Test_convertFilterValues(t *testing.T) {
+	notAnswered := bson.A{"NotAnswered", "Notanswered"}
+
+	cases := []struct {
+		Name string
+		I    bson.M
+		E    bson.M
+		Err  bool
+	}{
+		{
+			Name: "fields without converter",
+			I:    bson.M{"caller": "0664"},
+			E:    bson.M{"caller": "0664"},
+		},
+		{
+			Name: "durations",
+			I:    bson.M{"durationSeconds": bson.M{"$gt": "1m"}},
+			E:    bson.M{"durationSeconds": bson.M{"$gt": int64(60)}},
+		},
+		{
+			Name: "booleans",
+			I:    bson.M{"error": "true"},
+			E:    bson.M{"error": true},
+		},
+		{
+			Name: "canonical values",
+			I:    bson.M{"callType": "missed", "direction": bson.M{"$eq": "inbound"}},
+			E:    bson.M{"callType": "Missed", "direction": bson.M{"$eq": "Inbound"}},
+		},
+		{
+			Name: "not answered",
+			I:    bson.M{"callType": "notanswered"},
+			E:    bson.M{"callType": bson.M{"$in": notAnswered}},
+		},
+		{
+			Name: "not answered using $eq",
+			I:    bson.M{"callType": bson.M{"$eq": "NotAnswered"}},
+			E:    bson.M{"callType": bson.M{"$in": notAnswered}},
+		},
+		{
+			Name: "not answered using $ne",
+			I:    bson.M{"callType": bson.M{"$ne": "NotAnswered"}},
+			E:    bson.M{"callType": bson.M{"$nin": notAnswered}},
+		},
+		{
+			Name: "not answered using $in",
+			I:    bson.M{"callType": bson.M{"$in": bson.A{"missed", "notanswered"}}},
+			E:    bson.M{"callType": bson.M{"$in": bson.A{"Missed", "NotAnswered", "Notanswered"}}},
+		},
+		{
+			Name: "nested",
+			I: bson.M{"$or": bson.A{
+				bson.M{"callType": "notanswered"},
+				bson.M{"durationSeconds": bson.M{"$lt": "30"}},
+			}},
+			E: bson.M{"$or": bson.A{
+				bson.M{"callType": bson.M{"$in": notAnswered}},
+				bson.M{"durationSeconds": bson.M{"$lt": int64(30)}},
+			}},
+		},
+		{
+			Name: "invalid value",
+			I:    bson.M{"callType": "unknown"},
+			Err:  true,
+		},
+	}
+
+	for _, c := range cases {
+		res, err := convertFilterValues(c.I, "")
+		if c.Err {
+			if err == nil {
+				t.Errorf("%s: expected an error", c.Name)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: did not expect an error: %s", c.Name, err)
+			continue
+		}
+
+		if !reflect.DeepEqual(res, c.E) {
+			t.Errorf("%s: unexpected result\n got  %v\n want %v", c.Name, res, c.E)
+		}
+	}
+}
@@ -0,0 +1,182 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/dbutils"
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CDRDatabase stores raw call-data-records as received from 3CX.
+type CDRDatabase interface {
+	// SaveCDR inserts row if it does not have an ID yet or replaces the
+	// existing document.
+	SaveCDR(ctx context.Context, row *structs.RawCDR) error
+
+	// GetCDR returns the raw call-data-record with the given ID.
+	GetCDR(ctx context.Context, id string) (*structs.RawCDR, error)
+
+	// FindCDRs returns all raw call-data-records that match query.
+	FindCDRs(ctx context.Context, query *CDRQuery) ([]structs.RawCDR, error)
+
+	// CountCDRs returns the number of raw call-data-records that match query.
+	CountCDRs(ctx context.Context, query *CDRQuery) (int64, error)
+
+	// DeleteCDRs deletes all raw call-data-records that match query and
+	// returns the number of deleted records.
+	DeleteCDRs(ctx context.Context, query *CDRQuery) (int64, error)
+
+	// FindDataSubjectCDRs returns all raw call-data-records that contain one
+	// of numbers as a column, including the original columns of edited
+	// records.
+	FindDataSubjectCDRs(ctx context.Context, numbers []string) ([]structs.RawCDR, error)
+
+	// DeleteCDRsByID deletes all raw call-data-records with the given IDs.
+	DeleteCDRsByID(ctx context.Context, ids []primitive.ObjectID) (int64, error)
+}
+
+// CDRQuery searches for raw call-data-records.
+type CDRQuery struct {
+	dbutils.SimpleQueryBuilder
+}
+
+// ID matches the raw call-data-record with the given ID.
+func (q *CDRQuery) ID(id primitive.ObjectID) *CDRQuery {
+	q.WhereIn("_id", id)
+	return q
+}
+
+// Outcome matches all records with the given processing outcome.
+func (q *CDRQuery) Outcome(outcome structs.CDROutcome) *CDRQuery {
+	q.WhereIn("outcome", outcome)
+	return q
+}
+
+// After matches all records received after d.
+func (q *CDRQuery) After(d time.Time) *CDRQuery {
+	q.Where("receiveTime", "$gt", d)
+	return q
+}
+
+// Before matches all records received before d.
+func (q *CDRQuery) Before(d time.Time) *CDRQuery {
+	q.Where("receiveTime", "$lt", d)
+	return q
+}
+
+type cdrDatabase struct {
+	col *mongo.Collection
+}
+
+// NewCDRDatabase returns a new CDRDatabase that stores raw call-data-records
+// in the cdr-archive collection.
+func NewCDRDatabase(ctx context.Context, db *mongo.Database) (CDRDatabase, error) {
+	cdrDb := &cdrDatabase{
+		col: db.Collection("cdr-archive"),
+	}
+
+	if err := cdrDb.setup(ctx); err != nil {
+		return nil, err
+	}
+
+	return cdrDb, nil
+}
+
+func (db *cdrDatabase) setup(ctx context.Context) error {
+	if _, err := db.col.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "receiveTime", Value: 1},
+			},
+		},
+		{
+			Keys: bson.D{
+				{Key: "outcome", Value: 1},
+			},
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to create indexes on cdr-archive collection: %w", err)
+	}
+
+	return nil
+}
+
+func (db *cdrDatabase) SaveCDR(ctx context.Context, row *structs.RawCDR) error {
+	if row.ID.IsZero() {
+		row.ID = primitive.NewObjectID()
+
+		if _, err := db.col.InsertOne(ctx, row); err != nil {
+			return fmt.Errorf("failed to perform insert operation: %w", err)
+		}
+
+		return nil
+	}
+
+	if _, err := db.col.ReplaceOne(ctx, bson.M{"_id": row.ID}, row, options.Replace().SetUpsert(true)); err != nil {
+		return fmt.Errorf("failed to perform replace operation: %w", err)
+	}
+
+	return nil
+}
+
+func (db *cdrDatabase) GetCDR(ctx context.Context, id string) (*structs.RawCDR, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse id: %w", err)
+	}
+
+	res := db.col.FindOne(ctx, bson.M{"_id": oid})
+	if err := res.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	var row structs.RawCDR
+	if err := res.Decode(&row); err != nil {
+		return nil, fmt.Errorf("failed to decode document: %w", err)
+	}
+
+	return &row, nil
+}
+
+func (db *cdrDatabase) FindCDRs(ctx context.Context, query *CDRQuery) ([]structs.RawCDR, error) {
+	res, err := db.col.Find(ctx, query.Build(), options.Find().SetSort(bson.M{"receiveTime": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform find operation: %w", err)
+	}
+
+	var result []structs.RawCDR
+	if err := res.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode documents: %w", err)
+	}
+
+	return result, nil
+}
+
+func (db *cdrDatabase) CountCDRs(ctx context.Context, query *CDRQuery) (int64, error) {
+	count, err := db.col.CountDocuments(ctx, query.Build())
+	if err != nil {
+		return 0, fmt.Errorf("failed to perform count operation: %w", err)
+	}
+
+	return count, nil
+}
+
+func (db *cdrDatabase) DeleteCDRs(ctx context.Context, query *CDRQuery) (int64, error) {
+	res, err := db.col.DeleteMany(ctx, query.Build())
+	if err != nil {
+		return 0, fmt.Errorf("failed to perform delete operation: %w", err)
+	}
+
+	return res.DeletedCount, nil
+}
@@ -5,7 +5,9 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"strings"
 	"sync"
+	"unicode"
 
 	"github.com/hashicorp/go-multierror"
 	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
@@ -43,15 +45,35 @@ func NewCustomerResolver(db Database, cli customerv1connect.CustomerServiceClien
 }
 
 func (cr *CustomerResolver) Query(ctx context.Context, query *SearchQuery) ([]*pbx3cxv1.CallEntry, []*customerv1.Customer, error) {
-
-	errs := new(multierror.Error)
-
 	// this one cancels as soon as the h2 stream ends
 
 	ctx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
 	resultChan, errChan := cr.db.StreamSearch(ctx, query)
+
+	return cr.resolve(ctx, cancel, resultChan, errChan)
+}
+
+// Resolve resolves the customer records for records that have already been
+// loaded (e.g. using SearchPage). The order of records is kept.
+func (cr *CustomerResolver) Resolve(ctx context.Context, records []structs.CallLog) ([]*pbx3cxv1.CallEntry, []*customerv1.Customer, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	resultChan := make(chan structs.CallLog, len(records))
+	for _, r := range records {
+		resultChan <- r
+	}
+	close(resultChan)
+
+	// a nil error channel is never selected
+	return cr.resolve(ctx, cancel, resultChan, nil)
+}
+
+func (cr *CustomerResolver) resolve(ctx context.Context, cancel context.CancelFunc, resultChan <-chan structs.CallLog, errChan <-chan error) ([]*pbx3cxv1.CallEntry, []*customerv1.Customer, error) {
+	errs := new(multierror.Error)
+
 	stream := cr.cli.SearchCustomerStream(ctx)
 
 	go func() {
@@ -178,11 +200,6 @@ func (cr *CustomerResolver) Query(ctx context.Context, query *SearchQuery) ([]*p
 
 	log.L(ctx).Debug("prepareing search result")
 
-	results := make([]*pbx3cxv1.CallEntry, len(cr.records))
-	for idx, r := range cr.records {
-		results[idx] = r.ToProto()
-	}
-
 	customers := make([]*customerv1.Customer, 0, len(cr.customers))
 	for _, c := range cr.customers {
 		if c != nil {
@@ -190,5 +207,52 @@ func (cr *CustomerResolver) Query(ctx context.Context, query *SearchQuery) ([]*p
 		}
 	}
 
+	phonebook := make(map[string]*customerv1.Customer)
+
+	results := make([]*pbx3cxv1.CallEntry, len(cr.records))
+	for idx, r := range cr.records {
+		results[idx] = r.ToProto()
+
+		// records that are linked to a customer are never changed, even if
+		// the customer could not be found.
+		if r.CustomerID != "" {
+			continue
+		}
+
+		// fallback to the caller name from the 3CX phonebook
+		if c := phonebookCustomer(r); c != nil {
+			results[idx].CustomerId = c.Id
+			results[idx].CustomerSource = PhonebookCustomerSource
+
+			if _, ok := phonebook[c.Id]; !ok {
+				phonebook[c.Id] = c
+				customers = append(customers, c)
+			}
+		}
+	}
+
 	return results, customers, errs.ErrorOrNil()
 }
+
+// PhonebookCustomerSource is used as the customer source for call entries that
+// are not linked to a customer but have a caller name from the 3CX phonebook.
+// The customer ID of such entries is only valid within the customer list of
+// the same response.
+const PhonebookCustomerSource = "3cx-phonebook"
+
+// phonebookCustomer returns a customer record using the 3CX display name of
+// the caller. It returns nil if 3CX does not know the caller by name.
+func phonebookCustomer(r structs.CallLog) *customerv1.Customer {
+	name := strings.TrimSpace(r.CallerName)
+
+	// 3CX uses the number as the display name for unknown callers.
+	if strings.IndexFunc(name, unicode.IsLetter) < 0 || r.Caller == "" || r.Caller == "anonymous" {
+		return nil
+	}
+
+	return &customerv1.Customer{
+		Id:           PhonebookCustomerSource + ":" + r.Caller,
+		LastName:     name,
+		PhoneNumbers: []string{r.Caller},
+	}
+}
@@ -0,0 +1,313 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DataSubject selects all records of a customer or a phone number for
+// data-subject requests. Records match if they belong to the customer or to
+// one of the phone numbers.
+type DataSubject struct {
+	CustomerID string
+	// CustomerRefs holds the internal references of the customer. Call-log
+	// records of customers from other sources store the reference instead of
+	// the customer ID.
+	CustomerRefs []CustomerRef
+	// PhoneNumbers holds the phone number in all formats it may be stored in.
+	PhoneNumbers []string
+}
+
+// CustomerRef is the internal reference of a customer of another source.
+type CustomerRef struct {
+	Source string
+	ID     string
+}
+
+// IsZero reports whether neither a customer nor a phone number is set.
+func (s DataSubject) IsZero() bool {
+	return s.CustomerID == "" && len(s.PhoneNumbers) == 0
+}
+
+func (s DataSubject) filter(customerField string, numberFields ...string) bson.M {
+	var or bson.A
+
+	if s.CustomerID != "" {
+		or = append(or, bson.M{customerField: s.CustomerID})
+	}
+
+	if len(s.PhoneNumbers) > 0 {
+		for _, f := range numberFields {
+			or = append(or, bson.M{
+				f: bson.M{
+					"$in": s.PhoneNumbers,
+				},
+			})
+		}
+	}
+
+	return bson.M{"$or": or}
+}
+
+// callLogFilter returns the filter for call-log records of the subject.
+func (s DataSubject) callLogFilter() bson.M {
+	var or bson.A
+
+	if s.CustomerID != "" {
+		or = append(or, bson.M{
+			"customerID": s.CustomerID,
+			"customerSource": bson.M{
+				"$in": bson.A{nil, ""},
+			},
+		})
+	}
+
+	for _, ref := range s.CustomerRefs {
+		or = append(or, bson.M{
+			"customerID":     ref.ID,
+			"customerSource": ref.Source,
+		})
+	}
+
+	if len(s.PhoneNumbers) > 0 {
+		or = append(or, bson.M{
+			"caller": bson.M{
+				"$in": s.PhoneNumbers,
+			},
+		}, bson.M{
+			"rawCaller": bson.M{
+				"$in": s.PhoneNumbers,
+			},
+		})
+	}
+
+	return bson.M{"$or": or}
+}
+
+// DataSubjectAuditDatabase stores audit records of data-subject requests.
+type DataSubjectAuditDatabase interface {
+	// CreateDataSubjectAudit stores a new audit record.
+	CreateDataSubjectAudit(ctx context.Context, audit *structs.DataSubjectAudit) error
+
+	// ListDataSubjectAudits returns all audit records, newest first.
+	ListDataSubjectAudits(ctx context.Context) ([]structs.DataSubjectAudit, error)
+}
+
+type dataSubjectAuditDatabase struct {
+	col *mongo.Collection
+}
+
+// NewDataSubjectAuditDatabase returns a new DataSubjectAuditDatabase that
+// stores audit records in the data-subject-audit collection.
+func NewDataSubjectAuditDatabase(ctx context.Context, db *mongo.Database) (DataSubjectAuditDatabase, error) {
+	auditDb := &dataSubjectAuditDatabase{
+		col: db.Collection("data-subject-audit"),
+	}
+
+	if _, err := auditDb.col.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "time", Value: -1},
+		},
+	}); err != nil {
+		return nil, fmt.Errorf("failed to create indexes on data-subject-audit collection: %w", err)
+	}
+
+	return auditDb, nil
+}
+
+func (db *dataSubjectAuditDatabase) CreateDataSubjectAudit(ctx context.Context, audit *structs.DataSubjectAudit) error {
+	if audit.ID.IsZero() {
+		audit.ID = primitive.NewObjectID()
+	}
+
+	if _, err := db.col.InsertOne(ctx, audit); err != nil {
+		return fmt.Errorf("failed to perform insert operation: %w", err)
+	}
+
+	return nil
+}
+
+func (db *dataSubjectAuditDatabase) ListDataSubjectAudits(ctx context.Context) ([]structs.DataSubjectAudit, error) {
+	cursor, err := db.col.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"time": -1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform find operation: %w", err)
+	}
+
+	var result []structs.DataSubjectAudit
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode documents: %w", err)
+	}
+
+	return result, nil
+}
+
+func (db *callRecordDatabase) FindDataSubjectCallLogs(ctx context.Context, subject DataSubject) ([]structs.CallLog, error) {
+	cursor, err := db.callRecords.Find(ctx, subject.callLogFilter(), options.Find().SetSort(bson.M{"date": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform find operation: %w", err)
+	}
+
+	var result []structs.CallLog
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode documents: %w", err)
+	}
+
+	return result, nil
+}
+
+func (db *callRecordDatabase) DeleteCallLogs(ctx context.Context, ids []primitive.ObjectID) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	res, err := db.callRecords.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to perform delete operation: %w", err)
+	}
+
+	return res.DeletedCount, nil
+}
+
+func (db *callRecordDatabase) AnonymizeCallLogs(ctx context.Context, ids []primitive.ObjectID) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	return db.anonymize(ctx, bson.M{"_id": bson.M{"$in": ids}})
+}
+
+func (db *mailboxDatabase) FindDataSubjectVoiceMails(ctx context.Context, subject DataSubject) ([]structs.VoiceMail, error) {
+	cursor, err := db.records.Find(ctx, subject.filter("customerId", "caller"), options.Find().SetSort(bson.M{"receiveTime": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform find operation: %w", err)
+	}
+
+	var result []structs.VoiceMail
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode documents: %w", err)
+	}
+
+	return result, nil
+}
+
+func (db *mailboxDatabase) DeleteVoiceMails(ctx context.Context, ids []primitive.ObjectID) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	res, err := db.records.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to perform delete operation: %w", err)
+	}
+
+	if _, err := db.notificationsSent.DeleteMany(ctx, bson.M{"record": bson.M{"$in": ids}}); err != nil {
+		return res.DeletedCount, fmt.Errorf("failed to delete sent notifications: %w", err)
+	}
+
+	return res.DeletedCount, nil
+}
+
+func (db *mailboxDatabase) AnonymizeVoiceMails(ctx context.Context, ids []primitive.ObjectID) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	// the caller number is usually part of the subject and the message as
+	// well so both are removed.
+	res, err := db.records.UpdateMany(ctx, bson.M{"_id": bson.M{"$in": ids}}, bson.M{
+		"$set": bson.M{
+			"subject":      "",
+			"anonymizedAt": time.Now(),
+		},
+		"$unset": bson.M{
+			"caller":     "",
+			"customerId": "",
+			"message":    "",
+			"fileName":   "",
+		},
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to perform update operation: %w", err)
+	}
+
+	return res.ModifiedCount, nil
+}
+
+func (db *cdrDatabase) FindDataSubjectCDRs(ctx context.Context, numbers []string) ([]structs.RawCDR, error) {
+	if len(numbers) == 0 {
+		return nil, nil
+	}
+
+	cursor, err := db.col.Find(ctx, bson.M{
+		"$or": bson.A{
+			bson.M{"columns": bson.M{"$in": numbers}},
+			bson.M{"originalColumns": bson.M{"$in": numbers}},
+		},
+	}, options.Find().SetSort(bson.M{"receiveTime": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform find operation: %w", err)
+	}
+
+	var result []structs.RawCDR
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode documents: %w", err)
+	}
+
+	return result, nil
+}
+
+func (db *cdrDatabase) DeleteCDRsByID(ctx context.Context, ids []primitive.ObjectID) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	res, err := db.col.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to perform delete operation: %w", err)
+	}
+
+	return res.DeletedCount, nil
+}
+
+func (db *deadLetterDatabase) FindDataSubjectDeadLetters(ctx context.Context, numbers []string) ([]structs.DeadLetter, error) {
+	if len(numbers) == 0 {
+		return nil, nil
+	}
+
+	cursor, err := db.col.Find(ctx, bson.M{
+		"$or": bson.A{
+			bson.M{"cdr.columns": bson.M{"$in": numbers}},
+			bson.M{"cdr.originalColumns": bson.M{"$in": numbers}},
+		},
+	}, options.Find().SetSort(bson.M{"createdAt": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform find operation: %w", err)
+	}
+
+	var result []structs.DeadLetter
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode documents: %w", err)
+	}
+
+	return result, nil
+}
+
+func (db *deadLetterDatabase) DeleteDeadLettersByID(ctx context.Context, ids []primitive.ObjectID) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	res, err := db.col.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return 0, fmt.Errorf("failed to perform delete operation: %w", err)
+	}
+
+	return res.DeletedCount, nil
+}
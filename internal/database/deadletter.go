@@ -0,0 +1,241 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/dbutils"
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DeadLetterDatabase stores call-data-records that failed to be processed.
+type DeadLetterDatabase interface {
+	// SaveDeadLetter creates or updates the dead letter for row. Edits made
+	// using UpdateDeadLetter are kept.
+	SaveDeadLetter(ctx context.Context, dl *structs.DeadLetter) error
+
+	// UpdateDeadLetter replaces an existing dead letter.
+	UpdateDeadLetter(ctx context.Context, dl *structs.DeadLetter) error
+
+	// GetDeadLetter returns the dead letter with the given ID.
+	GetDeadLetter(ctx context.Context, id string) (*structs.DeadLetter, error)
+
+	// FindDeadLetters returns all dead letters that match query.
+	FindDeadLetters(ctx context.Context, query *DeadLetterQuery) ([]structs.DeadLetter, error)
+
+	// DeleteDeadLetter deletes the dead letter with the given ID. It's not an
+	// error if the dead letter does not exist.
+	DeleteDeadLetter(ctx context.Context, id primitive.ObjectID) error
+
+	// CountDeadLetters returns the number of dead letters that match query.
+	CountDeadLetters(ctx context.Context, query *DeadLetterQuery) (int64, error)
+
+	// DeleteDeadLetters deletes all dead letters that match query and returns
+	// the number of deleted dead letters.
+	DeleteDeadLetters(ctx context.Context, query *DeadLetterQuery) (int64, error)
+
+	// FindDataSubjectDeadLetters returns all dead letters that contain one of
+	// numbers as a column, including the original columns of edited dead
+	// letters.
+	FindDataSubjectDeadLetters(ctx context.Context, numbers []string) ([]structs.DeadLetter, error)
+
+	// DeleteDeadLettersByID deletes all dead letters with the given IDs.
+	DeleteDeadLettersByID(ctx context.Context, ids []primitive.ObjectID) (int64, error)
+}
+
+// DeadLetterQuery searches for dead letters.
+type DeadLetterQuery struct {
+	dbutils.SimpleQueryBuilder
+}
+
+// ID matches the dead letter with the given ID.
+func (q *DeadLetterQuery) ID(id primitive.ObjectID) *DeadLetterQuery {
+	q.WhereIn("_id", id)
+	return q
+}
+
+// Outcome matches all dead letters with the given processing outcome.
+func (q *DeadLetterQuery) Outcome(outcome structs.CDROutcome) *DeadLetterQuery {
+	q.WhereIn("cdr.outcome", outcome)
+	return q
+}
+
+// Transient matches all dead letters that failed due to a temporary error.
+func (q *DeadLetterQuery) Transient() *DeadLetterQuery {
+	q.Where("transient", "$eq", true)
+	return q
+}
+
+// RetryBefore matches all dead letters that should be retried before t.
+func (q *DeadLetterQuery) RetryBefore(t time.Time) *DeadLetterQuery {
+	q.Where("nextRetry", "$lte", t)
+	return q
+}
+
+// MaxAttempts matches all dead letters that have been processed less than n times.
+func (q *DeadLetterQuery) MaxAttempts(n int) *DeadLetterQuery {
+	q.Where("cdr.attempts", "$lt", n)
+	return q
+}
+
+// CreatedBefore matches all dead letters that failed for the first time before t.
+func (q *DeadLetterQuery) CreatedBefore(t time.Time) *DeadLetterQuery {
+	q.Where("createdAt", "$lt", t)
+	return q
+}
+
+type deadLetterDatabase struct {
+	col *mongo.Collection
+}
+
+// NewDeadLetterDatabase returns a new DeadLetterDatabase that stores failed
+// call-data-records in the cdr-dead-letters collection.
+func NewDeadLetterDatabase(ctx context.Context, db *mongo.Database) (DeadLetterDatabase, error) {
+	dlDb := &deadLetterDatabase{
+		col: db.Collection("cdr-dead-letters"),
+	}
+
+	if err := dlDb.setup(ctx); err != nil {
+		return nil, err
+	}
+
+	return dlDb, nil
+}
+
+func (db *deadLetterDatabase) setup(ctx context.Context) error {
+	if _, err := db.col.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.D{
+				{Key: "transient", Value: 1},
+				{Key: "nextRetry", Value: 1},
+			},
+		},
+		{
+			Keys: bson.D{
+				{Key: "cdr.outcome", Value: 1},
+			},
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to create indexes on cdr-dead-letters collection: %w", err)
+	}
+
+	return nil
+}
+
+func (db *deadLetterDatabase) SaveDeadLetter(ctx context.Context, dl *structs.DeadLetter) error {
+	now := time.Now()
+
+	if dl.ID.IsZero() {
+		dl.ID = dl.CDR.ID
+	}
+
+	if dl.ID.IsZero() {
+		return fmt.Errorf("dead letter without ID")
+	}
+
+	if dl.CreatedAt.IsZero() {
+		dl.CreatedAt = now
+	}
+	dl.UpdatedAt = now
+
+	_, err := db.col.UpdateOne(ctx, bson.M{"_id": dl.ID}, bson.M{
+		"$set": bson.M{
+			"cdr":       dl.CDR,
+			"transient": dl.Transient,
+			"nextRetry": dl.NextRetry,
+			"updatedAt": dl.UpdatedAt,
+		},
+		"$setOnInsert": bson.M{
+			"createdAt": dl.CreatedAt,
+		},
+	}, options.Update().SetUpsert(true))
+	if err != nil {
+		return fmt.Errorf("failed to perform update operation: %w", err)
+	}
+
+	return nil
+}
+
+func (db *deadLetterDatabase) UpdateDeadLetter(ctx context.Context, dl *structs.DeadLetter) error {
+	dl.UpdatedAt = time.Now()
+
+	res, err := db.col.ReplaceOne(ctx, bson.M{"_id": dl.ID}, dl)
+	if err != nil {
+		return fmt.Errorf("failed to perform replace operation: %w", err)
+	}
+
+	if res.MatchedCount == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+func (db *deadLetterDatabase) GetDeadLetter(ctx context.Context, id string) (*structs.DeadLetter, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse id: %w", err)
+	}
+
+	res := db.col.FindOne(ctx, bson.M{"_id": oid})
+	if err := res.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	var dl structs.DeadLetter
+	if err := res.Decode(&dl); err != nil {
+		return nil, fmt.Errorf("failed to decode document: %w", err)
+	}
+
+	return &dl, nil
+}
+
+func (db *deadLetterDatabase) FindDeadLetters(ctx context.Context, query *DeadLetterQuery) ([]structs.DeadLetter, error) {
+	res, err := db.col.Find(ctx, query.Build(), options.Find().SetSort(bson.M{"createdAt": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform find operation: %w", err)
+	}
+
+	var result []structs.DeadLetter
+	if err := res.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode documents: %w", err)
+	}
+
+	return result, nil
+}
+
+func (db *deadLetterDatabase) DeleteDeadLetter(ctx context.Context, id primitive.ObjectID) error {
+	if _, err := db.col.DeleteOne(ctx, bson.M{"_id": id}); err != nil {
+		return fmt.Errorf("failed to perform delete operation: %w", err)
+	}
+
+	return nil
+}
+
+func (db *deadLetterDatabase) CountDeadLetters(ctx context.Context, query *DeadLetterQuery) (int64, error) {
+	count, err := db.col.CountDocuments(ctx, query.Build())
+	if err != nil {
+		return 0, fmt.Errorf("failed to perform count operation: %w", err)
+	}
+
+	return count, nil
+}
+
+func (db *deadLetterDatabase) DeleteDeadLetters(ctx context.Context, query *DeadLetterQuery) (int64, error) {
+	res, err := db.col.DeleteMany(ctx, query.Build())
+	if err != nil {
+		return 0, fmt.Errorf("failed to perform delete operation: %w", err)
+	}
+
+	return res.DeletedCount, nil
+}
@@ -0,0 +1,256 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+	pbx3cxv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/pbx3cx/v1"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MissedCallRuleDatabase stores missed-call notification rules and keeps track
+// of the calls that have already been notified.
+type MissedCallRuleDatabase interface {
+	// SaveMissedCallRule creates a new rule if it does not have an ID yet or
+	// replaces the existing one.
+	SaveMissedCallRule(ctx context.Context, rule *structs.MissedCallRule) error
+
+	// GetMissedCallRule returns the rule with the given ID.
+	GetMissedCallRule(ctx context.Context, id string) (*structs.MissedCallRule, error)
+
+	// ListMissedCallRules returns all rules.
+	ListMissedCallRules(ctx context.Context) ([]structs.MissedCallRule, error)
+
+	// DeleteMissedCallRule deletes the rule with the given ID.
+	DeleteMissedCallRule(ctx context.Context, id string) error
+
+	// FilterNotified returns all call-log IDs of calls for which no
+	// notification has been sent for rule.
+	FilterNotified(ctx context.Context, rule primitive.ObjectID, calls []primitive.ObjectID) ([]primitive.ObjectID, error)
+
+	// MarkNotified records that a notification has been sent for rule and calls.
+	MarkNotified(ctx context.Context, rule primitive.ObjectID, calls []primitive.ObjectID) error
+}
+
+type missedCallRuleDatabase struct {
+	rules *mongo.Collection
+	sent  *mongo.Collection
+}
+
+// missedCallRuleDocument is the stored representation of a rule.
+type missedCallRuleDocument struct {
+	structs.MissedCallRule `bson:",inline"`
+
+	Settings bson.Raw `bson:"settings,omitempty"`
+}
+
+type missedCallSentRecord struct {
+	Rule   primitive.ObjectID `bson:"rule"`
+	Record primitive.ObjectID `bson:"record"`
+	SentAt time.Time          `bson:"sentAt"`
+}
+
+// NewMissedCallRuleDatabase returns a new MissedCallRuleDatabase.
+func NewMissedCallRuleDatabase(ctx context.Context, db *mongo.Database) (MissedCallRuleDatabase, error) {
+	ruleDb := &missedCallRuleDatabase{
+		rules: db.Collection("missed-call-rules"),
+		sent:  db.Collection("missed-call-notifications-sent"),
+	}
+
+	if err := ruleDb.setup(ctx); err != nil {
+		return nil, err
+	}
+
+	return ruleDb, nil
+}
+
+func (db *missedCallRuleDatabase) setup(ctx context.Context) error {
+	if _, err := db.sent.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "rule", Value: 1},
+			{Key: "record", Value: 1},
+		},
+		Options: options.Index().SetUnique(true),
+	}); err != nil {
+		return fmt.Errorf("failed to create indexes on missed-call-notifications-sent collection: %w", err)
+	}
+
+	return nil
+}
+
+func (db *missedCallRuleDatabase) SaveMissedCallRule(ctx context.Context, rule *structs.MissedCallRule) error {
+	if rule.ID.IsZero() {
+		rule.ID = primitive.NewObjectID()
+	}
+
+	if rule.CreatedAt.IsZero() {
+		rule.CreatedAt = time.Now()
+	}
+
+	doc := missedCallRuleDocument{
+		MissedCallRule: *rule,
+	}
+
+	if rule.Settings != nil {
+		settings, err := MessageToBSON("", rule.Settings)
+		if err != nil {
+			return fmt.Errorf("failed to convert notification settings: %w", err)
+		}
+
+		doc.Settings, err = bson.Marshal(settings)
+		if err != nil {
+			return fmt.Errorf("failed to encode notification settings: %w", err)
+		}
+	}
+
+	if _, err := db.rules.ReplaceOne(ctx, bson.M{"_id": rule.ID}, doc, options.Replace().SetUpsert(true)); err != nil {
+		return fmt.Errorf("failed to perform replace operation: %w", err)
+	}
+
+	return nil
+}
+
+func (db *missedCallRuleDatabase) GetMissedCallRule(ctx context.Context, id string) (*structs.MissedCallRule, error) {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse id: %w", err)
+	}
+
+	res := db.rules.FindOne(ctx, bson.M{"_id": oid})
+	if err := res.Err(); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, ErrNotFound
+		}
+
+		return nil, err
+	}
+
+	var doc missedCallRuleDocument
+	if err := res.Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode document: %w", err)
+	}
+
+	return doc.toRule()
+}
+
+func (db *missedCallRuleDatabase) ListMissedCallRules(ctx context.Context) ([]structs.MissedCallRule, error) {
+	cursor, err := db.rules.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"inboundNumber": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform find operation: %w", err)
+	}
+
+	var docs []missedCallRuleDocument
+	if err := cursor.All(ctx, &docs); err != nil {
+		return nil, fmt.Errorf("failed to decode documents: %w", err)
+	}
+
+	result := make([]structs.MissedCallRule, 0, len(docs))
+	for _, d := range docs {
+		rule, err := d.toRule()
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, *rule)
+	}
+
+	return result, nil
+}
+
+func (db *missedCallRuleDatabase) DeleteMissedCallRule(ctx context.Context, id string) error {
+	oid, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return fmt.Errorf("failed to parse id: %w", err)
+	}
+
+	res, err := db.rules.DeleteOne(ctx, bson.M{"_id": oid})
+	if err != nil {
+		return fmt.Errorf("failed to perform delete operation: %w", err)
+	}
+
+	if res.DeletedCount == 0 {
+		return ErrNotFound
+	}
+
+	if _, err := db.sent.DeleteMany(ctx, bson.M{"rule": oid}); err != nil {
+		return fmt.Errorf("failed to delete sent notifications: %w", err)
+	}
+
+	return nil
+}
+
+func (db *missedCallRuleDatabase) FilterNotified(ctx context.Context, rule primitive.ObjectID, calls []primitive.ObjectID) ([]primitive.ObjectID, error) {
+	if len(calls) == 0 {
+		return nil, nil
+	}
+
+	cursor, err := db.sent.Find(ctx, bson.M{
+		"rule": rule,
+		"record": bson.M{
+			"$in": calls,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform find operation: %w", err)
+	}
+
+	var sent []missedCallSentRecord
+	if err := cursor.All(ctx, &sent); err != nil {
+		return nil, fmt.Errorf("failed to decode documents: %w", err)
+	}
+
+	notified := make(map[primitive.ObjectID]struct{}, len(sent))
+	for _, s := range sent {
+		notified[s.Record] = struct{}{}
+	}
+
+	var result []primitive.ObjectID
+	for _, c := range calls {
+		if _, ok := notified[c]; !ok {
+			result = append(result, c)
+		}
+	}
+
+	return result, nil
+}
+
+func (db *missedCallRuleDatabase) MarkNotified(ctx context.Context, rule primitive.ObjectID, calls []primitive.ObjectID) error {
+	if len(calls) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	docs := make([]any, len(calls))
+	for idx, c := range calls {
+		docs[idx] = missedCallSentRecord{
+			Rule:   rule,
+			Record: c,
+			SentAt: now,
+		}
+	}
+
+	if _, err := db.sent.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false)); err != nil && !mongo.IsDuplicateKeyError(err) {
+		return fmt.Errorf("failed to perform insert operation: %w", err)
+	}
+
+	return nil
+}
+
+func (doc missedCallRuleDocument) toRule() (*structs.MissedCallRule, error) {
+	rule := doc.MissedCallRule
+
+	if len(doc.Settings) > 0 {
+		rule.Settings = new(pbx3cxv1.NotificationSettings)
+		if err := BSONToMessage(doc.Settings, rule.Settings, nil); err != nil {
+			return nil, fmt.Errorf("failed to decode notification settings: %w", err)
+		}
+	}
+
+	return &rule, nil
+}
@@ -0,0 +1,221 @@
+package database
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SortField is a field call-log records can be sorted by.
+type SortField string
+
+// Supported sort fields.
+const (
+	SortByDate     SortField = "date"
+	SortByDuration SortField = "duration"
+	SortByCaller   SortField = "caller"
+)
+
+// ParseSortField parses the name of a sort field. An empty name returns
+// SortByDate.
+func ParseSortField(name string) (SortField, error) {
+	switch f := SortField(strings.ToLower(strings.TrimSpace(name))); f {
+	case "":
+		return SortByDate, nil
+	case SortByDate, SortByDuration, SortByCaller:
+		return f, nil
+	default:
+		return "", fmt.Errorf("unsupported sort field %q", name)
+	}
+}
+
+// key returns the document key of the sort field.
+func (f SortField) key() string {
+	switch f {
+	case SortByDuration:
+		return "durationSeconds"
+	case SortByCaller:
+		return "caller"
+	default:
+		return "date"
+	}
+}
+
+// value returns the value of the sort field of record as stored in MongoDB.
+// It returns nil if the field is not set on the document.
+func (f SortField) value(record structs.CallLog) any {
+	switch f {
+	case SortByDuration:
+		if record.DurationSeconds == 0 {
+			return nil
+		}
+		return int64(record.DurationSeconds)
+	case SortByCaller:
+		if record.Caller == "" {
+			return nil
+		}
+		return record.Caller
+	default:
+		if record.Date.IsZero() {
+			return nil
+		}
+		return primitive.NewDateTimeFromTime(record.Date)
+	}
+}
+
+// PageToken points to the last record of a result page. It is used to
+// continue a search after that record. Sort and Ascending hold the sort order
+// of the search, the token is only valid for the same order.
+type PageToken struct {
+	Value     any                `bson:"v"`
+	ID        primitive.ObjectID `bson:"id"`
+	Sort      SortField          `bson:"s,omitempty"`
+	Ascending bool               `bson:"a,omitempty"`
+}
+
+// Check returns an error if the token has been created for a different sort
+// order.
+func (t *PageToken) Check(field SortField, ascending bool) error {
+	if t.Sort != field || t.Ascending != ascending {
+		return fmt.Errorf("invalid page token: the sort order must not be changed between pages")
+	}
+
+	return nil
+}
+
+// ParsePageToken parses a page token as returned by SearchResult.NextPageToken.
+func ParsePageToken(token string) (*PageToken, error) {
+	blob, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid page token: %w", err)
+	}
+
+	var t PageToken
+	if err := bson.Unmarshal(blob, &t); err != nil {
+		return nil, fmt.Errorf("invalid page token: %w", err)
+	}
+
+	return &t, nil
+}
+
+func (t *PageToken) String() string {
+	blob, err := bson.Marshal(t)
+	if err != nil {
+		// cannot happen for the values used in page tokens
+		panic(fmt.Sprintf("failed to encode page token: %s", err))
+	}
+
+	return base64.RawURLEncoding.EncodeToString(blob)
+}
+
+// SearchResult is a single page of call-log records.
+type SearchResult struct {
+	// Results holds the records of the page.
+	Results []structs.CallLog
+	// Total is the number of records matching the query, regardless
+	// of pagination.
+	Total int64
+	// NextPageToken may be used to retrieve the next page. It is empty if
+	// there are no more records.
+	NextPageToken string
+}
+
+// sortOptions returns the sort order of the query. The document ID is used
+// as a tie-breaker so pagination is stable.
+func (q *SearchQuery) sortOptions() bson.D {
+	dir := -1
+	if q.ascending {
+		dir = 1
+	}
+
+	return bson.D{
+		{Key: q.sortField.key(), Value: dir},
+		{Key: "_id", Value: dir},
+	}
+}
+
+// pageFilter returns a filter that matches all records after the record the
+// page token points to. Documents without a value for the sort field are
+// sorted before all other documents by MongoDB.
+func (q *SearchQuery) pageFilter() bson.M {
+	t := q.pageToken
+	key := q.sortField.key()
+
+	cmp := "$lt"
+	if q.ascending {
+		cmp = "$gt"
+	}
+
+	sameValue := bson.M{
+		key:   t.Value,
+		"_id": bson.M{cmp: t.ID},
+	}
+
+	switch {
+	case t.Value == nil && q.ascending:
+		return bson.M{"$or": bson.A{
+			sameValue,
+			bson.M{key: bson.M{"$ne": nil}},
+		}}
+
+	case t.Value == nil:
+		return sameValue
+
+	case q.ascending:
+		return bson.M{"$or": bson.A{
+			bson.M{key: bson.M{"$gt": t.Value}},
+			sameValue,
+		}}
+
+	default:
+		return bson.M{"$or": bson.A{
+			bson.M{key: bson.M{"$lt": t.Value}},
+			sameValue,
+			bson.M{key: nil},
+		}}
+	}
+}
+
+// filter returns the MongoDB filter of the query including the page token.
+func (q *SearchQuery) filter() bson.M {
+	filter := q.baseFilter()
+
+	if q.pageToken == nil {
+		return filter
+	}
+
+	return bson.M{
+		"$and": bson.A{
+			filter,
+			q.pageFilter(),
+		},
+	}
+}
+
+func (q *SearchQuery) findOptions() *options.FindOptions {
+	opts := options.Find().SetSort(q.sortOptions())
+
+	if q.pageSize > 0 {
+		// fetch one more record to know if there's a next page.
+		opts.SetLimit(int64(q.pageSize) + 1)
+	}
+
+	return opts
+}
+
+// nextPageToken returns the page token for the page after record.
+func (q *SearchQuery) nextPageToken(record structs.CallLog) string {
+	t := &PageToken{
+		Value:     q.sortField.value(record),
+		ID:        record.ID,
+		Sort:      q.sortField,
+		Ascending: q.ascending,
+	}
+
+	return t.String()
+}
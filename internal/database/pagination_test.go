@@ -0,0 +1,99 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func Test_SearchQuery_pageFilter(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	cases := []struct {
+		Name      string
+		Field     SortField
+		Ascending bool
+		Value     any
+		E         bson.M
+	}{
+		{
+			Name:  "descending",
+			Field: SortByDuration,
+			Value: int64(30),
+			E: bson.M{"$or": bson.A{
+				bson.M{"durationSeconds": bson.M{"$lt": int64(30)}},
+				bson.M{"durationSeconds": int64(30), "_id": bson.M{"$lt": id}},
+				bson.M{"durationSeconds": nil},
+			}},
+		},
+		{
+			Name:      "ascending",
+			Field:     SortByCaller,
+			Ascending: true,
+			Value:     "+43 1 2345",
+			E: bson.M{"$or": bson.A{
+				bson.M{"caller": bson.M{"$gt": "+43 1 2345"}},
+				bson.M{"caller": "+43 1 2345", "_id": bson.M{"$gt": id}},
+			}},
+		},
+		{
+			Name:  "descending without value",
+			Field: SortByDuration,
+			E:     bson.M{"durationSeconds": nil, "_id": bson.M{"$lt": id}},
+		},
+		{
+			Name:      "ascending without value",
+			Field:     SortByDuration,
+			Ascending: true,
+			E: bson.M{"$or": bson.A{
+				bson.M{"durationSeconds": nil, "_id": bson.M{"$gt": id}},
+				bson.M{"durationSeconds": bson.M{"$ne": nil}},
+			}},
+		},
+	}
+
+	for _, c := range cases {
+		q := new(SearchQuery).
+			SortBy(c.Field, c.Ascending).
+			Paginate(10, &PageToken{Value: c.Value, ID: id, Sort: c.Field, Ascending: c.Ascending})
+
+		if res := q.pageFilter(); !reflect.DeepEqual(res, c.E) {
+			t.Errorf("%s: unexpected result\n got  %v\n want %v", c.Name, res, c.E)
+		}
+	}
+}
+
+func Test_SearchQuery_nextPageToken(t *testing.T) {
+	record := structs.CallLog{
+		ID:              primitive.NewObjectID(),
+		Date:            time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC),
+		DurationSeconds: 30,
+	}
+
+	q := new(SearchQuery).SortBy(SortByDuration, true)
+
+	token, err := ParsePageToken(q.nextPageToken(record))
+	if err != nil {
+		t.Fatalf("did not expect an error: %s", err)
+	}
+
+	if token.ID != record.ID || token.Value != int64(30) {
+		t.Errorf("unexpected token %+v", token)
+	}
+
+	if err := token.Check(SortByDuration, true); err != nil {
+		t.Errorf("did not expect an error: %s", err)
+	}
+
+	if err := token.Check(SortByDuration, false); err == nil {
+		t.Error("expected an error for a different direction")
+	}
+
+	if err := token.Check(SortByDate, true); err == nil {
+		t.Error("expected an error for a different sort field")
+	}
+}
@@ -0,0 +1,134 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// RetentionRule selects call-log records for anonymization and deletion.
+type RetentionRule struct {
+	// InboundNumbers limits the rule to calls to the given inbound numbers.
+	InboundNumbers []string
+	// ExcludeInboundNumbers excludes calls to the given inbound numbers.
+	ExcludeInboundNumbers []string
+	// AnonymizeBefore anonymizes all records before the given date. Records
+	// are not anonymized if zero.
+	AnonymizeBefore time.Time
+	// DeleteBefore deletes all records before the given date. Records are not
+	// deleted if zero.
+	DeleteBefore time.Time
+}
+
+func (rule RetentionRule) filter(before time.Time) bson.M {
+	filter := bson.M{
+		"date": bson.M{
+			"$lt": before,
+		},
+	}
+
+	inboundNumber := bson.M{}
+	if len(rule.InboundNumbers) > 0 {
+		inboundNumber["$in"] = rule.InboundNumbers
+	}
+	if len(rule.ExcludeInboundNumbers) > 0 {
+		inboundNumber["$nin"] = rule.ExcludeInboundNumbers
+	}
+	if len(inboundNumber) > 0 {
+		filter["inboundNumber"] = inboundNumber
+	}
+
+	return filter
+}
+
+func (db *callRecordDatabase) ApplyRetention(ctx context.Context, rule RetentionRule, dryRun bool) (anonymized int64, deleted int64, err error) {
+	// records are deleted first so we don't anonymize records that are going
+	// to be deleted anyway.
+	if !rule.DeleteBefore.IsZero() {
+		filter := rule.filter(rule.DeleteBefore)
+
+		if dryRun {
+			deleted, err = db.callRecords.CountDocuments(ctx, filter)
+			if err != nil {
+				return 0, 0, fmt.Errorf("failed to count records for deletion: %w", err)
+			}
+		} else {
+			res, err := db.callRecords.DeleteMany(ctx, filter)
+			if err != nil {
+				return 0, 0, fmt.Errorf("failed to perform delete operation: %w", err)
+			}
+
+			deleted = res.DeletedCount
+		}
+	}
+
+	if rule.AnonymizeBefore.IsZero() {
+		return 0, deleted, nil
+	}
+
+	filter := rule.filter(rule.AnonymizeBefore)
+	filter["anonymizedAt"] = bson.M{
+		"$exists": false,
+	}
+
+	// in dry-run mode, records that would have been deleted above still
+	// exist and must not be counted twice.
+	if dryRun && !rule.DeleteBefore.IsZero() {
+		filter["date"] = bson.M{
+			"$gte": rule.DeleteBefore,
+			"$lt":  rule.AnonymizeBefore,
+		}
+	}
+
+	if dryRun {
+		anonymized, err = db.callRecords.CountDocuments(ctx, filter)
+		if err != nil {
+			return 0, deleted, fmt.Errorf("failed to count records for anonymization: %w", err)
+		}
+
+		return anonymized, deleted, nil
+	}
+
+	anonymized, err = db.anonymize(ctx, filter)
+
+	return anonymized, deleted, err
+}
+
+// anonymize anonymizes all records that match filter and returns the number
+// of anonymized records.
+func (db *callRecordDatabase) anonymize(ctx context.Context, filter bson.M) (int64, error) {
+	cursor, err := db.callRecords.Find(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("failed to perform find operation: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var (
+		now   = time.Now()
+		count int64
+	)
+
+	for cursor.Next(ctx) {
+		var record structs.CallLog
+		if err := cursor.Decode(&record); err != nil {
+			return count, fmt.Errorf("failed to decode document: %w", err)
+		}
+
+		record.Anonymize(now)
+
+		if _, err := db.callRecords.ReplaceOne(ctx, bson.M{"_id": record.ID}, record); err != nil {
+			return count, fmt.Errorf("failed to anonymize record %s: %w", record.ID.Hex(), err)
+		}
+
+		count++
+	}
+
+	if err := cursor.Err(); err != nil {
+		return count, fmt.Errorf("failed to iterate records: %w", err)
+	}
+
+	return count, nil
+}
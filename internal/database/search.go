@@ -5,12 +5,38 @@ import (
 
 	"github.com/nyaruka/phonenumbers"
 	"github.com/tierklinik-dobersberg/3cx-support/internal/dbutils"
+	"go.mongodb.org/mongo-driver/bson"
 )
 
 // SearchQuery searches for calllog records that match the specified
 // query.
 type SearchQuery struct {
 	dbutils.SimpleQueryBuilder
+
+	sortField SortField
+	ascending bool
+	pageSize  int
+	pageToken *PageToken
+
+	// ql holds the filter parsed by Query.
+	ql bson.M
+}
+
+// SortBy sorts the matching records by field. Records are sorted by date in
+// descending order by default.
+func (q *SearchQuery) SortBy(field SortField, ascending bool) *SearchQuery {
+	q.sortField = field
+	q.ascending = ascending
+	return q
+}
+
+// Paginate limits the number of records returned by SearchPage to size. If
+// token is set, the search continues after the record the token points to.
+// The sort order must not be changed between pages, see PageToken.Check.
+func (q *SearchQuery) Paginate(size int, token *PageToken) *SearchQuery {
+	q.pageSize = size
+	q.pageToken = token
+	return q
 }
 
 // AtDate searches for all calllog records that happened at
@@ -75,6 +101,13 @@ func (q *SearchQuery) Customer(id string) *SearchQuery {
 	return q
 }
 
+// Tag matches all records that have been tagged with tag. If called multiple
+// times, records with any of the tags are matched.
+func (q *SearchQuery) Tag(tag string) *SearchQuery {
+	q.WhereIn("tags", tag)
+	return q
+}
+
 // TransferTarget matches the transfer target of the +call.
 func (q *SearchQuery) TransferTarget(t string) *SearchQuery {
 	q.WhereIn("transferTarget", t)
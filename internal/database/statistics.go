@@ -0,0 +1,313 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// StatisticsGroupBy defines how call statistics are grouped.
+type StatisticsGroupBy string
+
+// Supported statistic groupings. An empty StatisticsGroupBy only returns the
+// overall statistics.
+const (
+	GroupByNone           StatisticsGroupBy = ""
+	GroupByHour           StatisticsGroupBy = "hour"
+	GroupByDay            StatisticsGroupBy = "day"
+	GroupByInboundNumber  StatisticsGroupBy = "inboundNumber"
+	GroupByQueueExtension StatisticsGroupBy = "queueExtension"
+	GroupByAgent          StatisticsGroupBy = "agent"
+)
+
+// ParseStatisticsGroupBy parses the name of a statistics grouping.
+func ParseStatisticsGroupBy(name string) (StatisticsGroupBy, error) {
+	switch g := StatisticsGroupBy(name); g {
+	case GroupByNone, GroupByHour, GroupByDay, GroupByInboundNumber, GroupByQueueExtension, GroupByAgent:
+		return g, nil
+	default:
+		return "", fmt.Errorf("unsupported grouping %q", name)
+	}
+}
+
+// StatisticsQuery configures the aggregation of call statistics.
+type StatisticsQuery struct {
+	// From and To limit the time range of the statistics. Zero values are
+	// ignored.
+	From time.Time
+	To   time.Time
+
+	GroupBy StatisticsGroupBy
+
+	// Location is used to group by hour and day.
+	Location *time.Location
+
+	// InternalQueues holds the extensions of all internal queues. Like in the
+	// call-log API, calls that ended in an internal queue count as missed.
+	InternalQueues []string
+
+	// Percentiles holds the duration percentiles (0-100) to calculate.
+	Percentiles []float64
+}
+
+// statisticsGroup is the result of the aggregation for a single group.
+type statisticsGroup struct {
+	Key         string          `bson:"_id"`
+	Total       int             `bson:"total"`
+	Inbound     int             `bson:"inbound"`
+	Outbound    int             `bson:"outbound"`
+	Missed      int             `bson:"missed"`
+	NotAnswered int             `bson:"notAnswered"`
+	Durations   []durationCount `bson:"durations"`
+}
+
+// durationCount is the number of answered calls with the same duration.
+// Durations are aggregated as a histogram so the size of a group depends on
+// the number of distinct durations instead of the number of calls.
+type durationCount struct {
+	Seconds int64 `bson:"d"`
+	Count   int64 `bson:"n"`
+}
+
+func (q StatisticsQuery) groupKey() any {
+	tz := "UTC"
+	if q.Location != nil {
+		tz = q.Location.String()
+	}
+
+	switch q.GroupBy {
+	case GroupByHour:
+		return bson.M{"$dateToString": bson.M{"date": "$date", "format": "%Y-%m-%dT%H:00", "timezone": tz}}
+	case GroupByDay:
+		return bson.M{"$dateToString": bson.M{"date": "$date", "format": "%Y-%m-%d", "timezone": tz}}
+	case GroupByInboundNumber:
+		return bson.M{"$ifNull": bson.A{"$inboundNumber", ""}}
+	case GroupByQueueExtension:
+		return bson.M{"$ifNull": bson.A{"$queueExtension", ""}}
+	case GroupByAgent:
+		return bson.M{"$ifNull": bson.A{"$userId", ""}}
+	default:
+		return ""
+	}
+}
+
+// callStatusExpression returns an aggregation expression that evaluates to the
+// status of a call. It must match structs.CallLog.ToProto and the status
+// update applied by the call-log API for calls that ended in one of the
+// internal queues.
+func callStatusExpression(internalQueues []string) bson.M {
+	// see structs.CallLog.AcceptedAgent
+	acceptedAgent := bson.M{"$cond": bson.A{
+		bson.M{"$and": bson.A{
+			bson.M{"$eq": bson.A{bson.M{"$ifNull": bson.A{"$userId", ""}}, ""}},
+			bson.M{"$ne": bson.A{bson.M{"$ifNull": bson.A{"$agentName", ""}}, ""}},
+			bson.M{"$ne": bson.A{"$toType", string(structs.TypeQueue)}},
+		}},
+		"$agentName",
+		"$agent",
+	}}
+
+	queues := bson.A{}
+	for _, e := range internalQueues {
+		queues = append(queues, e)
+	}
+
+	return bson.M{"$switch": bson.M{
+		"branches": bson.A{
+			bson.M{
+				"case": bson.M{"$or": bson.A{
+					bson.M{"$eq": bson.A{"$callType", "Missed"}},
+					bson.M{"$in": bson.A{acceptedAgent, queues}},
+				}},
+				"then": structs.CallStatusMissed,
+			},
+			bson.M{"case": bson.M{"$eq": bson.A{"$callType", "Inbound"}}, "then": structs.CallStatusInbound},
+			bson.M{"case": bson.M{"$eq": bson.A{"$callType", "Outbound"}}, "then": structs.CallStatusOutbound},
+			bson.M{"case": bson.M{"$in": bson.A{"$callType", bson.A{"NotAnswered", "Notanswered"}}}, "then": structs.CallStatusNotAnswered},
+		},
+		"default": "",
+	}}
+}
+
+func countStatus(status string) bson.M {
+	return bson.M{"$sum": bson.M{"$cond": bson.A{
+		bson.M{"$eq": bson.A{"$status", status}},
+		1,
+		0,
+	}}}
+}
+
+func (db *callRecordDatabase) CallStatistics(ctx context.Context, query StatisticsQuery) (*structs.CallStatistics, []structs.CallStatistics, error) {
+	match := bson.M{}
+
+	dateFilter := bson.M{}
+	if !query.From.IsZero() {
+		dateFilter["$gte"] = query.From
+	}
+	if !query.To.IsZero() {
+		dateFilter["$lte"] = query.To
+	}
+	if len(dateFilter) > 0 {
+		match["date"] = dateFilter
+	}
+
+	answered := bson.M{"$and": bson.A{
+		bson.M{"$in": bson.A{"$status", bson.A{structs.CallStatusInbound, structs.CallStatusOutbound}}},
+		bson.M{"$gt": bson.A{"$durationSeconds", 0}},
+	}}
+
+	sumOf := func(field string) bson.M {
+		return bson.M{"$sum": "$" + field}
+	}
+
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$addFields", Value: bson.M{
+			"status": callStatusExpression(query.InternalQueues),
+		}}},
+		// count the calls per group and duration first so each group only
+		// holds a histogram of the durations of answered calls.
+		{{Key: "$group", Value: bson.M{
+			"_id": bson.M{
+				"key": query.groupKey(),
+				"duration": bson.M{"$cond": bson.A{
+					answered,
+					"$durationSeconds",
+					nil,
+				}},
+			},
+			"total":       bson.M{"$sum": 1},
+			"inbound":     countStatus(structs.CallStatusInbound),
+			"outbound":    countStatus(structs.CallStatusOutbound),
+			"missed":      countStatus(structs.CallStatusMissed),
+			"notAnswered": countStatus(structs.CallStatusNotAnswered),
+		}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":         "$_id.key",
+			"total":       sumOf("total"),
+			"inbound":     sumOf("inbound"),
+			"outbound":    sumOf("outbound"),
+			"missed":      sumOf("missed"),
+			"notAnswered": sumOf("notAnswered"),
+			"durations": bson.M{"$push": bson.M{"$cond": bson.A{
+				bson.M{"$ne": bson.A{"$_id.duration", nil}},
+				bson.M{"d": "$_id.duration", "n": "$total"},
+				nil,
+			}}},
+		}}},
+		{{Key: "$addFields", Value: bson.M{
+			"durations": bson.M{"$filter": bson.M{
+				"input": "$durations",
+				"cond":  bson.M{"$ne": bson.A{"$$this", nil}},
+			}},
+		}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	}
+
+	cursor, err := db.callRecords.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to perform aggregation: %w", err)
+	}
+
+	var groups []statisticsGroup
+	if err := cursor.All(ctx, &groups); err != nil {
+		return nil, nil, fmt.Errorf("failed to decode documents: %w", err)
+	}
+
+	var (
+		overall      statisticsGroup
+		result       = make([]structs.CallStatistics, 0, len(groups))
+		allDurations []durationCount
+	)
+
+	for _, g := range groups {
+		overall.Total += g.Total
+		overall.Inbound += g.Inbound
+		overall.Outbound += g.Outbound
+		overall.Missed += g.Missed
+		overall.NotAnswered += g.NotAnswered
+		allDurations = append(allDurations, g.Durations...)
+
+		if query.GroupBy != GroupByNone {
+			result = append(result, g.toStatistics(query.Percentiles))
+		}
+	}
+
+	overall.Durations = allDurations
+	total := overall.toStatistics(query.Percentiles)
+
+	return &total, result, nil
+}
+
+func (g statisticsGroup) toStatistics(percentiles []float64) structs.CallStatistics {
+	stats := structs.CallStatistics{
+		Key:         g.Key,
+		Total:       g.Total,
+		Inbound:     g.Inbound,
+		Outbound:    g.Outbound,
+		Missed:      g.Missed,
+		NotAnswered: g.NotAnswered,
+	}
+
+	if len(g.Durations) == 0 {
+		return stats
+	}
+
+	durations := append([]durationCount{}, g.Durations...)
+	sort.Slice(durations, func(i, j int) bool { return durations[i].Seconds < durations[j].Seconds })
+
+	var sum, count int64
+	for _, d := range durations {
+		sum += d.Seconds * d.Count
+		count += d.Count
+	}
+
+	if count == 0 {
+		return stats
+	}
+
+	stats.AvgDurationSeconds = float64(sum) / float64(count)
+
+	if len(percentiles) > 0 {
+		stats.DurationPercentiles = make(map[string]float64, len(percentiles))
+
+		for _, p := range percentiles {
+			stats.DurationPercentiles["p"+strconv.FormatFloat(p, 'f', -1, 64)] = percentile(durations, count, p)
+		}
+	}
+
+	return stats
+}
+
+// percentile returns the p-th percentile of the durations, sorted by seconds,
+// using the nearest-rank method. count is the total number of calls.
+func percentile(sorted []durationCount, count int64, p float64) float64 {
+	if count == 0 {
+		return 0
+	}
+
+	rank := int64(math.Ceil(p / 100 * float64(count)))
+	if rank < 1 {
+		rank = 1
+	}
+	if rank > count {
+		rank = count
+	}
+
+	for _, d := range sorted {
+		rank -= d.Count
+		if rank <= 0 {
+			return float64(d.Seconds)
+		}
+	}
+
+	return float64(sorted[len(sorted)-1].Seconds)
+}
@@ -0,0 +1,99 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+)
+
+func Test_percentile(t *testing.T) {
+	// 10s, 20s, 20s, 30s, 60s
+	durations := []durationCount{{10, 1}, {20, 2}, {30, 1}, {60, 1}}
+
+	cases := []struct {
+		P float64
+		E float64
+	}{
+		{0, 10},
+		{20, 10},
+		{21, 20},
+		{50, 20},
+		{60, 20},
+		{80, 30},
+		{90, 60},
+		{100, 60},
+		{150, 60},
+	}
+
+	for _, c := range cases {
+		if res := percentile(durations, 5, c.P); res != c.E {
+			t.Errorf("p%v: unexpected result %v != %v", c.P, res, c.E)
+		}
+	}
+
+	if res := percentile(nil, 0, 50); res != 0 {
+		t.Errorf("empty: unexpected result %v", res)
+	}
+}
+
+func Test_statisticsGroup_toStatistics(t *testing.T) {
+	cases := []struct {
+		Name        string
+		I           statisticsGroup
+		Percentiles []float64
+		E           structs.CallStatistics
+	}{
+		{
+			Name: "without answered calls",
+			I:    statisticsGroup{Key: "2024-01-02", Total: 2, Missed: 2},
+			E:    structs.CallStatistics{Key: "2024-01-02", Total: 2, Missed: 2},
+		},
+		{
+			Name: "unsorted durations",
+			I: statisticsGroup{
+				Key:       "1000",
+				Total:     5,
+				Inbound:   3,
+				Outbound:  1,
+				Missed:    1,
+				Durations: []durationCount{{60, 1}, {20, 2}, {100, 1}},
+			},
+			Percentiles: []float64{50, 90, 99.5},
+			E: structs.CallStatistics{
+				Key:                "1000",
+				Total:              5,
+				Inbound:            3,
+				Outbound:           1,
+				Missed:             1,
+				AvgDurationSeconds: 50,
+				DurationPercentiles: map[string]float64{
+					"p50":   20,
+					"p90":   100,
+					"p99.5": 100,
+				},
+			},
+		},
+		{
+			Name: "merged groups",
+			I: statisticsGroup{
+				Total:     4,
+				Inbound:   4,
+				Durations: []durationCount{{30, 1}, {10, 1}, {30, 2}},
+			},
+			Percentiles: []float64{50},
+			E: structs.CallStatistics{
+				Total:               4,
+				Inbound:             4,
+				AvgDurationSeconds:  25,
+				DurationPercentiles: map[string]float64{"p50": 30},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		if res := c.I.toStatistics(c.Percentiles); !reflect.DeepEqual(res, c.E) {
+			t.Errorf("%s: unexpected result\n got  %+v\n want %+v", c.Name, res, c.E)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// timelineFilter restricts filter to documents before the timeline entry
+// token points to. Timelines are sorted by timeField and the document ID,
+// newest first.
+func timelineFilter(filter bson.M, timeField string, token *PageToken) bson.M {
+	if token == nil {
+		return filter
+	}
+
+	return bson.M{
+		"$and": bson.A{
+			filter,
+			bson.M{"$or": bson.A{
+				bson.M{timeField: bson.M{"$lt": token.Value}},
+				bson.M{
+					timeField: token.Value,
+					"_id":     bson.M{"$lt": token.ID},
+				},
+			}},
+		},
+	}
+}
+
+func timelineOptions(timeField string, limit int) *options.FindOptions {
+	return options.Find().
+		SetSort(bson.D{
+			{Key: timeField, Value: -1},
+			{Key: "_id", Value: -1},
+		}).
+		SetLimit(int64(limit))
+}
+
+func (db *callRecordDatabase) FindTimelineCallLogs(ctx context.Context, subject DataSubject, before *PageToken, limit int) ([]structs.CallLog, error) {
+	filter := timelineFilter(subject.callLogFilter(), "date", before)
+
+	cursor, err := db.callRecords.Find(ctx, filter, timelineOptions("date", limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform find operation: %w", err)
+	}
+
+	var result []structs.CallLog
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode documents: %w", err)
+	}
+
+	return result, nil
+}
+
+func (db *callRecordDatabase) FindCallbacks(ctx context.Context, numbers []string, after time.Time) ([]structs.CallLog, error) {
+	if len(numbers) == 0 {
+		return nil, nil
+	}
+
+	filter := bson.M{
+		"direction": "Outbound",
+		"callType":  "Outbound",
+		"caller": bson.M{
+			"$in": numbers,
+		},
+		"date": bson.M{
+			"$gt": after,
+		},
+	}
+
+	cursor, err := db.callRecords.Find(ctx, filter, options.Find().SetSort(bson.M{"date": 1}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform find operation: %w", err)
+	}
+
+	var result []structs.CallLog
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode documents: %w", err)
+	}
+
+	return result, nil
+}
+
+func (db *mailboxDatabase) FindTimelineVoiceMails(ctx context.Context, subject DataSubject, before *PageToken, limit int) ([]structs.VoiceMail, error) {
+	filter := timelineFilter(subject.filter("customerId", "caller"), "receiveTime", before)
+
+	cursor, err := db.records.Find(ctx, filter, timelineOptions("receiveTime", limit))
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform find operation: %w", err)
+	}
+
+	var result []structs.VoiceMail
+	if err := cursor.All(ctx, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode documents: %w", err)
+	}
+
+	return result, nil
+}
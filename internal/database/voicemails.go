@@ -45,6 +45,20 @@ type MailboxDatabase interface {
 	FindNotificationCandidates(ctx context.Context, mailbox string, unseen bool, notification string) ([]string, error)
 	MarkAsNotificationSent(ctx context.Context, mailbox, notification string, recordIds []string) error
 
+	// FindDataSubjectVoiceMails returns all voicemail records of the customer
+	// or the phone numbers of subject.
+	FindDataSubjectVoiceMails(ctx context.Context, subject DataSubject) ([]structs.VoiceMail, error)
+	// FindTimelineVoiceMails returns up to limit voicemail records of the
+	// customer or the phone numbers of subject, newest first. If before is
+	// set, only records received before the entry it points to are returned.
+	FindTimelineVoiceMails(ctx context.Context, subject DataSubject, before *PageToken, limit int) ([]structs.VoiceMail, error)
+	// DeleteVoiceMails deletes all voicemail records with the given IDs. The
+	// recording files are not removed.
+	DeleteVoiceMails(ctx context.Context, ids []primitive.ObjectID) (int64, error)
+	// AnonymizeVoiceMails removes the caller, the customer, the message and
+	// the recording file name from all voicemail records with the given IDs.
+	AnonymizeVoiceMails(ctx context.Context, ids []primitive.ObjectID) (int64, error)
+
 	mailsync.Store
 }
 
@@ -0,0 +1,95 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"slices"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/apis/pkg/auth"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// RemoteUserExtractor resolves the remote user of a request, e.g.
+// auth.RemoteHeaderExtractor.
+type RemoteUserExtractor func(ctx context.Context, req connect.AnyRequest) (*auth.RemoteUser, error)
+
+type remoteUserKey struct{}
+
+// HTTPAuth authenticates requests to plain HTTP endpoints which are not
+// covered by the connect interceptors. The remote user is resolved the same
+// way as for connect handlers and may be retrieved using remoteUserFrom.
+type HTTPAuth struct {
+	extractor  RemoteUserExtractor
+	adminRoles []string
+}
+
+// NewHTTPAuth returns a new HTTPAuth. Users with one of adminRoles are
+// allowed to access endpoints wrapped by Admin.
+func NewHTTPAuth(extractor RemoteUserExtractor, adminRoles []string) *HTTPAuth {
+	return &HTTPAuth{
+		extractor:  extractor,
+		adminRoles: adminRoles,
+	}
+}
+
+// User returns a handler that requires an authenticated user before calling
+// next.
+func (a *HTTPAuth) User(next http.HandlerFunc) http.Handler {
+	return a.handler(next, false)
+}
+
+// Admin returns a handler that requires an authenticated user with one of the
+// admin roles before calling next.
+func (a *HTTPAuth) Admin(next http.HandlerFunc) http.Handler {
+	return a.handler(next, true)
+}
+
+func (a *HTTPAuth) handler(next http.HandlerFunc, requireAdmin bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the extractor only looks at the request headers.
+		req := connect.NewRequest(&emptypb.Empty{})
+		for key, values := range r.Header {
+			req.Header()[key] = values
+		}
+
+		user, err := a.extractor(r.Context(), req)
+		if err != nil {
+			slog.Error("failed to resolve remote user", "path", r.URL.Path, "error", err)
+		}
+
+		if user == nil || user.ID == "" {
+			http.Error(w, "unauthenticated", http.StatusUnauthorized)
+			return
+		}
+
+		if requireAdmin && !a.isAdmin(user) {
+			http.Error(w, "permission denied", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), remoteUserKey{}, user)))
+	})
+}
+
+func (a *HTTPAuth) isAdmin(user *auth.RemoteUser) bool {
+	for _, role := range user.RoleIDs {
+		if slices.Contains(a.adminRoles, role) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// remoteUserFrom returns the remote user of a request authenticated by
+// HTTPAuth or by the connect auth interceptor. It returns nil if there is
+// none.
+func remoteUserFrom(ctx context.Context) *auth.RemoteUser {
+	if user, ok := ctx.Value(remoteUserKey{}).(*auth.RemoteUser); ok {
+		return user
+	}
+
+	return auth.From(ctx)
+}
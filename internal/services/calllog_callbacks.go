@@ -0,0 +1,119 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	pbx3cxv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/pbx3cx/v1"
+)
+
+// defaultCallbackWindow limits open callbacks to recent missed calls if the
+// request does not specify a start time.
+const defaultCallbackWindow = 7 * 24 * time.Hour
+
+type (
+	// OpenCallback is a missed call that has not been called back yet.
+	OpenCallback struct {
+		// Call is the missed call encoded using the protobuf JSON mapping of
+		// CallEntry.
+		Call json.RawMessage `json:"call"`
+		// MissedCalls is the number of open missed calls from the same caller
+		// to the same inbound number, including Call.
+		MissedCalls int `json:"missedCalls"`
+	}
+
+	// OpenCallbacks holds all open callbacks for an inbound number.
+	OpenCallbacks struct {
+		InboundNumber string          `json:"inboundNumber"`
+		Callbacks     []*OpenCallback `json:"callbacks"`
+	}
+)
+
+// OpenCallbacksHandler returns all missed calls that have not been called back
+// yet, grouped by inbound number. Callers with multiple missed calls are only
+// listed once with their latest call. The list can be limited using the
+// inboundNumber (repeatable) and since query parameters. since defaults to
+// seven days ago.
+func (svc *CallService) OpenCallbacksHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	since, err := parseTimeParam(q, "since")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if since.IsZero() {
+		since = time.Now().Add(-defaultCallbackWindow)
+	}
+
+	queues, err := svc.InternalQueueExtensions(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	calls, err := svc.CallLogDB.FindOpenCallbacks(r.Context(), q["inboundNumber"], since, queues)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// calls are sorted by date, newest first.
+	var (
+		byNumber = make(map[string]*OpenCallbacks)
+		seen     = make(map[string]*OpenCallback)
+		entries  []*pbx3cxv1.CallEntry
+		latest   []*OpenCallback
+	)
+
+	for _, c := range calls {
+		key := c.InboundNumber + "/" + c.Caller
+		if cb, ok := seen[key]; ok {
+			cb.MissedCalls++
+			continue
+		}
+
+		cb := &OpenCallback{
+			MissedCalls: 1,
+		}
+		seen[key] = cb
+
+		entries = append(entries, c.ToProto())
+		latest = append(latest, cb)
+
+		group, ok := byNumber[c.InboundNumber]
+		if !ok {
+			group = &OpenCallbacks{
+				InboundNumber: c.InboundNumber,
+			}
+			byNumber[c.InboundNumber] = group
+		}
+		group.Callbacks = append(group.Callbacks, cb)
+	}
+
+	// the status is not part of the call-log record so update it the same
+	// way as the call-log API does.
+	svc.updateCallLogStatus(r.Context(), entries)
+
+	blobs, err := protoJSON(entries)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	for idx, cb := range latest {
+		cb.Call = blobs[idx]
+	}
+
+	result := make([]*OpenCallbacks, 0, len(byNumber))
+	for _, g := range byNumber {
+		result = append(result, g)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].InboundNumber < result[j].InboundNumber
+	})
+
+	writeJSON(w, r, http.StatusOK, result)
+}
@@ -0,0 +1,342 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/tierklinik-dobersberg/3cx-support/internal/database"
+	"github.com/tierklinik-dobersberg/3cx-support/internal/spreadsheet"
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+	customerv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/customer/v1"
+	idmv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/idm/v1"
+	pbx3cxv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/pbx3cx/v1"
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// exportBatchSize is the number of records for which customer names are
+// resolved at once during exports.
+const exportBatchSize = 200
+
+// exportColumns holds the header row of call-log exports.
+var exportColumns = []any{
+	"Date",
+	"Direction",
+	"Call Type",
+	"Inbound Number",
+	"Caller",
+	"Customer",
+	"Customer ID",
+	"Agent",
+	"Agent User",
+	"Duration (s)",
+	"Ring Time (s)",
+	"Queue",
+	"Transfer Target",
+	"Called Back",
+	"Tags",
+}
+
+// ExportCallLogsHandler streams all call-log records that match the query
+// parameters (see searchQueryFromParams) as a CSV (format=csv, the default)
+// or XLSX (format=xlsx) file. Records are sorted by date in ascending order
+// unless specified otherwise using the sort and order query parameters.
+func (svc *CallService) ExportCallLogsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+
+	format := q.Get("format")
+	if format == "" {
+		format = spreadsheet.FormatCSV
+	}
+
+	if format != spreadsheet.FormatCSV && format != spreadsheet.FormatXLSX {
+		http.Error(w, fmt.Sprintf("unsupported format %q", format), http.StatusBadRequest)
+		return
+	}
+
+	query, err := searchQueryFromParams(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	field, err := database.ParseSortField(q.Get("sort"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query.SortBy(field, q.Get("order") != "desc")
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	queues, err := svc.InternalQueues(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	users := svc.exportUserNames(ctx)
+	customers := make(map[string]string)
+
+	w.Header().Set("Content-Type", spreadsheet.ContentType(format))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("call-logs-%s.%s", time.Now().Format("20060102-150405"), format)))
+
+	writer, err := spreadsheet.NewWriter(w, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := writer.WriteRow(exportColumns...); err != nil {
+		log.L(ctx).Error("failed to write export header", "error", err)
+		return
+	}
+
+	batch := make([]structs.CallLog, 0, exportBatchSize)
+	flush := func() error {
+		svc.resolveCustomerNames(ctx, batch, customers)
+
+		for _, record := range batch {
+			if err := writer.WriteRow(exportRow(record, customers, users, queues)...); err != nil {
+				return err
+			}
+		}
+
+		batch = batch[:0]
+
+		return nil
+	}
+
+	results, errs := svc.CallLogDB.StreamSearch(ctx, query)
+
+L:
+	for {
+		select {
+		case record, ok := <-results:
+			if !ok {
+				break L
+			}
+
+			batch = append(batch, record)
+			if len(batch) < exportBatchSize {
+				continue
+			}
+
+			if err := flush(); err != nil {
+				log.L(ctx).Error("failed to write export rows", "error", err)
+				return
+			}
+
+		case err, ok := <-errs:
+			if !ok {
+				// the error channel is closed before the result channel.
+				errs = nil
+				continue
+			}
+
+			// the response has already been started so all we can do is
+			// to abort the export.
+			log.L(ctx).Error("failed to stream call-log records", "error", err)
+			return
+		}
+	}
+
+	// errors that are sent right before the end of the stream may still be
+	// pending. The error channel is already closed so this does not block.
+	if errs != nil {
+		if err, ok := <-errs; ok {
+			log.L(ctx).Error("failed to stream call-log records", "error", err)
+			return
+		}
+	}
+
+	if err := flush(); err != nil {
+		log.L(ctx).Error("failed to write export rows", "error", err)
+		return
+	}
+
+	if err := writer.Close(); err != nil {
+		log.L(ctx).Error("failed to finish export", "error", err)
+	}
+}
+
+func exportRow(record structs.CallLog, customers map[string]string, users map[string]string, queues map[string]*pbx3cxv1.PhoneExtension) []any {
+	// calls that ended in an internal queue are reported as missed, see
+	// updateCallLogStatus.
+	callType := record.CallType
+	if _, ok := queues[record.AcceptedAgent()]; ok {
+		callType = "Missed"
+	}
+
+	customer := customers[customerKey(record)]
+	if customer == "" {
+		customer = record.CallerName
+	}
+
+	agentUser := users[record.AgentUserId]
+	if agentUser == "" {
+		agentUser = record.AgentName
+	}
+
+	var calledBack time.Time
+	if record.CalledBack != nil {
+		calledBack = record.CalledBack.Time
+	}
+
+	return []any{
+		record.Date,
+		record.Direction,
+		callType,
+		escapeCell(record.InboundNumber),
+		escapeCell(record.Caller),
+		escapeCell(customer),
+		escapeCell(record.CustomerID),
+		escapeCell(record.Agent),
+		escapeCell(agentUser),
+		record.DurationSeconds,
+		record.RingSeconds,
+		escapeCell(record.QueueExtension),
+		escapeCell(record.TransferTarget),
+		calledBack,
+		escapeCell(strings.Join(record.Tags, ", ")),
+	}
+}
+
+// escapeCell prefixes text values that spreadsheet applications would
+// interpret as a formula with a single quote. Phone numbers in international
+// format (e.g. "+43 664 1234567") cannot form a formula and are kept as is.
+func escapeCell(value string) string {
+	if value == "" || !strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return value
+	}
+
+	if value[0] == '+' && len(value) > 1 && strings.Trim(value[1:], "0123456789 ") == "" {
+		return value
+	}
+
+	return "'" + value
+}
+
+// customerKey returns the key used to cache the customer name of record.
+func customerKey(record structs.CallLog) string {
+	if record.CustomerID == "" {
+		return ""
+	}
+
+	return record.CustomerSource + "/" + record.CustomerID
+}
+
+// resolveCustomerNames fetches the names of all customers of records that are
+// not yet part of names. Errors are logged and the customer name is left empty.
+func (svc *CallService) resolveCustomerNames(ctx context.Context, records []structs.CallLog, names map[string]string) {
+	var (
+		byId    []*customerv1.CustomerQuery
+		idQuery = make(map[string]string)
+	)
+
+	for _, record := range records {
+		key := customerKey(record)
+		if key == "" {
+			continue
+		}
+
+		if _, ok := names[key]; ok {
+			continue
+		}
+		names[key] = ""
+
+		// customers from other sources are identified by their internal
+		// reference so we query them one by one.
+		if record.CustomerSource != "" {
+			res, err := svc.Customer.SearchCustomer(ctx, connect.NewRequest(&customerv1.SearchCustomerRequest{
+				Queries: []*customerv1.CustomerQuery{
+					{
+						Query: &customerv1.CustomerQuery_InternalReference{
+							InternalReference: &customerv1.InternalReferenceQuery{
+								Importer: record.CustomerSource,
+								Ref:      record.CustomerID,
+							},
+						},
+					},
+				},
+			}))
+			if err != nil {
+				log.L(ctx).Warn("failed to fetch customer record", "customerSource", record.CustomerSource, "customerId", record.CustomerID, "error", err)
+				continue
+			}
+
+			if len(res.Msg.Results) > 0 {
+				names[key] = customerName(res.Msg.Results[0].Customer)
+			}
+
+			continue
+		}
+
+		idQuery[record.CustomerID] = key
+		byId = append(byId, &customerv1.CustomerQuery{
+			Query: &customerv1.CustomerQuery_Id{
+				Id: record.CustomerID,
+			},
+		})
+	}
+
+	if len(byId) == 0 {
+		return
+	}
+
+	res, err := svc.Customer.SearchCustomer(ctx, connect.NewRequest(&customerv1.SearchCustomerRequest{
+		Queries: byId,
+	}))
+	if err != nil {
+		log.L(ctx).Warn("failed to fetch customer records", "count", len(byId), "error", err)
+		return
+	}
+
+	for _, c := range res.Msg.Results {
+		if key, ok := idQuery[c.Customer.GetId()]; ok {
+			names[key] = customerName(c.Customer)
+		}
+	}
+}
+
+func customerName(c *customerv1.Customer) string {
+	return strings.TrimSpace(c.GetFirstName() + " " + c.GetLastName())
+}
+
+// exportUserNames returns the display names of all users indexed by user ID.
+// Errors are logged and an empty map is returned.
+func (svc *CallService) exportUserNames(ctx context.Context) map[string]string {
+	result := make(map[string]string)
+
+	res, err := svc.Users.ListUsers(ctx, connect.NewRequest(&idmv1.ListUsersRequest{
+		FieldMask: &fieldmaskpb.FieldMask{
+			Paths: []string{"profiles.user.avatar"},
+		},
+		ExcludeFields: true,
+	}))
+	if err != nil {
+		log.L(ctx).Warn("failed to fetch users from idm service", "error", err)
+		return result
+	}
+
+	for _, p := range res.Msg.GetUsers() {
+		name := p.GetUser().GetDisplayName()
+		if name == "" {
+			name = p.GetUser().GetUsername()
+		}
+
+		result[p.GetUser().GetId()] = name
+	}
+
+	return result
+}
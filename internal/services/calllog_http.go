@@ -0,0 +1,58 @@
+package services
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/database"
+)
+
+// GetCallLogHandler returns the call-log record identified by the id query
+// parameter including all call legs.
+func (svc *CallService) GetCallLogHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "invalid or missing call-log id", http.StatusBadRequest)
+		return
+	}
+
+	record, err := svc.CallLogDB.GetCallLog(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			http.Error(w, "call-log not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, record)
+}
+
+// NumberQualityReportHandler lists all callers that are not valid phone
+// numbers so number-handling rules can be fixed. The report can be limited
+// using the from, to and quality query parameters.
+func (svc *CallService) NumberQualityReportHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	from, err := parseTimeParam(q, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	to, err := parseTimeParam(q, "to")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := svc.CallLogDB.NumberQualityReport(r.Context(), from, to, q["quality"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, report)
+}
@@ -0,0 +1,195 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/database"
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+	pbx3cxv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/pbx3cx/v1"
+	"google.golang.org/protobuf/encoding/protojson"
+)
+
+// MissedCallRule is the JSON representation of a structs.MissedCallRule. The
+// notification settings are encoded using the protobuf JSON mapping of
+// NotificationSettings, the same as for mailbox notifications.
+type MissedCallRule struct {
+	ID            string          `json:"id,omitempty"`
+	InboundNumber string          `json:"inboundNumber"`
+	Mode          string          `json:"mode"`
+	Threshold     int             `json:"threshold,omitempty"`
+	WindowMinutes int             `json:"windowMinutes,omitempty"`
+	Disabled      bool            `json:"disabled,omitempty"`
+	Settings      json.RawMessage `json:"settings"`
+}
+
+// MissedCallRulesHandler lists all missed-call notification rules (GET) or
+// creates a new one (POST).
+func (svc *CallService) MissedCallRulesHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		rules, err := svc.MissedCallRules.ListMissedCallRules(r.Context())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		result := make([]MissedCallRule, 0, len(rules))
+		for idx := range rules {
+			rule, err := missedCallRuleToJSON(&rules[idx])
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+
+			result = append(result, rule)
+		}
+
+		writeJSON(w, r, http.StatusOK, result)
+
+	case http.MethodPost:
+		rule := new(structs.MissedCallRule)
+		if err := readMissedCallRule(r, rule); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		svc.saveMissedCallRule(w, r, rule, http.StatusCreated)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// MissedCallRuleHandler returns (GET), replaces (PUT) or deletes (DELETE) the
+// missed-call notification rule identified by the id query parameter.
+func (svc *CallService) MissedCallRuleHandler(w http.ResponseWriter, r *http.Request) {
+	rule, err := svc.MissedCallRules.GetMissedCallRule(r.Context(), r.URL.Query().Get("id"))
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			http.Error(w, "missed-call rule not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		result, err := missedCallRuleToJSON(rule)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, r, http.StatusOK, result)
+
+	case http.MethodPut:
+		if err := readMissedCallRule(r, rule); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		svc.saveMissedCallRule(w, r, rule, http.StatusOK)
+
+	case http.MethodDelete:
+		if err := svc.MissedCallRules.DeleteMissedCallRule(r.Context(), rule.ID.Hex()); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (svc *CallService) saveMissedCallRule(w http.ResponseWriter, r *http.Request, rule *structs.MissedCallRule, status int) {
+	if err := svc.MissedCallRules.SaveMissedCallRule(r.Context(), rule); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result, err := missedCallRuleToJSON(rule)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, status, result)
+}
+
+// readMissedCallRule decodes and validates the request body and applies it
+// to rule.
+func readMissedCallRule(r *http.Request, rule *structs.MissedCallRule) error {
+	var req MissedCallRule
+	if err := readJSON(r, &req); err != nil {
+		return err
+	}
+
+	if req.InboundNumber == "" {
+		return fmt.Errorf("inboundNumber is required")
+	}
+
+	settings := new(pbx3cxv1.NotificationSettings)
+	if err := protojson.Unmarshal(req.Settings, settings); err != nil {
+		return fmt.Errorf("invalid notification settings: %w", err)
+	}
+
+	if settings.GetRecipients() == nil {
+		return fmt.Errorf("settings: no recipients specified")
+	}
+
+	if len(settings.Types) == 0 {
+		return fmt.Errorf("settings: no notification types specified")
+	}
+
+	switch req.Mode {
+	case structs.MissedCallNotifyImmediate:
+	case structs.MissedCallNotifyDigest:
+		if len(settings.SendTimes) == 0 {
+			return fmt.Errorf("digest rules require at least one send time")
+		}
+	case structs.MissedCallNotifyThreshold:
+		if req.Threshold < 1 || req.WindowMinutes < 1 {
+			return fmt.Errorf("threshold rules require a positive threshold and windowMinutes")
+		}
+	default:
+		return fmt.Errorf("invalid mode %q", req.Mode)
+	}
+
+	rule.InboundNumber = req.InboundNumber
+	rule.Mode = req.Mode
+	rule.Threshold = req.Threshold
+	rule.WindowMinutes = req.WindowMinutes
+	rule.Disabled = req.Disabled
+	rule.Settings = settings
+
+	return nil
+}
+
+func missedCallRuleToJSON(rule *structs.MissedCallRule) (MissedCallRule, error) {
+	result := MissedCallRule{
+		ID:            rule.ID.Hex(),
+		InboundNumber: rule.InboundNumber,
+		Mode:          rule.Mode,
+		Threshold:     rule.Threshold,
+		WindowMinutes: rule.WindowMinutes,
+		Disabled:      rule.Disabled,
+	}
+
+	if rule.Settings != nil {
+		blob, err := protojson.Marshal(rule.Settings)
+		if err != nil {
+			return result, fmt.Errorf("failed to encode notification settings: %w", err)
+		}
+
+		result.Settings = blob
+	}
+
+	return result, nil
+}
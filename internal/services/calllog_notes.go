@@ -0,0 +1,293 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/database"
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type (
+	// CallNoteRequest is the request body to add or edit a call note.
+	CallNoteRequest struct {
+		Text string `json:"text"`
+	}
+
+	// CallTagsRequest is the request body to add tags to a call.
+	CallTagsRequest struct {
+		Tags []string `json:"tags"`
+	}
+
+	// CallAnnotations holds the notes and tags of a call-log record.
+	CallAnnotations struct {
+		Notes []structs.CallNote `json:"notes,omitempty"`
+		Tags  []string           `json:"tags,omitempty"`
+	}
+)
+
+// CallNotesHandler lists (GET) or adds (POST) notes of the call-log record
+// identified by the callId query parameter. The author of a new note is the
+// authenticated user.
+func (svc *CallService) CallNotesHandler(w http.ResponseWriter, r *http.Request) {
+	record, ok := svc.callLogFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		notes := record.Notes
+		if notes == nil {
+			notes = []structs.CallNote{}
+		}
+
+		writeJSON(w, r, http.StatusOK, notes)
+
+	case http.MethodPost:
+		remoteUser := remoteUserFrom(r.Context())
+		if remoteUser == nil {
+			http.Error(w, "missing remote user", http.StatusUnauthorized)
+			return
+		}
+
+		text, err := readCallNoteText(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		note := structs.CallNote{
+			ID:        primitive.NewObjectID(),
+			AuthorID:  remoteUser.ID,
+			CreatedAt: time.Now(),
+			Text:      text,
+		}
+
+		if err := svc.CallLogDB.AddCallNote(r.Context(), record.ID, note); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, r, http.StatusCreated, note)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// CallNoteHandler edits (PUT) or removes (DELETE) the note identified by the
+// id query parameter of the call-log record identified by the callId query
+// parameter. Notes may only be changed by their author.
+func (svc *CallService) CallNoteHandler(w http.ResponseWriter, r *http.Request) {
+	record, ok := svc.callLogFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	noteID, err := primitive.ObjectIDFromHex(r.URL.Query().Get("id"))
+	if err != nil {
+		http.Error(w, "invalid or missing note id", http.StatusBadRequest)
+		return
+	}
+
+	note := record.Note(noteID)
+	if note == nil {
+		http.Error(w, "note not found", http.StatusNotFound)
+		return
+	}
+
+	remoteUser := remoteUserFrom(r.Context())
+	if remoteUser == nil {
+		http.Error(w, "missing remote user", http.StatusUnauthorized)
+		return
+	}
+
+	if note.AuthorID != remoteUser.ID {
+		http.Error(w, "notes may only be changed by their author", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		text, err := readCallNoteText(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := svc.CallLogDB.UpdateCallNote(r.Context(), record.ID, noteID, text); err != nil {
+			svc.writeCallNoteError(w, err)
+			return
+		}
+
+		note.Text = text
+		note.UpdatedAt = time.Now()
+
+		writeJSON(w, r, http.StatusOK, note)
+
+	case http.MethodDelete:
+		if err := svc.CallLogDB.DeleteCallNote(r.Context(), record.ID, noteID); err != nil {
+			svc.writeCallNoteError(w, err)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// CallTagsHandler lists (GET), adds (POST) or removes (DELETE) tags of the
+// call-log record identified by the callId query parameter. Tags to remove are
+// specified using the tag query parameter which may be repeated.
+func (svc *CallService) CallTagsHandler(w http.ResponseWriter, r *http.Request) {
+	record, ok := svc.callLogFromParams(w, r)
+	if !ok {
+		return
+	}
+
+	var (
+		tags []string
+		err  error
+	)
+
+	switch r.Method {
+	case http.MethodGet:
+		tags = record.Tags
+
+	case http.MethodPost:
+		var req CallTagsRequest
+		if err := readJSON(r, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if req.Tags, err = normalizeTags(req.Tags); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		tags, err = svc.CallLogDB.AddCallTags(r.Context(), record.ID, req.Tags)
+
+	case http.MethodDelete:
+		var remove []string
+		if remove, err = normalizeTags(r.URL.Query()["tag"]); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		tags, err = svc.CallLogDB.RemoveCallTags(r.Context(), record.ID, remove)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		svc.writeCallNoteError(w, err)
+		return
+	}
+
+	if tags == nil {
+		tags = []string{}
+	}
+
+	writeJSON(w, r, http.StatusOK, tags)
+}
+
+// callLogFromParams loads the call-log record identified by the callId query
+// parameter. If it fails, an error is written to w and false is returned.
+func (svc *CallService) callLogFromParams(w http.ResponseWriter, r *http.Request) (*structs.CallLog, bool) {
+	id := r.URL.Query().Get("callId")
+	if id == "" {
+		http.Error(w, "invalid or missing call-log id", http.StatusBadRequest)
+		return nil, false
+	}
+
+	record, err := svc.CallLogDB.GetCallLog(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			http.Error(w, "call-log not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+
+		return nil, false
+	}
+
+	return record, true
+}
+
+func (svc *CallService) writeCallNoteError(w http.ResponseWriter, err error) {
+	if errors.Is(err, database.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+	} else {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func readCallNoteText(r *http.Request) (string, error) {
+	var req CallNoteRequest
+	if err := readJSON(r, &req); err != nil {
+		return "", err
+	}
+
+	text := strings.TrimSpace(req.Text)
+	if text == "" {
+		return "", fmt.Errorf("text is required")
+	}
+
+	return text, nil
+}
+
+// normalizeTags trims all tags and removes empty and duplicate ones. It fails
+// if no tags remain.
+func normalizeTags(tags []string) ([]string, error) {
+	result := make([]string, 0, len(tags))
+	seen := make(map[string]struct{}, len(tags))
+
+	for _, t := range tags {
+		t = strings.TrimSpace(t)
+		if t == "" {
+			continue
+		}
+
+		if _, ok := seen[t]; ok {
+			continue
+		}
+		seen[t] = struct{}{}
+
+		result = append(result, t)
+	}
+
+	if len(result) == 0 {
+		return nil, fmt.Errorf("no tags specified")
+	}
+
+	return result, nil
+}
+
+// callAnnotations returns the notes and tags of all records that have any,
+// indexed by the record ID.
+func callAnnotations(records []structs.CallLog) map[string]CallAnnotations {
+	result := make(map[string]CallAnnotations)
+
+	for _, r := range records {
+		if len(r.Notes) == 0 && len(r.Tags) == 0 {
+			continue
+		}
+
+		result[r.ID.Hex()] = CallAnnotations{
+			Notes: r.Notes,
+			Tags:  r.Tags,
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,37 @@
+package services
+
+import (
+	"net/http"
+	"time"
+)
+
+// RetentionHandler reports which call-log records would be anonymized or
+// deleted by the configured retention policies (GET) or applies the
+// policies immediately (POST). If RetentionDryRun is configured, POST
+// requests only report as well.
+func (svc *CallService) RetentionHandler(w http.ResponseWriter, r *http.Request) {
+	var dryRun bool
+
+	switch r.Method {
+	case http.MethodGet:
+		dryRun = true
+	case http.MethodPost:
+		dryRun = svc.Config.RetentionDryRun
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !svc.Config.RetentionEnabled() {
+		http.Error(w, "no retention policy configured", http.StatusPreconditionFailed)
+		return
+	}
+
+	report, err := svc.ApplyRetention(r.Context(), time.Now(), dryRun)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, report)
+}
@@ -0,0 +1,274 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/database"
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+)
+
+const (
+	// defaultPageSize is used if a paginated request does not specify a page size.
+	defaultPageSize = 50
+	// maxPageSize is the maximum page size for paginated requests.
+	maxPageSize = 500
+)
+
+// CallLogPage is a single page of call-log entries. Results and Customers are
+// encoded using the protobuf JSON mapping of CallEntry and Customer.
+// Annotations holds the notes and tags and Timings holds the timing of the
+// results, both indexed by the CallEntry ID.
+type CallLogPage struct {
+	Results       []json.RawMessage          `json:"results"`
+	Customers     []json.RawMessage          `json:"customers,omitempty"`
+	Annotations   map[string]CallAnnotations `json:"annotations,omitempty"`
+	Timings       map[string]CallTiming      `json:"timings,omitempty"`
+	Total         int64                      `json:"total"`
+	NextPageToken string                     `json:"nextPageToken,omitempty"`
+}
+
+// CallTiming describes how long the caller had to wait and how a call
+// ended. It is not part of CallEntry.
+type CallTiming struct {
+	// TimeAnswered is not set for calls that have not been answered.
+	TimeAnswered *time.Time `json:"timeAnswered,omitempty"`
+	TimeEnd      *time.Time `json:"timeEnd,omitempty"`
+	// RingSeconds is the time the caller waited until the call has been
+	// answered or, for calls that have not been answered, until it ended.
+	RingSeconds      uint64 `json:"ringSeconds"`
+	ReasonTerminated string `json:"reasonTerminated,omitempty"`
+	// TerminatedBy is either "caller" or "agent".
+	TerminatedBy string `json:"terminatedBy,omitempty"`
+}
+
+// callTiming returns the timing of record or nil if no call-data-record has
+// been received for the call yet.
+func callTiming(record structs.CallLog) *CallTiming {
+	if record.TimeEnd.IsZero() && record.ReasonTerminated == "" {
+		return nil
+	}
+
+	timing := &CallTiming{
+		RingSeconds:      record.RingSeconds,
+		ReasonTerminated: record.ReasonTerminated,
+		TerminatedBy:     record.TerminatedBy,
+	}
+
+	if !record.TimeAnswered.IsZero() {
+		t := record.TimeAnswered
+		timing.TimeAnswered = &t
+	}
+
+	if !record.TimeEnd.IsZero() {
+		t := record.TimeEnd
+		timing.TimeEnd = &t
+	}
+
+	return timing
+}
+
+// callTimings returns the timing of all records that have one, indexed by the
+// record ID.
+func callTimings(records []structs.CallLog) map[string]CallTiming {
+	result := make(map[string]CallTiming)
+
+	for _, r := range records {
+		if timing := callTiming(r); timing != nil {
+			result[r.ID.Hex()] = *timing
+		}
+	}
+
+	return result
+}
+
+// parsePageParams parses the pageSize and pageToken query parameters.
+func parsePageParams(q url.Values) (int, *database.PageToken, error) {
+	pageSize := defaultPageSize
+	if v := q.Get("pageSize"); v != "" {
+		var err error
+		pageSize, err = strconv.Atoi(v)
+		if err != nil || pageSize < 1 {
+			return 0, nil, fmt.Errorf("invalid value for pageSize")
+		}
+
+		if pageSize > maxPageSize {
+			pageSize = maxPageSize
+		}
+	}
+
+	var token *database.PageToken
+	if v := q.Get("pageToken"); v != "" {
+		var err error
+		token, err = database.ParsePageToken(v)
+		if err != nil {
+			return 0, nil, err
+		}
+	}
+
+	return pageSize, token, nil
+}
+
+// applyPageParams applies the pageSize, pageToken, sort and order query
+// parameters to query.
+func applyPageParams(q url.Values, query *database.SearchQuery) error {
+	pageSize, token, err := parsePageParams(q)
+	if err != nil {
+		return err
+	}
+
+	field, err := database.ParseSortField(q.Get("sort"))
+	if err != nil {
+		return err
+	}
+
+	var ascending bool
+	switch q.Get("order") {
+	case "", "desc":
+	case "asc":
+		ascending = true
+	default:
+		return fmt.Errorf("invalid value for order, expected asc or desc")
+	}
+
+	if token != nil {
+		if err := token.Check(field, ascending); err != nil {
+			return err
+		}
+	}
+
+	query.
+		SortBy(field, ascending).
+		Paginate(pageSize, token)
+
+	return nil
+}
+
+// SearchCallLogsHandler is the paginated version of SearchCallLogs. Records may
+// be filtered using the date, from, to, customerId, inboundNumber and tag query
+// parameters and using the query language (see structs.CallLogModel) in the q
+// parameter. See applyPageParams for pagination and sorting.
+func (svc *CallService) SearchCallLogsHandler(w http.ResponseWriter, r *http.Request) {
+	query, err := searchQueryFromParams(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	svc.writeCallLogPage(w, r, query)
+}
+
+// searchQueryFromParams builds a search query from the q, customerId,
+// inboundNumber, tag, date, from and to query parameters.
+func searchQueryFromParams(q url.Values) (*database.SearchQuery, error) {
+	query := new(database.SearchQuery)
+
+	if ql := q.Get("q"); ql != "" {
+		if err := query.Query(ql); err != nil {
+			return nil, err
+		}
+	}
+
+	if id := q.Get("customerId"); id != "" {
+		query.Customer(id)
+	}
+
+	for _, n := range q["inboundNumber"] {
+		query.InboundNumberString(n)
+	}
+
+	for _, t := range q["tag"] {
+		query.Tag(t)
+	}
+
+	from, err := parseTimeParam(q, "from")
+	if err != nil {
+		return nil, err
+	}
+
+	to, err := parseTimeParam(q, "to")
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case !from.IsZero() && !to.IsZero():
+		query.Between(from, to)
+
+	case !from.IsZero():
+		query.After(from)
+
+	case !to.IsZero():
+		query.Before(to)
+
+	case q.Get("date") != "":
+		parsed, err := time.ParseInLocation("2006-01-02", q.Get("date"), time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for date: %w", err)
+		}
+		query.AtDate(parsed)
+	}
+
+	return query, nil
+}
+
+// GetLogsForCustomerHandler is the paginated version of GetLogsForCustomer. The
+// customer is identified by the id query parameter.
+func (svc *CallService) GetLogsForCustomerHandler(w http.ResponseWriter, r *http.Request) {
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		http.Error(w, "invalid or missing customer id", http.StatusBadRequest)
+		return
+	}
+
+	query := new(database.SearchQuery).
+		Customer(id)
+
+	svc.writeCallLogPage(w, r, query)
+}
+
+func (svc *CallService) writeCallLogPage(w http.ResponseWriter, r *http.Request, query *database.SearchQuery) {
+	if err := applyPageParams(r.URL.Query(), query); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := svc.CallLogDB.SearchPage(r.Context(), query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resolver := database.NewCustomerResolver(svc.CallLogDB, svc.Customer)
+
+	results, customers, err := resolver.Resolve(r.Context(), page.Results)
+	if len(results) == 0 && err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	svc.updateCallLogStatus(r.Context(), results)
+
+	res := CallLogPage{
+		Annotations:   callAnnotations(page.Results),
+		Timings:       callTimings(page.Results),
+		Total:         page.Total,
+		NextPageToken: page.NextPageToken,
+	}
+
+	if res.Results, err = protoJSON(results); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if res.Customers, err = protoJSON(customers); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, res)
+}
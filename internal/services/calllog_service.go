@@ -475,21 +475,12 @@ func (svc *CallService) updateCallLogStatus(ctx context.Context, logs []*pbx3cxv
 		return
 	}
 
-	// fetch all known phone extensions
-	extensions, err := svc.Extensions.ListPhoneExtensions(ctx)
+	internalQueues, err := svc.InternalQueues(ctx)
 	if err != nil {
 		log.L(ctx).Error("failed to load phone-extensions", "error", err)
 		return
 	}
 
-	// find any "internal_queue" extensions and create a lookup map by extension
-	internalQueues := make(map[string]*pbx3cxv1.PhoneExtension, len(extensions))
-	for _, e := range extensions {
-		if e.InternalQueue {
-			internalQueues[e.Extension] = e
-		}
-	}
-
 	// range over the call logs and mark any call that "ended" in an internal_queue
 	// extension as lost
 	for _, l := range logs {
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/database"
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+)
+
+// defaultPercentiles are calculated if the statistics request does not
+// specify any percentiles.
+var defaultPercentiles = []float64{50, 90, 95}
+
+// CallStatisticsResponse is returned by the call statistics endpoint.
+type CallStatisticsResponse struct {
+	From     time.Time                `json:"from"`
+	To       time.Time                `json:"to"`
+	GroupBy  string                   `json:"groupBy,omitempty"`
+	Timezone string                   `json:"timezone"`
+	Total    *structs.CallStatistics  `json:"total"`
+	Groups   []structs.CallStatistics `json:"groups,omitempty"`
+}
+
+// CallStatisticsHandler returns call statistics over the time range specified
+// by the from and to query parameters. Statistics can be grouped by hour, day,
+// inboundNumber, queueExtension or agent using the groupBy parameter. Hours
+// and days use the timezone parameter (IANA name, defaults to the local
+// timezone). Duration percentiles can be selected using the percentiles
+// parameter (e.g. percentiles=50,90,99).
+func (svc *CallService) CallStatisticsHandler(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	from, err := parseTimeParam(q, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	to, err := parseTimeParam(q, "to")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	groupBy, err := database.ParseStatisticsGroupBy(q.Get("groupBy"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	loc, err := statisticsLocation(q.Get("timezone"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	percentiles := defaultPercentiles
+	if v := q.Get("percentiles"); v != "" {
+		percentiles = nil
+		for _, p := range strings.Split(v, ",") {
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+			if err != nil || parsed < 0 || parsed > 100 {
+				http.Error(w, fmt.Sprintf("invalid percentile %q", p), http.StatusBadRequest)
+				return
+			}
+
+			percentiles = append(percentiles, parsed)
+		}
+	}
+
+	// use the same status rules as the call-log API
+	internalQueues, err := svc.InternalQueueExtensions(r.Context())
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to load phone-extensions: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	query := database.StatisticsQuery{
+		From:           from,
+		To:             to,
+		GroupBy:        groupBy,
+		Location:       loc,
+		InternalQueues: internalQueues,
+		Percentiles:    percentiles,
+	}
+
+	total, groups, err := svc.CallLogDB.CallStatistics(r.Context(), query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, CallStatisticsResponse{
+		From:     from,
+		To:       to,
+		GroupBy:  string(groupBy),
+		Timezone: loc.String(),
+		Total:    total,
+		Groups:   groups,
+	})
+}
+
+// statisticsLocation returns the timezone used to group statistics by hour or
+// day. MongoDB requires an IANA timezone name so UTC is used if the local
+// timezone has no name.
+func statisticsLocation(name string) (*time.Location, error) {
+	if name == "" {
+		if time.Local.String() == "Local" {
+			return time.UTC, nil
+		}
+
+		return time.Local, nil
+	}
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", name, err)
+	}
+
+	return loc, nil
+}
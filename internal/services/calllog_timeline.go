@@ -0,0 +1,308 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/database"
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+	pbx3cxv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/pbx3cx/v1"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Timeline entry types.
+const (
+	TimelineCall      = "call"
+	TimelineVoiceMail = "voicemail"
+)
+
+// Callback states of timeline entries.
+const (
+	CallbackOpen = "open"
+	CallbackDone = "done"
+)
+
+type (
+	// TimelineEntry is either a call or a voicemail of a customer timeline.
+	// Call and VoiceMail are encoded using the protobuf JSON mapping of
+	// CallEntry and VoiceMail.
+	TimelineEntry struct {
+		Type      string          `json:"type"`
+		Time      time.Time       `json:"time"`
+		Call      json.RawMessage `json:"call,omitempty"`
+		VoiceMail json.RawMessage `json:"voicemail,omitempty"`
+		// Callback is set to CallbackOpen or CallbackDone for missed calls and
+		// voicemails that can be called back.
+		Callback   string            `json:"callback,omitempty"`
+		CalledBack *structs.Callback `json:"calledBack,omitempty"`
+
+		Notes []structs.CallNote `json:"notes,omitempty"`
+		Tags  []string           `json:"tags,omitempty"`
+
+		// Timing is set for calls, see CallTiming.
+		Timing *CallTiming `json:"timing,omitempty"`
+	}
+
+	// TimelinePage is a single page of a customer timeline. Customers are
+	// encoded using the protobuf JSON mapping of Customer.
+	TimelinePage struct {
+		Entries       []TimelineEntry   `json:"entries"`
+		Customers     []json.RawMessage `json:"customers,omitempty"`
+		NextPageToken string            `json:"nextPageToken,omitempty"`
+	}
+)
+
+// timelineItem is either a call-log or a voicemail record.
+type timelineItem struct {
+	time      time.Time
+	id        primitive.ObjectID
+	call      *structs.CallLog
+	voicemail *structs.VoiceMail
+}
+
+// newerThan reports whether i is sorted before other in a timeline.
+func (i timelineItem) newerThan(other timelineItem) bool {
+	if !i.time.Equal(other.time) {
+		return i.time.After(other.time)
+	}
+
+	return i.id.Hex() > other.id.Hex()
+}
+
+// CustomerTimelineHandler returns the calls and voicemails of the customer
+// identified by the customerId query parameter and/or of the phoneNumber query
+// parameter, newest first. Missed calls and voicemails include whether the
+// caller has been called back. Use the nextPageToken of the result as the
+// pageToken parameter to retrieve the next page.
+func (svc *CallService) CustomerTimelineHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	q := r.URL.Query()
+
+	subject := database.DataSubject{
+		CustomerID:   q.Get("customerId"),
+		PhoneNumbers: phoneNumberFormats(q.Get("phoneNumber"), svc.Config.Country),
+	}
+
+	if subject.CustomerID == "" && len(subject.PhoneNumbers) == 0 {
+		http.Error(w, "either customerId or phoneNumber is required", http.StatusBadRequest)
+		return
+	}
+
+	pageSize, token, err := parsePageParams(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// timelines are always sorted by date, newest first.
+	if token != nil {
+		if err := token.Check(database.SortByDate, false); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// fetch one more record of each type to know if there's a next page.
+	calls, err := svc.CallLogDB.FindTimelineCallLogs(ctx, subject, token, pageSize+1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	voicemails, err := svc.MailboxDatabase.FindTimelineVoiceMails(ctx, subject, token, pageSize+1)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	items := mergeTimeline(calls, voicemails)
+
+	res := TimelinePage{
+		Entries: make([]TimelineEntry, 0, min(len(items), pageSize)),
+	}
+
+	if len(items) > pageSize {
+		items = items[:pageSize]
+
+		last := items[len(items)-1]
+		res.NextPageToken = (&database.PageToken{
+			Value: primitive.NewDateTimeFromTime(last.time),
+			ID:    last.id,
+			Sort:  database.SortByDate,
+		}).String()
+	}
+
+	var pageCalls []structs.CallLog
+	for _, item := range items {
+		if item.call != nil {
+			pageCalls = append(pageCalls, *item.call)
+		}
+	}
+
+	resolver := database.NewCustomerResolver(svc.CallLogDB, svc.Customer)
+
+	entries, customers, err := resolver.Resolve(ctx, pageCalls)
+	if len(entries) == 0 && len(pageCalls) > 0 && err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	svc.updateCallLogStatus(ctx, entries)
+
+	callBlobs, err := protoJSON(entries)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if res.Customers, err = protoJSON(customers); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	callbacks, err := svc.findVoiceMailCallbacks(ctx, items)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	callIdx := 0
+	for _, item := range items {
+		entry := TimelineEntry{
+			Time: item.time,
+		}
+
+		if item.call != nil {
+			// entries holds the calls in the same order as pageCalls.
+			if callIdx >= len(entries) {
+				http.Error(w, fmt.Sprintf("failed to resolve call %s", item.id.Hex()), http.StatusInternalServerError)
+				return
+			}
+
+			pb := entries[callIdx]
+			entry.Call = callBlobs[callIdx]
+			callIdx++
+
+			entry.Type = TimelineCall
+			entry.Notes = item.call.Notes
+			entry.Tags = item.call.Tags
+			entry.Timing = callTiming(*item.call)
+
+			if pb.Status == pbx3cxv1.CallStatus_CALL_STATUS_MISSED && canCallBack(item.call.Caller) {
+				entry.Callback = CallbackOpen
+				if item.call.CalledBack != nil {
+					entry.Callback = CallbackDone
+					entry.CalledBack = item.call.CalledBack
+				}
+			}
+		} else {
+			vm := item.voicemail
+
+			entry.Type = TimelineVoiceMail
+
+			if canCallBack(vm.Caller) {
+				entry.Callback = CallbackOpen
+
+				if callback := firstCallback(callbacks, phoneNumberFormats(vm.Caller, svc.Config.Country), vm.ReceiveTime); callback != nil {
+					entry.Callback = CallbackDone
+					entry.CalledBack = &structs.Callback{
+						CallID:      callback.ID,
+						Time:        callback.Date,
+						Agent:       callback.Agent,
+						AgentUserId: callback.AgentUserId,
+					}
+				}
+			}
+
+			blobs, err := protoJSON([]*pbx3cxv1.VoiceMail{vm.ToProto()})
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			entry.VoiceMail = blobs[0]
+		}
+
+		res.Entries = append(res.Entries, entry)
+	}
+
+	writeJSON(w, r, http.StatusOK, res)
+}
+
+// findVoiceMailCallbacks returns all outbound calls to the callers of the
+// voicemails in items that have been made after the oldest of them.
+func (svc *CallService) findVoiceMailCallbacks(ctx context.Context, items []timelineItem) ([]structs.CallLog, error) {
+	var (
+		numbers []string
+		after   time.Time
+	)
+
+	for _, item := range items {
+		if item.voicemail == nil || !canCallBack(item.voicemail.Caller) {
+			continue
+		}
+
+		for _, n := range phoneNumberFormats(item.voicemail.Caller, svc.Config.Country) {
+			if !slices.Contains(numbers, n) {
+				numbers = append(numbers, n)
+			}
+		}
+
+		if after.IsZero() || item.time.Before(after) {
+			after = item.time
+		}
+	}
+
+	return svc.CallLogDB.FindCallbacks(ctx, numbers, after)
+}
+
+// firstCallback returns the first call of callbacks, sorted oldest first,
+// to one of numbers after the given time or nil if there is none.
+func firstCallback(callbacks []structs.CallLog, numbers []string, after time.Time) *structs.CallLog {
+	for idx := range callbacks {
+		if callbacks[idx].Date.After(after) && slices.Contains(numbers, callbacks[idx].Caller) {
+			return &callbacks[idx]
+		}
+	}
+
+	return nil
+}
+
+// mergeTimeline merges calls and voicemails, both sorted newest first, into
+// a single timeline.
+func mergeTimeline(calls []structs.CallLog, voicemails []structs.VoiceMail) []timelineItem {
+	result := make([]timelineItem, 0, len(calls)+len(voicemails))
+
+	i, j := 0, 0
+	for i < len(calls) || j < len(voicemails) {
+		var call, vm timelineItem
+
+		if i < len(calls) {
+			call = timelineItem{time: calls[i].Date, id: calls[i].ID, call: &calls[i]}
+		}
+
+		if j < len(voicemails) {
+			vm = timelineItem{time: voicemails[j].ReceiveTime, id: voicemails[j].ID, voicemail: &voicemails[j]}
+		}
+
+		switch {
+		case vm.voicemail == nil, call.call != nil && call.newerThan(vm):
+			result = append(result, call)
+			i++
+		default:
+			result = append(result, vm)
+			j++
+		}
+	}
+
+	return result
+}
+
+// canCallBack reports whether caller is a number that can be called back.
+func canCallBack(caller string) bool {
+	return caller != "" && !strings.EqualFold(caller, "anonymous")
+}
@@ -0,0 +1,126 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func Test_mergeTimeline(t *testing.T) {
+	base := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	id := func(n byte) primitive.ObjectID {
+		var oid primitive.ObjectID
+		oid[len(oid)-1] = n
+
+		return oid
+	}
+
+	call := func(n byte, minutes int) structs.CallLog {
+		return structs.CallLog{ID: id(n), Date: base.Add(time.Duration(minutes) * time.Minute)}
+	}
+
+	voicemail := func(n byte, minutes int) structs.VoiceMail {
+		return structs.VoiceMail{ID: id(n), ReceiveTime: base.Add(time.Duration(minutes) * time.Minute)}
+	}
+
+	cases := []struct {
+		Name       string
+		Calls      []structs.CallLog
+		VoiceMails []structs.VoiceMail
+		// E holds the expected IDs, calls are prefixed with "c" and
+		// voicemails with "v".
+		E []string
+	}{
+		{
+			Name: "empty",
+			E:    []string{},
+		},
+		{
+			Name:  "calls only",
+			Calls: []structs.CallLog{call(2, 20), call(1, 10)},
+			E:     []string{"c2", "c1"},
+		},
+		{
+			Name:       "voicemails only",
+			VoiceMails: []structs.VoiceMail{voicemail(2, 20), voicemail(1, 10)},
+			E:          []string{"v2", "v1"},
+		},
+		{
+			Name:       "interleaved",
+			Calls:      []structs.CallLog{call(4, 40), call(2, 20)},
+			VoiceMails: []structs.VoiceMail{voicemail(5, 50), voicemail(3, 30), voicemail(1, 10)},
+			E:          []string{"v5", "c4", "v3", "c2", "v1"},
+		},
+		{
+			Name:       "same time sorted by ID",
+			Calls:      []structs.CallLog{call(1, 10)},
+			VoiceMails: []structs.VoiceMail{voicemail(2, 10)},
+			E:          []string{"v2", "c1"},
+		},
+		{
+			Name:       "same time call first",
+			Calls:      []structs.CallLog{call(3, 10)},
+			VoiceMails: []structs.VoiceMail{voicemail(2, 10)},
+			E:          []string{"c3", "v2"},
+		},
+	}
+
+	for _, c := range cases {
+		items := mergeTimeline(c.Calls, c.VoiceMails)
+
+		got := make([]string, len(items))
+		for idx, item := range items {
+			prefix := "v"
+			if item.call != nil {
+				prefix = "c"
+			}
+
+			got[idx] = fmt.Sprintf("%s%d", prefix, item.id[len(item.id)-1])
+		}
+
+		if len(got) != len(c.E) {
+			t.Errorf("%s: unexpected result %v, expected %v", c.Name, got, c.E)
+			continue
+		}
+
+		for idx := range got {
+			if got[idx] != c.E[idx] {
+				t.Errorf("%s: unexpected result %v, expected %v", c.Name, got, c.E)
+				break
+			}
+		}
+	}
+}
+
+func Test_firstCallback(t *testing.T) {
+	base := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+
+	callbacks := []structs.CallLog{
+		{Caller: "+43 664 1234567", Date: base.Add(time.Minute)},
+		{Caller: "+43 664 7654321", Date: base.Add(2 * time.Minute)},
+		{Caller: "+43 664 1234567", Date: base.Add(3 * time.Minute)},
+	}
+
+	cases := []struct {
+		Name    string
+		Numbers []string
+		After   time.Time
+		E       *structs.CallLog
+	}{
+		{"first match", []string{"06641234567", "+43 664 1234567"}, base, &callbacks[0]},
+		{"after the first match", []string{"+43 664 1234567"}, base.Add(time.Minute), &callbacks[2]},
+		{"other number", []string{"+43 664 7654321"}, base, &callbacks[1]},
+		{"no match", []string{"+43 1 2345"}, base, nil},
+		{"too late", []string{"+43 664 1234567"}, base.Add(3 * time.Minute), nil},
+	}
+
+	for _, c := range cases {
+		if res := firstCallback(callbacks, c.Numbers, c.After); res != c.E {
+			t.Errorf("%s: unexpected result %v, expected %v", c.Name, res, c.E)
+		}
+	}
+}
@@ -0,0 +1,201 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/cdr"
+	"github.com/tierklinik-dobersberg/3cx-support/internal/database"
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type (
+	// EditDeadLetterRequest changes a dead letter before it's retried. Set
+	// changes single columns by field name while Columns replaces all columns.
+	EditDeadLetterRequest struct {
+		Columns []string          `json:"columns,omitempty"`
+		Fields  []string          `json:"fields,omitempty"`
+		Version string            `json:"version,omitempty"`
+		Set     map[string]string `json:"set,omitempty"`
+	}
+
+	// RetryDeadLettersRequest selects dead letters for retry. If IDs is empty,
+	// all dead letters are retried.
+	RetryDeadLettersRequest struct {
+		IDs []string `json:"ids,omitempty"`
+	}
+)
+
+// ListDeadLetters returns all dead letters. They can be filtered using the
+// outcome query parameter.
+func (svc *CDRService) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	query := new(database.DeadLetterQuery)
+	for _, o := range r.URL.Query()["outcome"] {
+		query.Outcome(structs.CDROutcome(o))
+	}
+
+	result, err := svc.providers.DeadLetters.FindDeadLetters(r.Context(), query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, result)
+}
+
+// DeadLetterHandler returns (GET), edits (PUT) or discards (DELETE) the dead
+// letter identified by the id query parameter.
+func (svc *CDRService) DeadLetterHandler(w http.ResponseWriter, r *http.Request) {
+	dl, err := svc.providers.DeadLetters.GetDeadLetter(r.Context(), r.URL.Query().Get("id"))
+	if err != nil {
+		if errors.Is(err, database.ErrNotFound) {
+			http.Error(w, "dead letter not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeJSON(w, r, http.StatusOK, dl)
+
+	case http.MethodPut:
+		var req EditDeadLetterRequest
+		if err := readJSON(r, &req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := editDeadLetter(dl, req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if err := svc.providers.DeadLetters.UpdateDeadLetter(r.Context(), dl); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, r, http.StatusOK, dl)
+
+	case http.MethodDelete:
+		if err := svc.providers.DeadLetters.DeleteDeadLetter(r.Context(), dl.ID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func editDeadLetter(dl *structs.DeadLetter, req EditDeadLetterRequest) error {
+	if dl.CDR.OriginalColumns == nil {
+		dl.CDR.OriginalColumns = append([]string{}, dl.CDR.Columns...)
+	}
+
+	if req.Version != "" {
+		if _, err := cdr.ParserForVersion(req.Version); err != nil {
+			return err
+		}
+
+		dl.CDR.Version = req.Version
+	}
+
+	if len(req.Fields) > 0 {
+		if _, err := cdr.ParseFieldOrder(req.Fields); err != nil {
+			return err
+		}
+
+		dl.CDR.Fields = req.Fields
+	}
+
+	if len(req.Columns) > 0 {
+		dl.CDR.Columns = req.Columns
+	}
+
+	fields := dl.CDR.Fields
+	if len(fields) == 0 {
+		fields = cdr.DefaultFieldNames(dl.CDR.Version)
+	}
+
+	for name, value := range req.Set {
+		idx := -1
+		for i, f := range fields {
+			if strings.EqualFold(f, name) {
+				idx = i
+				break
+			}
+		}
+
+		if idx < 0 || idx >= len(dl.CDR.Columns) {
+			return fmt.Errorf("unknown field %q", name)
+		}
+
+		dl.CDR.Columns[idx] = value
+	}
+
+	return nil
+}
+
+// RetryDeadLetters processes the selected dead letters again. Dead letters that
+// are processed successfully are removed.
+func (svc *CDRService) RetryDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RetryDeadLettersRequest
+	if err := readJSON(r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := new(database.DeadLetterQuery)
+	for _, id := range req.IDs {
+		oid, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid id %q: %s", id, err), http.StatusBadRequest)
+			return
+		}
+
+		query.ID(oid)
+	}
+
+	dls, err := svc.providers.DeadLetters.FindDeadLetters(r.Context(), query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	l := slog.Default().With("subsystem", "cdr-dead-letters")
+
+	res := ReplayCDRResponse{
+		Results: make([]ReplayCDRResult, 0, len(dls)),
+	}
+
+	for idx := range dls {
+		row := &dls[idx].CDR
+
+		if err := svc.processor.Replay(r.Context(), row, l); err != nil {
+			l.Error("failed to retry dead letter", "id", row.ID.Hex(), "error", err)
+		}
+
+		res.Results = append(res.Results, ReplayCDRResult{
+			ID:      row.ID.Hex(),
+			Outcome: row.Outcome,
+			Error:   row.Error,
+		})
+	}
+
+	writeJSON(w, r, http.StatusOK, res)
+}
@@ -0,0 +1,345 @@
+package services
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/cdr"
+	"github.com/tierklinik-dobersberg/3cx-support/internal/config"
+	"github.com/tierklinik-dobersberg/3cx-support/internal/database"
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CDRService provides HTTP endpoints to inspect and replay archived
+// call-data-records.
+type CDRService struct {
+	providers *config.Providers
+	processor *cdr.ProcessorImpl
+	queue     *cdr.Queue
+	listener  *cdr.ListeningServer
+}
+
+// NewCDRService returns a new CDRService. queue may be nil if the CDR socket
+// is disabled and listener may be nil if CDR_MODE is not ACTIVE.
+func NewCDRService(providers *config.Providers, processor *cdr.ProcessorImpl, queue *cdr.Queue, listener *cdr.ListeningServer) *CDRService {
+	return &CDRService{
+		providers: providers,
+		processor: processor,
+		queue:     queue,
+		listener:  listener,
+	}
+}
+
+type (
+	// ReplayCDRRequest selects archived call-data-records for replay. If no
+	// ID and no outcome is specified, all failed records are selected.
+	ReplayCDRRequest struct {
+		IDs      []string             `json:"ids,omitempty"`
+		Outcomes []structs.CDROutcome `json:"outcomes,omitempty"`
+		From     time.Time            `json:"from,omitempty"`
+		To       time.Time            `json:"to,omitempty"`
+	}
+
+	ReplayCDRResult struct {
+		ID      string             `json:"id"`
+		Outcome structs.CDROutcome `json:"outcome"`
+		Error   string             `json:"error,omitempty"`
+	}
+
+	ReplayCDRResponse struct {
+		Results []ReplayCDRResult `json:"results"`
+	}
+
+	// ImportCDRSummary summarizes the result of a CDR import.
+	ImportCDRSummary struct {
+		Total      int `json:"total"`
+		Imported   int `json:"imported"`
+		Duplicates int `json:"duplicates"`
+		Failed     int `json:"failed"`
+	}
+
+	// ImportCDRLine is streamed as newline delimited JSON for each row that
+	// failed to import. The last line only holds the import summary.
+	ImportCDRLine struct {
+		Row     int                `json:"row,omitempty"`
+		Outcome structs.CDROutcome `json:"outcome,omitempty"`
+		Error   string             `json:"error,omitempty"`
+		Summary *ImportCDRSummary  `json:"summary,omitempty"`
+	}
+)
+
+// failedOutcomes holds all outcomes of call-data-records that did not result in
+// a call-log record.
+var failedOutcomes = []structs.CDROutcome{
+	structs.CDROutcomeParseFailed,
+	structs.CDROutcomeConvertFailed,
+	structs.CDROutcomeRecordFailed,
+}
+
+func buildCDRQuery(ids []string, outcomes []structs.CDROutcome, from, to time.Time) (*database.CDRQuery, error) {
+	query := new(database.CDRQuery)
+
+	for _, id := range ids {
+		oid, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid id %q: %w", id, err)
+		}
+
+		query.ID(oid)
+	}
+
+	for _, o := range outcomes {
+		query.Outcome(o)
+	}
+
+	if !from.IsZero() {
+		query.After(from)
+	}
+
+	if !to.IsZero() {
+		query.Before(to)
+	}
+
+	return query, nil
+}
+
+// ListArchivedCDRs returns archived call-data-records. Records can be filtered using
+// the id, outcome, from and to query parameters.
+func (svc *CDRService) ListArchivedCDRs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+
+	from, err := parseTimeParam(q, "from")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	to, err := parseTimeParam(q, "to")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var outcomes []structs.CDROutcome
+	for _, o := range q["outcome"] {
+		outcomes = append(outcomes, structs.CDROutcome(o))
+	}
+
+	query, err := buildCDRQuery(q["id"], outcomes, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := svc.providers.CDRArchive.FindCDRs(r.Context(), query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, rows)
+}
+
+// QueueStats returns statistics about the CDR ingestion queue.
+func (svc *CDRService) QueueStats(w http.ResponseWriter, r *http.Request) {
+	var stats cdr.QueueStats
+	if svc.queue != nil {
+		stats = svc.queue.Stats()
+	}
+
+	writeJSON(w, r, http.StatusOK, stats)
+}
+
+// ListenerStats returns statistics about the CDR listening server like the
+// number of rejected peers.
+func (svc *CDRService) ListenerStats(w http.ResponseWriter, r *http.Request) {
+	var stats cdr.ListenerStats
+	if svc.listener != nil {
+		stats = svc.listener.Stats()
+	}
+
+	writeJSON(w, r, http.StatusOK, stats)
+}
+
+// ReplayCDRs re-runs the selected archived call-data-records through the CDR
+// processor.
+func (svc *CDRService) ReplayCDRs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ReplayCDRRequest
+	if err := readJSON(r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	outcomes := req.Outcomes
+	if len(req.IDs) == 0 && len(outcomes) == 0 {
+		outcomes = failedOutcomes
+	}
+
+	query, err := buildCDRQuery(req.IDs, outcomes, req.From, req.To)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rows, err := svc.providers.CDRArchive.FindCDRs(r.Context(), query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	l := slog.Default().With("subsystem", "cdr-replay")
+	l.Info("replaying call-data-records", "count", len(rows))
+
+	res := ReplayCDRResponse{
+		Results: make([]ReplayCDRResult, 0, len(rows)),
+	}
+
+	for idx := range rows {
+		row := &rows[idx]
+
+		if err := svc.processor.Replay(r.Context(), row, l); err != nil {
+			l.Error("failed to replay call-data-record", "id", row.ID.Hex(), "error", err)
+		}
+
+		res.Results = append(res.Results, ReplayCDRResult{
+			ID:      row.ID.Hex(),
+			Outcome: row.Outcome,
+			Error:   row.Error,
+		})
+	}
+
+	writeJSON(w, r, http.StatusOK, res)
+}
+
+// ImportCDRs imports a 3CX CDR CSV export sent as the request body. The CSV
+// field order may be specified using the "fields" query parameter, otherwise
+// a header row is detected or the configured field order is used. The CDR
+// format version may be specified using the "version" query parameter. Rows that
+// already have a matching call-log record are skipped.
+// The result is streamed as newline delimited JSON, see ImportCDRLine.
+func (svc *CDRService) ImportCDRs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	q := r.URL.Query()
+
+	var order []cdr.Field
+	if fields := q.Get("fields"); fields != "" {
+		var err error
+		order, err = cdr.ParseFieldOrder(strings.Split(fields, ","))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	version := q.Get("version")
+	if version != "" {
+		if _, err := cdr.ParserForVersion(version); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	name := q.Get("name")
+	if name == "" {
+		name = "upload"
+	}
+
+	l := slog.Default().With("subsystem", "cdr-import", "name", name)
+	ctx := cdr.WithPeer(r.Context(), "import:"+name)
+
+	csvReader := csv.NewReader(bufio.NewReader(r.Body))
+	csvReader.FieldsPerRecord = -1
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+
+	var (
+		summary ImportCDRSummary
+		rowNum  int
+	)
+
+	for {
+		line, err := csvReader.Read()
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				l.Error("failed to read CDR export", "error", err)
+
+				enc.Encode(ImportCDRLine{
+					Row:     rowNum + 1,
+					Outcome: structs.CDROutcomeParseFailed,
+					Error:   err.Error(),
+				})
+			}
+
+			break
+		}
+
+		rowNum++
+
+		if rowNum == 1 && order == nil {
+			if detected, ok := cdr.DetectFieldOrder(line); ok {
+				l.Info("using CDR field order from header row", "fields", line)
+				order = detected
+
+				continue
+			}
+		}
+
+		summary.Total++
+
+		row := svc.processor.Import(ctx, line, order, version, l)
+
+		switch row.Outcome {
+		case structs.CDROutcomeSuccess:
+			summary.Imported++
+
+			continue
+		case structs.CDROutcomeDuplicate:
+			summary.Duplicates++
+
+			continue
+		default:
+			summary.Failed++
+		}
+
+		if err := enc.Encode(ImportCDRLine{
+			Row:     rowNum,
+			Outcome: row.Outcome,
+			Error:   row.Error,
+		}); err != nil {
+			l.Error("failed to write import result, aborting", "error", err)
+			return
+		}
+
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+
+	l.Info("CDR import finished", "total", summary.Total, "imported", summary.Imported, "duplicates", summary.Duplicates, "failed", summary.Failed)
+
+	enc.Encode(ImportCDRLine{
+		Summary: &summary,
+	})
+}
@@ -0,0 +1,263 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/cdr"
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+)
+
+// maxWebhookBodySize is the maximum size of a CDR batch accepted by the webhook.
+const maxWebhookBodySize = 10 << 20
+
+type (
+	// CDRBatch is the JSON body accepted by the CDR webhook. Rows holds CSV
+	// style rows using the field order in Fields (or the configured field
+	// order if empty). Records holds rows as objects indexed by field name.
+	CDRBatch struct {
+		Fields  []string            `json:"fields,omitempty"`
+		Version string              `json:"version,omitempty"`
+		Rows    [][]string          `json:"rows,omitempty"`
+		Records []map[string]string `json:"records,omitempty"`
+	}
+
+	CDRWebhookResult struct {
+		Row      int                `json:"row"`
+		Accepted bool               `json:"accepted"`
+		Outcome  structs.CDROutcome `json:"outcome"`
+		Error    string             `json:"error,omitempty"`
+	}
+
+	CDRWebhookResponse struct {
+		Accepted int                `json:"accepted"`
+		Rejected int                `json:"rejected"`
+		Results  []CDRWebhookResult `json:"results"`
+	}
+)
+
+// webhookRow is a single CDR row of a webhook batch. If err is set, the row
+// is rejected without being processed.
+type webhookRow struct {
+	columns []string
+	order   []cdr.Field
+	err     error
+}
+
+// CDRWebhook accepts batches of call-data-records as CSV (text/csv) or JSON
+// (application/json, see CDRBatch) and passes each row to the CDR queue so
+// rows are processed in order with rows of the same call received from the
+// CDR socket. For CSV batches, the field order and the CDR format version may
+// be specified using the "fields" and "version" query parameters or a header
+// row. Requests must be authenticated using the configured webhook token as
+// a bearer token.
+func (svc *CDRService) CDRWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if !svc.webhookAuthorized(r) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxWebhookBodySize)
+
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+
+	var (
+		rows    []webhookRow
+		version string
+		err     error
+	)
+
+	switch contentType {
+	case "application/json":
+		rows, version, err = readWebhookJSON(r)
+	case "text/csv", "text/plain", "":
+		rows, version, err = readWebhookCSV(r)
+	default:
+		http.Error(w, "unsupported content type "+contentType, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if version != "" {
+		if _, err := cdr.ParserForVersion(version); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	l := slog.Default().With("subsystem", "cdr-webhook", "peer", r.RemoteAddr)
+	ctx := cdr.WithPeer(r.Context(), r.RemoteAddr)
+
+	res := CDRWebhookResponse{
+		Results: make([]CDRWebhookResult, 0, len(rows)),
+	}
+
+	for idx, row := range rows {
+		result := CDRWebhookResult{
+			Row:     idx + 1,
+			Outcome: structs.CDROutcomeParseFailed,
+		}
+
+		if row.err != nil {
+			result.Error = row.err.Error()
+		} else if raw, err := svc.ingest(ctx, row, version, l); err != nil {
+			result.Outcome = structs.CDROutcomeRecordFailed
+			result.Error = err.Error()
+		} else {
+			result.Accepted = raw.Outcome == structs.CDROutcomeSuccess
+			result.Outcome = raw.Outcome
+			result.Error = raw.Error
+		}
+
+		if result.Accepted {
+			res.Accepted++
+		} else {
+			res.Rejected++
+		}
+
+		res.Results = append(res.Results, result)
+	}
+
+	l.Info("processed CDR batch", "accepted", res.Accepted, "rejected", res.Rejected)
+
+	writeJSON(w, r, http.StatusOK, res)
+}
+
+// ingest processes a webhook row using the CDR queue, if any, and returns the
+// processed row.
+func (svc *CDRService) ingest(ctx context.Context, row webhookRow, version string, l *slog.Logger) (*structs.RawCDR, error) {
+	if svc.queue == nil {
+		return svc.processor.Ingest(ctx, row.columns, row.order, version, l), nil
+	}
+
+	return svc.queue.Ingest(ctx, row.columns, row.order, version, l)
+}
+
+func (svc *CDRService) webhookAuthorized(r *http.Request) bool {
+	expected := svc.providers.Config.CDRWebhookToken
+
+	// the webhook is disabled if no token is configured
+	if expected == "" {
+		return false
+	}
+
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+
+	token := strings.TrimPrefix(auth, "Bearer ")
+
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
+
+func readWebhookCSV(r *http.Request) ([]webhookRow, string, error) {
+	q := r.URL.Query()
+
+	var order []cdr.Field
+	if fields := q.Get("fields"); fields != "" {
+		var err error
+		order, err = cdr.ParseFieldOrder(strings.Split(fields, ","))
+		if err != nil {
+			return nil, "", err
+		}
+	}
+
+	csvReader := csv.NewReader(bufio.NewReader(r.Body))
+	csvReader.FieldsPerRecord = -1
+
+	var rows []webhookRow
+	for {
+		line, err := csvReader.Read()
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			return nil, "", err
+		}
+
+		if len(rows) == 0 && order == nil {
+			if detected, ok := cdr.DetectFieldOrder(line); ok {
+				order = detected
+
+				continue
+			}
+		}
+
+		rows = append(rows, webhookRow{
+			columns: line,
+			order:   order,
+		})
+	}
+
+	return rows, q.Get("version"), nil
+}
+
+func readWebhookJSON(r *http.Request) ([]webhookRow, string, error) {
+	var batch CDRBatch
+	if err := readJSON(r, &batch); err != nil {
+		return nil, "", err
+	}
+
+	order, err := cdr.ParseFieldOrder(batch.Fields)
+	if err != nil {
+		return nil, "", err
+	}
+
+	rows := make([]webhookRow, 0, len(batch.Rows)+len(batch.Records))
+	for _, columns := range batch.Rows {
+		rows = append(rows, webhookRow{
+			columns: columns,
+			order:   order,
+		})
+	}
+
+	for _, record := range batch.Records {
+		names := make([]string, 0, len(record))
+		for name := range record {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		recordOrder, ok := cdr.DetectFieldOrder(names)
+		if !ok {
+			rows = append(rows, webhookRow{
+				err: fmt.Errorf("invalid field names %v", names),
+			})
+
+			continue
+		}
+
+		columns := make([]string, len(names))
+		for i, name := range names {
+			columns[i] = record[name]
+		}
+
+		rows = append(rows, webhookRow{
+			columns: columns,
+			order:   recordOrder,
+		})
+	}
+
+	return rows, batch.Version, nil
+}
@@ -0,0 +1,440 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bufbuild/connect-go"
+	"github.com/nyaruka/phonenumbers"
+	"github.com/tierklinik-dobersberg/3cx-support/internal/database"
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+	customerv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/customer/v1"
+	pbx3cxv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/pbx3cx/v1"
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DataSubjectEraseRequest selects the customer or phone number whose records
+// should be removed. Mode is either "erase" (the default) or "anonymize".
+type DataSubjectEraseRequest struct {
+	CustomerID  string `json:"customerId,omitempty"`
+	PhoneNumber string `json:"phoneNumber,omitempty"`
+	Mode        string `json:"mode,omitempty"`
+}
+
+// dataSubjectRecords holds all records of a data-subject request.
+type dataSubjectRecords struct {
+	calls       []structs.CallLog
+	voicemails  []structs.VoiceMail
+	cdrs        []structs.RawCDR
+	deadLetters []structs.DeadLetter
+}
+
+// DataSubjectExportHandler exports all call-logs, voicemails, voicemail
+// recordings, raw call-data-records and dead letters of the customer or
+// phone number specified using the customerId or phoneNumber query
+// parameters as a ZIP archive. Each export is recorded in the data-subject
+// audit log.
+func (svc *CallService) DataSubjectExportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	remoteUser := remoteUserFrom(r.Context())
+	if remoteUser == nil {
+		http.Error(w, "missing remote user", http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	audit := newDataSubjectAudit(remoteUser.ID, structs.DataSubjectExport, q.Get("customerId"), q.Get("phoneNumber"))
+
+	records, err := svc.findDataSubjectRecords(r, audit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	voicemails := records.voicemails
+
+	protoVoicemails := make([]*pbx3cxv1.VoiceMail, len(voicemails))
+	for idx, vm := range voicemails {
+		protoVoicemails[idx] = vm.ToProto()
+	}
+
+	voicemailBlobs, err := protoJSON(protoVoicemails)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("data-subject-%s.zip", audit.Time.Format("20060102-150405"))))
+	w.WriteHeader(http.StatusOK)
+
+	archive := zip.NewWriter(w)
+
+	for _, file := range []struct {
+		name string
+		v    any
+	}{
+		{"call-logs.json", records.calls},
+		{"voicemails.json", voicemailBlobs},
+		{"raw-cdrs.json", records.cdrs},
+		{"dead-letters.json", records.deadLetters},
+	} {
+		if err := writeZipJSON(archive, file.name, file.v); err != nil {
+			audit.Errors = append(audit.Errors, err.Error())
+		}
+	}
+
+	for _, vm := range voicemails {
+		if vm.FileName == "" {
+			continue
+		}
+
+		name := "recordings/" + vm.ID.Hex() + filepath.Ext(vm.FileName)
+		if err := writeZipFile(archive, name, vm.FileName); err != nil {
+			audit.Errors = append(audit.Errors, err.Error())
+			continue
+		}
+
+		audit.Recordings = append(audit.Recordings, vm.FileName)
+	}
+
+	if err := archive.Close(); err != nil {
+		audit.Errors = append(audit.Errors, fmt.Sprintf("failed to finish archive: %s", err))
+	}
+
+	if err := svc.DataSubjectAudit.CreateDataSubjectAudit(r.Context(), audit); err != nil {
+		log.L(r.Context()).Error("failed to store data-subject audit record", "error", err)
+	}
+}
+
+// DataSubjectEraseHandler erases or anonymizes all call-logs and voicemails
+// of a customer or phone number (see DataSubjectEraseRequest) and removes
+// the voicemail recordings, raw call-data-records and dead letters. It
+// responds with the audit record of the request.
+func (svc *CallService) DataSubjectEraseHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	remoteUser := remoteUserFrom(r.Context())
+	if remoteUser == nil {
+		http.Error(w, "missing remote user", http.StatusUnauthorized)
+		return
+	}
+
+	var req DataSubjectEraseRequest
+	if err := readJSON(r, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch req.Mode {
+	case "", structs.DataSubjectErase:
+		req.Mode = structs.DataSubjectErase
+	case structs.DataSubjectAnonymize:
+	default:
+		http.Error(w, fmt.Sprintf("invalid mode %q", req.Mode), http.StatusBadRequest)
+		return
+	}
+
+	audit := newDataSubjectAudit(remoteUser.ID, req.Mode, req.CustomerID, req.PhoneNumber)
+
+	records, err := svc.findDataSubjectRecords(r, audit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+
+	for _, vm := range records.voicemails {
+		if vm.FileName == "" {
+			continue
+		}
+
+		if err := svc.removeRecording(vm.FileName); err != nil {
+			audit.Errors = append(audit.Errors, err.Error())
+			continue
+		}
+
+		audit.Recordings = append(audit.Recordings, vm.FileName)
+	}
+
+	if req.Mode == structs.DataSubjectAnonymize {
+		_, err = svc.CallLogDB.AnonymizeCallLogs(ctx, audit.CallLogs)
+	} else {
+		_, err = svc.CallLogDB.DeleteCallLogs(ctx, audit.CallLogs)
+	}
+	if err != nil {
+		audit.Errors = append(audit.Errors, err.Error())
+	}
+
+	if req.Mode == structs.DataSubjectAnonymize {
+		_, err = svc.MailboxDatabase.AnonymizeVoiceMails(ctx, audit.VoiceMails)
+	} else {
+		_, err = svc.MailboxDatabase.DeleteVoiceMails(ctx, audit.VoiceMails)
+	}
+	if err != nil {
+		audit.Errors = append(audit.Errors, err.Error())
+	}
+
+	// raw call-data-records and dead letters are useless without the caller
+	// so they are deleted in both modes.
+	if _, err := svc.CDRArchive.DeleteCDRsByID(ctx, audit.RawCDRs); err != nil {
+		audit.Errors = append(audit.Errors, err.Error())
+	}
+
+	if _, err := svc.DeadLetters.DeleteDeadLettersByID(ctx, audit.DeadLetters); err != nil {
+		audit.Errors = append(audit.Errors, err.Error())
+	}
+
+	if err := svc.DataSubjectAudit.CreateDataSubjectAudit(ctx, audit); err != nil {
+		http.Error(w, fmt.Sprintf("failed to store audit record: %s", err), http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusOK
+	if len(audit.Errors) > 0 {
+		status = http.StatusInternalServerError
+	}
+
+	writeJSON(w, r, status, audit)
+}
+
+// DataSubjectAuditHandler returns all data-subject audit records.
+func (svc *CallService) DataSubjectAuditHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	result, err := svc.DataSubjectAudit.ListDataSubjectAudits(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, r, http.StatusOK, result)
+}
+
+func newDataSubjectAudit(actor, action, customerId, phoneNumber string) *structs.DataSubjectAudit {
+	return &structs.DataSubjectAudit{
+		Time:        time.Now(),
+		Action:      action,
+		Actor:       actor,
+		CustomerID:  customerId,
+		PhoneNumber: phoneNumber,
+		CallLogs:    []primitive.ObjectID{},
+		VoiceMails:  []primitive.ObjectID{},
+		RawCDRs:     []primitive.ObjectID{},
+		DeadLetters: []primitive.ObjectID{},
+		Recordings:  []string{},
+	}
+}
+
+// findDataSubjectRecords returns all records of the customer or phone number
+// of audit and adds their IDs to audit. Raw call-data-records and dead
+// letters are matched by the phone number and the callers of all matching
+// call-logs.
+func (svc *CallService) findDataSubjectRecords(r *http.Request, audit *structs.DataSubjectAudit) (*dataSubjectRecords, error) {
+	ctx := r.Context()
+
+	subject := database.DataSubject{
+		CustomerID:   audit.CustomerID,
+		PhoneNumbers: phoneNumberFormats(audit.PhoneNumber, svc.Config.Country),
+	}
+
+	if subject.IsZero() {
+		return nil, fmt.Errorf("either customerId or phoneNumber is required")
+	}
+
+	if subject.CustomerID != "" {
+		refs, err := svc.customerRefs(ctx, subject.CustomerID)
+		if err != nil {
+			return nil, err
+		}
+
+		subject.CustomerRefs = refs
+	}
+
+	var (
+		records = new(dataSubjectRecords)
+		err     error
+	)
+
+	if records.calls, err = svc.CallLogDB.FindDataSubjectCallLogs(ctx, subject); err != nil {
+		return nil, err
+	}
+
+	if records.voicemails, err = svc.MailboxDatabase.FindDataSubjectVoiceMails(ctx, subject); err != nil {
+		return nil, err
+	}
+
+	numbers := slices.Clone(subject.PhoneNumbers)
+	for _, c := range records.calls {
+		for _, n := range append(phoneNumberFormats(c.Caller, svc.Config.Country), c.RawCaller) {
+			if n != "" && !slices.Contains(numbers, n) {
+				numbers = append(numbers, n)
+			}
+		}
+	}
+
+	if records.cdrs, err = svc.CDRArchive.FindDataSubjectCDRs(ctx, numbers); err != nil {
+		return nil, err
+	}
+
+	if records.deadLetters, err = svc.DeadLetters.FindDataSubjectDeadLetters(ctx, numbers); err != nil {
+		return nil, err
+	}
+
+	for _, c := range records.calls {
+		audit.CallLogs = append(audit.CallLogs, c.ID)
+	}
+
+	for _, vm := range records.voicemails {
+		audit.VoiceMails = append(audit.VoiceMails, vm.ID)
+	}
+
+	for _, row := range records.cdrs {
+		audit.RawCDRs = append(audit.RawCDRs, row.ID)
+	}
+
+	for _, dl := range records.deadLetters {
+		audit.DeadLetters = append(audit.DeadLetters, dl.ID)
+	}
+
+	return records, nil
+}
+
+// customerRefs returns the internal references of the customer with the
+// given ID.
+func (svc *CallService) customerRefs(ctx context.Context, customerId string) ([]database.CustomerRef, error) {
+	res, err := svc.Customer.SearchCustomer(ctx, connect.NewRequest(&customerv1.SearchCustomerRequest{
+		Queries: []*customerv1.CustomerQuery{
+			{
+				Query: &customerv1.CustomerQuery_Id{
+					Id: customerId,
+				},
+			},
+		},
+	}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch customer record: %w", err)
+	}
+
+	var refs []database.CustomerRef
+	for _, c := range res.Msg.Results {
+		for _, state := range c.GetStates() {
+			if state.GetImporter() == "" || state.GetInternalReference() == "" {
+				continue
+			}
+
+			refs = append(refs, database.CustomerRef{
+				Source: state.GetImporter(),
+				ID:     state.GetInternalReference(),
+			})
+		}
+	}
+
+	return refs, nil
+}
+
+// removeRecording removes a voicemail recording. Only files within the
+// voicemail storage path are removed.
+func (svc *CallService) removeRecording(path string) error {
+	storage, err := filepath.Abs(svc.Config.VoiceMailStoragePath)
+	if err != nil {
+		return fmt.Errorf("failed to resolve storage path: %w", err)
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return fmt.Errorf("failed to resolve recording path %q: %w", path, err)
+	}
+
+	if !strings.HasPrefix(abs, storage+string(filepath.Separator)) {
+		return fmt.Errorf("recording %q is outside of the storage path", path)
+	}
+
+	if err := os.Remove(abs); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove recording %q: %w", path, err)
+	}
+
+	return nil
+}
+
+// phoneNumberFormats returns number in all formats it might be stored in.
+func phoneNumberFormats(number string, country string) []string {
+	if number == "" {
+		return nil
+	}
+
+	result := []string{number}
+
+	parsed, err := phonenumbers.Parse(number, country)
+	if err != nil {
+		return result
+	}
+
+	for _, format := range []phonenumbers.PhoneNumberFormat{
+		phonenumbers.INTERNATIONAL,
+		phonenumbers.NATIONAL,
+		phonenumbers.E164,
+	} {
+		if f := phonenumbers.Format(parsed, format); f != number {
+			result = append(result, f)
+		}
+	}
+
+	return result
+}
+
+func writeZipJSON(archive *zip.Writer, name string, v any) error {
+	f, err := archive.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to add %s to archive: %w", name, err)
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to encode %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func writeZipFile(archive *zip.Writer, name string, path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open recording %q: %w", path, err)
+	}
+	defer src.Close()
+
+	f, err := archive.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to add %s to archive: %w", name, err)
+	}
+
+	if _, err := io.Copy(f, src); err != nil {
+		return fmt.Errorf("failed to copy recording %q: %w", path, err)
+	}
+
+	return nil
+}
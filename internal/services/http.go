@@ -0,0 +1,70 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/tierklinik-dobersberg/apis/pkg/log"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// writeJSON encodes v as JSON and writes it to w using the given status code.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.L(r.Context()).Error("failed to encode JSON response", "error", err)
+	}
+}
+
+// readJSON decodes the JSON request body of r into v.
+func readJSON(r *http.Request, v any) error {
+	defer r.Body.Close()
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("failed to decode request body: %w", err)
+	}
+
+	return nil
+}
+
+// parseTimeParam parses the RFC3339 formatted query parameter name. The zero time is
+// returned if the parameter is not set.
+func parseTimeParam(query url.Values, name string) (time.Time, error) {
+	value := query.Get(name)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid value for %s: %w", name, err)
+	}
+
+	return t, nil
+}
+
+// protoJSON encodes msgs using the protobuf JSON mapping so they can be embedded
+// in plain JSON responses.
+func protoJSON[T proto.Message](msgs []T) ([]json.RawMessage, error) {
+	result := make([]json.RawMessage, len(msgs))
+
+	for idx, m := range msgs {
+		blob, err := protojson.Marshal(m)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode %T: %w", m, err)
+		}
+
+		result[idx] = blob
+	}
+
+	return result, nil
+}
@@ -87,6 +87,10 @@ func (svc *CallService) RecordCall(ctx context.Context, req *connect.Request[pbx
 		return nil, err
 	}
 
+	if err := svc.LinkCallbacks(ctx, &record); err != nil {
+		log.L(ctx).Error("failed to link callbacks", "error", err)
+	}
+
 	svc.Providers.PublishEvent(&pbx3cxv1.CallRecordReceived{
 		CallEntry: record.ToProto(),
 	}, false)
@@ -0,0 +1,32 @@
+package spreadsheet
+
+import (
+	"encoding/csv"
+	"io"
+)
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+// NewCSVWriter returns a Writer that writes comma-separated values.
+func NewCSVWriter(w io.Writer) Writer {
+	return &csvWriter{
+		w: csv.NewWriter(w),
+	}
+}
+
+func (cw *csvWriter) WriteRow(values ...any) error {
+	record := make([]string, len(values))
+	for idx, v := range values {
+		record[idx] = formatValue(v)
+	}
+
+	return cw.w.Write(record)
+}
+
+func (cw *csvWriter) Close() error {
+	cw.w.Flush()
+
+	return cw.w.Error()
+}
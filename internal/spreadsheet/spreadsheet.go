@@ -0,0 +1,66 @@
+// Package spreadsheet provides streaming writers for CSV and XLSX files.
+package spreadsheet
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Supported formats.
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// Writer writes rows of a table. Values may be strings, integers, floats or
+// time.Time. Other values are formatted using fmt.Sprint. Rows are streamed
+// to the underlying writer so the whole table is never held in memory.
+type Writer interface {
+	// WriteRow writes a single row.
+	WriteRow(values ...any) error
+
+	// Close flushes all pending data and finishes the file. It does not close
+	// the underlying writer.
+	Close() error
+}
+
+// NewWriter returns a new Writer for the given format.
+func NewWriter(w io.Writer, format string) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		return NewCSVWriter(w), nil
+	case FormatXLSX:
+		return NewXLSXWriter(w, "Sheet1")
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+}
+
+// ContentType returns the MIME type of format.
+func ContentType(format string) string {
+	switch format {
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	default:
+		return "text/csv"
+	}
+}
+
+// formatValue formats v as a string.
+func formatValue(v any) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case time.Time:
+		if t.IsZero() {
+			return ""
+		}
+
+		return t.Format(time.RFC3339)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,148 @@
+package spreadsheet
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// The static parts of a workbook with a single worksheet. The worksheet
+// itself is streamed by xlsxWriter.
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+
+	xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+	xlsxSheetHeader = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+
+	xlsxSheetFooter = `</sheetData></worksheet>`
+)
+
+type xlsxWriter struct {
+	archive *zip.Writer
+	sheet   *bufio.Writer
+}
+
+// NewXLSXWriter returns a Writer that writes an Office Open XML workbook with
+// a single worksheet called sheetName. Strings are stored as inline strings
+// and numbers as numeric cells.
+func NewXLSXWriter(w io.Writer, sheetName string) (Writer, error) {
+	archive := zip.NewWriter(w)
+
+	escapedName := new(bytes.Buffer)
+	if err := xml.EscapeText(escapedName, []byte(sheetName)); err != nil {
+		return nil, err
+	}
+
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, escapedName.String())},
+	}
+
+	for _, f := range files {
+		fw, err := archive.Create(f.name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create %s: %w", f.name, err)
+		}
+
+		if _, err := io.WriteString(fw, f.content); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", f.name, err)
+		}
+	}
+
+	// the worksheet must be the last file in the archive since it's
+	// written while rows are added.
+	sheet, err := archive.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create worksheet: %w", err)
+	}
+
+	xw := &xlsxWriter{
+		archive: archive,
+		sheet:   bufio.NewWriter(sheet),
+	}
+
+	if _, err := xw.sheet.WriteString(xlsxSheetHeader); err != nil {
+		return nil, err
+	}
+
+	return xw, nil
+}
+
+func (xw *xlsxWriter) WriteRow(values ...any) error {
+	if _, err := xw.sheet.WriteString("<row>"); err != nil {
+		return err
+	}
+
+	for _, v := range values {
+		if num, ok := numericValue(v); ok {
+			if _, err := fmt.Fprintf(xw.sheet, "<c><v>%s</v></c>", num); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		if _, err := xw.sheet.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`); err != nil {
+			return err
+		}
+
+		if err := xml.EscapeText(xw.sheet, []byte(formatValue(v))); err != nil {
+			return err
+		}
+
+		if _, err := xw.sheet.WriteString("</t></is></c>"); err != nil {
+			return err
+		}
+	}
+
+	_, err := xw.sheet.WriteString("</row>")
+
+	return err
+}
+
+func (xw *xlsxWriter) Close() error {
+	if _, err := xw.sheet.WriteString(xlsxSheetFooter); err != nil {
+		return err
+	}
+
+	if err := xw.sheet.Flush(); err != nil {
+		return err
+	}
+
+	return xw.archive.Close()
+}
+
+// numericValue returns the string representation of v if v is a number.
+func numericValue(v any) (string, bool) {
+	switch n := v.(type) {
+	case int:
+		return strconv.Itoa(n), true
+	case int64:
+		return strconv.FormatInt(n, 10), true
+	case uint64:
+		return strconv.FormatUint(n, 10), true
+	case float64:
+		return strconv.FormatFloat(n, 'f', -1, 64), true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,31 @@
+package structs
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CallNote is a note that a user added to a call-log record.
+type CallNote struct {
+	ID primitive.ObjectID `json:"id" bson:"_id"`
+	// AuthorID is the ID of the user that created the note.
+	AuthorID string `json:"authorId" bson:"authorId"`
+	// CreatedAt is the time the note has been created.
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	// UpdatedAt is set to the time the note has been edited last.
+	UpdatedAt time.Time `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+	// Text is the content of the note.
+	Text string `json:"text" bson:"text"`
+}
+
+// Note returns the note with the given ID or nil if there is none.
+func (log *CallLog) Note(id primitive.ObjectID) *CallNote {
+	for idx := range log.Notes {
+		if log.Notes[idx].ID == id {
+			return &log.Notes[idx]
+		}
+	}
+
+	return nil
+}
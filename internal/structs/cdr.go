@@ -0,0 +1,78 @@
+package structs
+
+import (
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CDROutcome describes the result of processing a raw call-data-record.
+type CDROutcome string
+
+const (
+	// CDROutcomeSuccess is used if the CDR has been stored as a call-log.
+	CDROutcomeSuccess CDROutcome = "success"
+	// CDROutcomeParseFailed is used if the CSV row could not be converted into a CDR.
+	CDROutcomeParseFailed CDROutcome = "parse-failed"
+	// CDROutcomeConvertFailed is used if the CDR could not be converted into a call-log
+	// or if the call-log is invalid (see ErrInvalidCallLog).
+	CDROutcomeConvertFailed CDROutcome = "convert-failed"
+	// CDROutcomeRecordFailed is used if the call-log could not be stored.
+	CDROutcomeRecordFailed CDROutcome = "record-failed"
+	// CDROutcomeDuplicate is used during imports if a call-log for the CDR already exists.
+	CDROutcomeDuplicate CDROutcome = "duplicate"
+)
+
+// ErrInvalidCallLog is wrapped by errors of call-log records that will never
+// be stored successfully, no matter how often they are retried, e.g. because
+// the call-id is missing or because the call-log to update has been deleted
+// in the meantime. Call-data-records failing with such an error are not
+// retried automatically. Note that callers which cannot be parsed as a phone
+// number don't fail the record but are stored using NumberQualityUnparseable.
+var ErrInvalidCallLog = errors.New("invalid call-log record")
+
+// RawCDR is a raw call-data-record row as received from 3CX.
+type RawCDR struct {
+	ID primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
+	// Peer is the remote address of the connection the row has been received from.
+	Peer string `json:"peer,omitempty" bson:"peer,omitempty"`
+	// ReceiveTime is the time the row has been received.
+	ReceiveTime time.Time `json:"receiveTime" bson:"receiveTime"`
+	// Columns holds the raw CSV columns.
+	Columns []string `json:"columns" bson:"columns"`
+	// OriginalColumns holds the columns as received from 3CX if the row has
+	// been edited as a dead letter. It's kept in the archive after the row
+	// has been processed successfully.
+	OriginalColumns []string `json:"originalColumns,omitempty" bson:"originalColumns,omitempty"`
+	// Fields holds the field order that has been used to parse Columns.
+	Fields []string `json:"fields,omitempty" bson:"fields,omitempty"`
+	// Version is the 3CX CDR format version of the row. Rows without a version
+	// use the v18 format.
+	Version string `json:"version,omitempty" bson:"version,omitempty"`
+	// Outcome is the result of the last processing attempt.
+	Outcome CDROutcome `json:"outcome" bson:"outcome"`
+	// Error holds the error message of the last processing attempt, if any.
+	Error string `json:"error,omitempty" bson:"error,omitempty"`
+	// Attempts counts how often the row has been processed.
+	Attempts int `json:"attempts" bson:"attempts"`
+	// LastProcessed is the time of the last processing attempt.
+	LastProcessed time.Time `json:"lastProcessed" bson:"lastProcessed"`
+}
+
+// DeadLetter is a call-data-record that failed to be processed. Dead letters
+// share their ID with the archived RawCDR.
+type DeadLetter struct {
+	ID primitive.ObjectID `json:"_id" bson:"_id"`
+	// CDR is the failed call-data-record.
+	CDR RawCDR `json:"cdr" bson:"cdr"`
+	// Transient is set to true if processing failed due to a temporary error
+	// (e.g. a database timeout) and the record should be retried automatically.
+	Transient bool `json:"transient" bson:"transient"`
+	// NextRetry is the time of the next automatic retry for transient failures.
+	NextRetry time.Time `json:"nextRetry,omitempty" bson:"nextRetry,omitempty"`
+	// CreatedAt is the time the record failed for the first time.
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+	// UpdatedAt is the time of the last change.
+	UpdatedAt time.Time `json:"updatedAt" bson:"updatedAt"`
+}
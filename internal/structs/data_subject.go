@@ -0,0 +1,48 @@
+package structs
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Data-subject request actions.
+const (
+	// DataSubjectExport is used if all data of a customer has been exported.
+	DataSubjectExport = "export"
+	// DataSubjectAnonymize is used if call-logs and voicemails have been
+	// anonymized and recordings, raw call-data-records and dead letters have
+	// been removed.
+	DataSubjectAnonymize = "anonymize"
+	// DataSubjectErase is used if call-logs, voicemails, recordings, raw
+	// call-data-records and dead letters have been deleted.
+	DataSubjectErase = "erase"
+)
+
+// DataSubjectAudit records a data-subject request (export or erasure) for a
+// customer or phone number.
+type DataSubjectAudit struct {
+	ID primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	// Time is the time the request has been processed.
+	Time time.Time `json:"time" bson:"time"`
+	// Action is one of the DataSubject* constants.
+	Action string `json:"action" bson:"action"`
+	// Actor is the ID of the user that issued the request, if known.
+	Actor string `json:"actor,omitempty" bson:"actor,omitempty"`
+	// CustomerID is the ID of the customer the request has been issued for.
+	CustomerID string `json:"customerId,omitempty" bson:"customerId,omitempty"`
+	// PhoneNumber is the phone number the request has been issued for.
+	PhoneNumber string `json:"phoneNumber,omitempty" bson:"phoneNumber,omitempty"`
+	// CallLogs holds the IDs of all affected call-log records.
+	CallLogs []primitive.ObjectID `json:"callLogs" bson:"callLogs"`
+	// VoiceMails holds the IDs of all affected voicemail records.
+	VoiceMails []primitive.ObjectID `json:"voiceMails" bson:"voiceMails"`
+	// RawCDRs holds the IDs of all affected raw call-data-records.
+	RawCDRs []primitive.ObjectID `json:"rawCdrs" bson:"rawCdrs"`
+	// DeadLetters holds the IDs of all affected dead letters.
+	DeadLetters []primitive.ObjectID `json:"deadLetters" bson:"deadLetters"`
+	// Recordings holds the paths of all affected recording files.
+	Recordings []string `json:"recordings" bson:"recordings"`
+	// Errors holds all errors that occurred while processing the request.
+	Errors []string `json:"errors,omitempty" bson:"errors,omitempty"`
+}
@@ -0,0 +1,51 @@
+package structs
+
+import (
+	"time"
+
+	pbx3cxv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/pbx3cx/v1"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Notification modes for missed calls.
+const (
+	// MissedCallNotifyImmediate sends a notification as soon as a call has
+	// been missed.
+	MissedCallNotifyImmediate = "immediate"
+	// MissedCallNotifyDigest sends a summary of all missed calls at the send
+	// times of the notification settings.
+	MissedCallNotifyDigest = "digest"
+	// MissedCallNotifyThreshold sends a notification if at least Threshold
+	// calls have been missed within WindowMinutes.
+	MissedCallNotifyThreshold = "threshold"
+)
+
+// MissedCallRule configures notifications for calls missed on an inbound number.
+type MissedCallRule struct {
+	ID primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	// InboundNumber is the inbound number the rule applies to.
+	InboundNumber string `json:"inboundNumber" bson:"inboundNumber"`
+	// Mode is one of the MissedCallNotify* constants.
+	Mode string `json:"mode" bson:"mode"`
+	// Threshold is the number of missed calls within WindowMinutes required
+	// to send a notification in threshold mode.
+	Threshold int `json:"threshold,omitempty" bson:"threshold,omitempty"`
+	// WindowMinutes is the time window for threshold mode.
+	WindowMinutes int `json:"windowMinutes,omitempty" bson:"windowMinutes,omitempty"`
+	// Disabled may be set to true to temporarily disable the rule.
+	Disabled bool `json:"disabled,omitempty" bson:"disabled,omitempty"`
+	// CreatedAt is the time the rule has been created. Calls missed before
+	// the rule has been created are ignored.
+	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
+
+	// Settings holds the name, recipients, notification types, templates and,
+	// for digests, the send times of the rule. The same settings are used for
+	// voicemail notifications. Settings is stored using the protobuf JSON
+	// mapping.
+	Settings *pbx3cxv1.NotificationSettings `json:"-" bson:"-"`
+}
+
+// Window returns the time window of threshold rules.
+func (r MissedCallRule) Window() time.Duration {
+	return time.Duration(r.WindowMinutes) * time.Minute
+}
@@ -1,10 +1,12 @@
 package structs
 
 import (
+	"sort"
 	"strings"
 	"time"
 
 	pbx3cxv1 "github.com/tierklinik-dobersberg/apis/gen/go/tkd/pbx3cx/v1"
+	"github.com/tierklinik-dobersberg/apis/pkg/ql"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"google.golang.org/protobuf/types/known/durationpb"
 	"google.golang.org/protobuf/types/known/timestamppb"
@@ -15,6 +17,13 @@ type CallLog struct {
 	ID primitive.ObjectID `json:"_id,omitempty" bson:"_id,omitempty"`
 	// Caller is the calling phone number.
 	Caller string `json:"caller" bson:"caller,omitempty"`
+	// RawCaller holds the calling phone number as received from 3CX before
+	// it has been formatted.
+	RawCaller string `json:"rawCaller,omitempty" bson:"rawCaller,omitempty"`
+	// NumberQuality describes whether Caller is a valid phone number. Records
+	// created before number qualities have been introduced don't have a
+	// number quality.
+	NumberQuality string `json:"numberQuality,omitempty" bson:"numberQuality,omitempty"`
 	// InboundNumber is the called number.
 	InboundNumber string `json:"inboundNumber" bson:"inboundNumber,omitempty"`
 	// Date holds the exact date the call was recorded.
@@ -30,6 +39,10 @@ type CallLog struct {
 	Agent string `json:"agent,omitempty" bson:"agent,omitempty"`
 	// AgentUserId is the ID of the user that accepted the call.
 	AgentUserId string `json:"userId,omitempty" bson:"userId,omitempty"`
+	// CallerName is the display name of the caller as known by 3CX.
+	CallerName string `json:"callerName,omitempty" bson:"callerName,omitempty"`
+	// AgentName is the display name of the agent as known by 3CX.
+	AgentName string `json:"agentName,omitempty" bson:"agentName,omitempty"`
 	// CustomerID is the ID of the customer that participated in the call.
 	CustomerID string `json:"customerID,omitempty" bson:"customerID,omitempty"`
 	// CustomerSource is the source of the customer record.
@@ -50,8 +63,247 @@ type CallLog struct {
 	// CallID Is the internal ID of the call.
 	CallID string `json:"callID,omitempty" bson:"callID,omitempty"`
 
+	// MatchedBy is set to MatchedByCallID or MatchedByTimeWindow once the
+	// entry created by the 3CX call hook has been merged with the
+	// call-data-record of the call.
+	MatchedBy string `json:"matchedBy,omitempty" bson:"matchedBy,omitempty"`
+
 	QueueExtension string `json:"queueExtension,omitempty" bson:"queueExtension,omitempty"`
 	Direction      string `json:"direction" bson:"direction"`
+
+	// TimeAnswered is the time the call has been answered for the first time.
+	// It's zero for calls that have not been answered.
+	TimeAnswered time.Time `json:"timeAnswered,omitempty" bson:"timeAnswered,omitempty"`
+	// TimeEnd is the time the call has ended.
+	TimeEnd time.Time `json:"timeEnd,omitempty" bson:"timeEnd,omitempty"`
+	// RingSeconds is the time in seconds the caller had to wait until the
+	// call has been answered or, if the call has not been answered, until
+	// the call has ended.
+	RingSeconds uint64 `json:"ringSeconds,omitempty" bson:"ringSeconds,omitempty"`
+	// ReasonTerminated is the 3CX termination reason of the last call leg.
+	ReasonTerminated string `json:"reasonTerminated,omitempty" bson:"reasonTerminated,omitempty"`
+	// TerminatedBy is set to TerminatedByCaller or TerminatedByAgent depending
+	// on who hung up first.
+	TerminatedBy string `json:"terminatedBy,omitempty" bson:"terminatedBy,omitempty"`
+
+	// CalledBack is set on missed inbound calls once the caller has been
+	// called back.
+	CalledBack *Callback `json:"calledBack,omitempty" bson:"calledBack,omitempty"`
+
+	// Notes holds all notes that users added to the call.
+	Notes []CallNote `json:"notes,omitempty" bson:"notes,omitempty"`
+	// Tags holds free-form tags that users added to the call, e.g. to mark
+	// it for follow-up.
+	Tags []string `json:"tags,omitempty" bson:"tags,omitempty"`
+
+	// AnonymizedAt is set once the record has been anonymized by the
+	// retention policy.
+	AnonymizedAt time.Time `json:"anonymizedAt,omitempty" bson:"anonymizedAt,omitempty"`
+
+	// Legs holds all call-data-records that 3CX emitted for this call, ordered
+	// by their start time.
+	Legs []CallLeg `json:"legs,omitempty" bson:"legs,omitempty"`
+}
+
+// Strategies used to match call-data-records to the entries created by the 3CX
+// call hook.
+const (
+	MatchedByCallID     = "callId"
+	MatchedByTimeWindow = "timeWindow"
+)
+
+// Callback describes the outbound call that followed up a missed call.
+type Callback struct {
+	// CallID is the ID of the call-log record of the outbound call.
+	CallID primitive.ObjectID `json:"callId" bson:"callId"`
+	// Time is the time of the outbound call.
+	Time time.Time `json:"time" bson:"time"`
+	// Agent is the extension that called back.
+	Agent string `json:"agent,omitempty" bson:"agent,omitempty"`
+	// AgentUserId is the ID of the user that called back.
+	AgentUserId string `json:"userId,omitempty" bson:"userId,omitempty"`
+}
+
+// CallLogModel defines the fields of CallLog that may be used in call-log
+// search queries. Values of duration, error, callType and direction are
+// converted by the database package since the query language only
+// supports strings and times.
+var CallLogModel = ql.FieldList{
+	ql.FieldSpec{
+		Name:         "date",
+		TypeResolver: ql.TimeStartKeywordType(time.Local),
+	},
+	ql.FieldSpec{
+		Name:         "caller",
+		TypeResolver: ql.NullableType(nil),
+	},
+	ql.FieldSpec{
+		Name:         "agent",
+		TypeResolver: ql.NullableType(nil),
+	},
+	ql.FieldSpec{
+		Name:    "inboundNumber",
+		Aliases: []string{"line"},
+	},
+	ql.FieldSpec{
+		Name:    "callType",
+		Aliases: []string{"type"},
+	},
+	ql.FieldSpec{
+		Name: "direction",
+	},
+	ql.FieldSpec{
+		Name:         "durationSeconds",
+		TypeResolver: ql.NullableType(nil),
+		Aliases:      []string{"duration"},
+	},
+	ql.FieldSpec{
+		Name:         "transferTarget",
+		TypeResolver: ql.NullableType(nil),
+		Aliases:      []string{"transfer"},
+	},
+	ql.FieldSpec{
+		Name:         "error",
+		TypeResolver: ql.NullableType(nil),
+	},
+	ql.FieldSpec{
+		Name:         "tags",
+		TypeResolver: ql.NullableType(nil),
+		Aliases:      []string{"tag"},
+	},
+}
+
+const (
+	// TerminatedByCaller is used if the external party terminated the call.
+	TerminatedByCaller = "caller"
+	// TerminatedByAgent is used if the internal party terminated the call.
+	TerminatedByAgent = "agent"
+)
+
+const (
+	// NumberQualityValid is used if the caller is a valid phone number.
+	NumberQualityValid = "valid"
+	// NumberQualityInvalid is used if the caller could be parsed but is not a
+	// valid phone number (e.g. short codes or internal extensions).
+	NumberQualityInvalid = "invalid"
+	// NumberQualityUnparseable is used if the caller could not be parsed as a
+	// phone number at all. Caller holds the raw value in that case.
+	NumberQualityUnparseable = "unparseable"
+	// NumberQualityAnonymous is used for anonymous callers.
+	NumberQualityAnonymous = "anonymous"
+)
+
+// NumberQualityReportEntry summarizes all call-log records for a caller that
+// is not a valid phone number.
+type NumberQualityReportEntry struct {
+	// RawCaller is the caller as received from 3CX.
+	RawCaller string `json:"rawCaller" bson:"_id"`
+	// Caller is the caller as stored in the call-log records.
+	Caller string `json:"caller" bson:"caller"`
+	// NumberQuality is the number quality of the caller.
+	NumberQuality string `json:"numberQuality" bson:"numberQuality"`
+	// Count is the number of call-log records for the caller.
+	Count int `json:"count" bson:"count"`
+	// FirstSeen is the date of the first call of the caller.
+	FirstSeen time.Time `json:"firstSeen" bson:"firstSeen"`
+	// LastSeen is the date of the last call of the caller.
+	LastSeen time.Time `json:"lastSeen" bson:"lastSeen"`
+	// CallIDs holds the IDs of up to 10 call-log records of the caller.
+	CallIDs []primitive.ObjectID `json:"callIds" bson:"callIds"`
+}
+
+// CallLeg is a single leg of a call (e.g. a queue, transfer or voicemail leg).
+// 3CX emits one call-data-record per leg, all sharing the same call-id.
+type CallLeg struct {
+	// HistoryID is the 3CX history-id of the call-data-record.
+	HistoryID string `json:"historyId,omitempty" bson:"historyId,omitempty"`
+
+	From      string `json:"from,omitempty" bson:"from,omitempty"`
+	FromType  Type   `json:"fromType,omitempty" bson:"fromType,omitempty"`
+	To        string `json:"to,omitempty" bson:"to,omitempty"`
+	ToType    Type   `json:"toType,omitempty" bson:"toType,omitempty"`
+	Final     string `json:"final,omitempty" bson:"final,omitempty"`
+	FinalType Type   `json:"finalType,omitempty" bson:"finalType,omitempty"`
+	Dialed    string `json:"dialed,omitempty" bson:"dialed,omitempty"`
+
+	// Display names of the participants as reported by 3CX.
+	FromName  string `json:"fromName,omitempty" bson:"fromName,omitempty"`
+	ToName    string `json:"toName,omitempty" bson:"toName,omitempty"`
+	FinalName string `json:"finalName,omitempty" bson:"finalName,omitempty"`
+
+	TimeStart    time.Time `json:"timeStart" bson:"timeStart"`
+	TimeAnswered time.Time `json:"timeAnswered,omitempty" bson:"timeAnswered,omitempty"`
+	TimeEnd      time.Time `json:"timeEnd,omitempty" bson:"timeEnd,omitempty"`
+
+	DurationSeconds  uint64 `json:"durationSeconds,omitempty" bson:"durationSeconds,omitempty"`
+	ReasonTerminated string `json:"reasonTerminated,omitempty" bson:"reasonTerminated,omitempty"`
+	Chain            string `json:"chain,omitempty" bson:"chain,omitempty"`
+
+	// Inbound is set to true if the leg was initiated by an external party.
+	Inbound bool `json:"inbound" bson:"inbound"`
+	// Answered is set to true if the leg has been answered.
+	Answered bool `json:"answered" bson:"answered"`
+}
+
+// AddLeg adds leg to the call. If a leg with the same history-id already exists
+// it is replaced. Legs are kept ordered by their start time.
+func (log *CallLog) AddLeg(leg CallLeg) {
+	replaced := false
+	if leg.HistoryID != "" {
+		for idx, existing := range log.Legs {
+			if existing.HistoryID == leg.HistoryID {
+				log.Legs[idx] = leg
+				replaced = true
+
+				break
+			}
+		}
+	}
+
+	if !replaced {
+		log.Legs = append(log.Legs, leg)
+	}
+
+	sort.SliceStable(log.Legs, func(i, j int) bool {
+		return log.Legs[i].TimeStart.Before(log.Legs[j].TimeStart)
+	})
+}
+
+// HasLeg reports whether the call already holds a leg with the given history-id.
+func (log *CallLog) HasLeg(historyID string) bool {
+	if historyID == "" {
+		return false
+	}
+
+	for _, leg := range log.Legs {
+		if leg.HistoryID == historyID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HistoryIDs returns the 3CX history-ids of all call legs.
+func (log *CallLog) HistoryIDs() []string {
+	ids := make([]string, 0, len(log.Legs))
+	for _, leg := range log.Legs {
+		if leg.HistoryID != "" {
+			ids = append(ids, leg.HistoryID)
+		}
+	}
+
+	return ids
+}
+
+// AcceptedAgent returns the agent that accepted the call. The 3CX display
+// name is used if the agent is not a known user.
+func (log CallLog) AcceptedAgent() string {
+	if log.AgentUserId == "" && log.AgentName != "" && log.ToType != TypeQueue {
+		return log.AgentName
+	}
+
+	return log.Agent
 }
 
 func (log CallLog) ToProto() *pbx3cxv1.CallEntry {
@@ -79,7 +331,7 @@ func (log CallLog) ToProto() *pbx3cxv1.CallEntry {
 		status = pbx3cxv1.CallStatus_CALL_STATUS_OUTBOUND
 	case "Missed":
 		status = pbx3cxv1.CallStatus_CALL_STATUS_MISSED
-	case "Notanswered":
+	case "Notanswered", "NotAnswered":
 		status = pbx3cxv1.CallStatus_CALL_STATUS_NOTANSWERED
 	}
 
@@ -103,7 +355,7 @@ func (log CallLog) ToProto() *pbx3cxv1.CallEntry {
 		CustomerSource: log.CustomerSource,
 		Error:          log.Error,
 		TransferTarget: log.TransferTarget,
-		AcceptedAgent:  log.Agent,
+		AcceptedAgent:  log.AcceptedAgent(),
 		QueueExtension: log.QueueExtension,
 		Direction:      direction,
 		Status:         status,
@@ -13,6 +13,11 @@ const (
 	TypeOutboundRule Type = "outbound_rule"
 )
 
+// IsExternal reports whether the participant is an external party.
+func (t Type) IsExternal() bool {
+	return t == TypeExternalLine || t == TypeOutboundRule
+}
+
 func (t Type) ToProto() pbx3cxv1.ParticipantType {
 	switch t {
 	case TypeQueue:
@@ -0,0 +1,109 @@
+package structs
+
+import "time"
+
+// RetentionReport describes the call-log records that have been (or, for dry
+// runs, would be) anonymized or deleted by the retention policy.
+type RetentionReport struct {
+	// DryRun is set to true if no records have been changed.
+	DryRun bool `json:"dryRun"`
+	// Time is the time the retention policy has been evaluated.
+	Time time.Time `json:"time"`
+	// Policies holds the results of each retention policy.
+	Policies []RetentionPolicyReport `json:"policies"`
+	// RawCDRsBefore is the receive time before which archived call-data-records
+	// are deleted. It is zero if the default retention policy is not configured.
+	RawCDRsBefore time.Time `json:"rawCdrsBefore,omitempty"`
+	// RawCDRs is the number of deleted archived call-data-records.
+	RawCDRs int64 `json:"rawCdrs"`
+	// DeadLetters is the number of deleted dead letters.
+	DeadLetters int64 `json:"deadLetters"`
+}
+
+// RetentionPolicyReport describes the result of a single retention policy.
+type RetentionPolicyReport struct {
+	// InboundNumbers holds the inbound numbers of the policy. It is empty for
+	// the default policy which applies to all other inbound numbers.
+	InboundNumbers []string `json:"inboundNumbers,omitempty"`
+	// AnonymizeBefore is the date before which records are anonymized.
+	AnonymizeBefore time.Time `json:"anonymizeBefore,omitempty"`
+	// DeleteBefore is the date before which records are deleted.
+	DeleteBefore time.Time `json:"deleteBefore,omitempty"`
+	// Anonymized is the number of anonymized records.
+	Anonymized int64 `json:"anonymized"`
+	// Deleted is the number of deleted records.
+	Deleted int64 `json:"deleted"`
+}
+
+// Anonymize removes all data that identifies the external party of the call:
+// the caller number and name, the customer, all external numbers stored in
+// the call legs and the transfer target as well as the call chains.
+func (log *CallLog) Anonymize(t time.Time) {
+	external := make(map[string]struct{})
+	addExternal := func(v string) {
+		if v != "" {
+			external[v] = struct{}{}
+		}
+	}
+
+	addExternal(log.Caller)
+	addExternal(log.RawCaller)
+
+	for idx := range log.Legs {
+		leg := &log.Legs[idx]
+
+		// chains contain the numbers of all parties, in any format.
+		leg.Chain = ""
+
+		if leg.FromType.IsExternal() {
+			addExternal(leg.From)
+			leg.From = ""
+			leg.FromName = ""
+		}
+
+		if leg.ToType.IsExternal() {
+			addExternal(leg.To)
+			leg.To = ""
+			leg.ToName = ""
+		}
+
+		if leg.FinalType.IsExternal() {
+			addExternal(leg.Final)
+			leg.Final = ""
+			leg.FinalName = ""
+		}
+
+		// outbound legs hold the called number in Dialed while inbound legs
+		// hold our inbound number.
+		if !leg.Inbound {
+			addExternal(leg.Dialed)
+			leg.Dialed = ""
+		}
+	}
+
+	for idx := range log.Legs {
+		if _, ok := external[log.Legs[idx].Dialed]; ok {
+			log.Legs[idx].Dialed = ""
+		}
+	}
+
+	if _, ok := external[log.TransferTarget]; ok {
+		log.TransferTarget = ""
+	}
+
+	if _, ok := external[log.TransferFrom]; ok {
+		log.TransferFrom = ""
+	}
+
+	log.Caller = ""
+	log.RawCaller = ""
+	log.Chain = ""
+	log.CallerName = ""
+	log.CustomerID = ""
+	log.CustomerSource = ""
+	log.NumberQuality = NumberQualityAnonymous
+	log.AnonymizedAt = t
+
+	// notes are free text and may mention the caller.
+	log.Notes = nil
+}
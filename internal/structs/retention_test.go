@@ -0,0 +1,139 @@
+package structs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func Test_CallLog_Anonymize(t *testing.T) {
+	now := time.Date(2024, 1, 2, 10, 0, 0, 0, time.UTC)
+	noteID := primitive.NewObjectID()
+
+	cases := []struct {
+		Name string
+		I    CallLog
+		E    CallLog
+	}{
+		{
+			Name: "inbound call",
+			I: CallLog{
+				Caller:         "+43 664 1234567",
+				RawCaller:      "06641234567",
+				CallerName:     "Max Mustermann",
+				CustomerID:     "customer-1",
+				CustomerSource: "vetinf",
+				InboundNumber:  "1000",
+				Agent:          "10",
+				Chain:          "Chain: 06641234567;1000;Ext.10",
+				TransferTarget: "+43 664 1234567",
+				TransferFrom:   "20",
+				NumberQuality:  NumberQualityValid,
+				Notes:          []CallNote{{ID: noteID, Text: "called about Bello"}},
+				Tags:           []string{"urgent"},
+				Legs: []CallLeg{
+					{
+						HistoryID: "1",
+						From:      "06641234567",
+						FromType:  TypeExternalLine,
+						FromName:  "Max Mustermann",
+						To:        "Ext.10",
+						ToType:    TypeExtension,
+						ToName:    "Reception",
+						Final:     "Ext.10",
+						FinalType: TypeExtension,
+						FinalName: "Reception",
+						Dialed:    "1000",
+						Chain:     "Chain: 06641234567;1000;Ext.10",
+						Inbound:   true,
+					},
+				},
+			},
+			E: CallLog{
+				InboundNumber: "1000",
+				Agent:         "10",
+				TransferFrom:  "20",
+				NumberQuality: NumberQualityAnonymous,
+				AnonymizedAt:  now,
+				Tags:          []string{"urgent"},
+				Legs: []CallLeg{
+					{
+						HistoryID: "1",
+						FromType:  TypeExternalLine,
+						To:        "Ext.10",
+						ToType:    TypeExtension,
+						ToName:    "Reception",
+						Final:     "Ext.10",
+						FinalType: TypeExtension,
+						FinalName: "Reception",
+						Dialed:    "1000",
+						Inbound:   true,
+					},
+				},
+			},
+		},
+		{
+			Name: "outbound call",
+			I: CallLog{
+				Caller:        "+43 664 1234567",
+				RawCaller:     "06641234567",
+				CallerName:    "Max Mustermann",
+				Agent:         "20",
+				NumberQuality: NumberQualityValid,
+				Legs: []CallLeg{
+					{
+						HistoryID: "1",
+						From:      "Ext.20",
+						FromType:  TypeExtension,
+						FromName:  "Doctor",
+						To:        "06641234567",
+						ToType:    TypeOutboundRule,
+						Final:     "06641234567",
+						FinalType: TypeOutboundRule,
+						FinalName: "Max Mustermann",
+						Dialed:    "06641234567",
+						Chain:     "Chain: Ext.20;06641234567",
+					},
+				},
+			},
+			E: CallLog{
+				Agent:         "20",
+				NumberQuality: NumberQualityAnonymous,
+				AnonymizedAt:  now,
+				Legs: []CallLeg{
+					{
+						HistoryID: "1",
+						From:      "Ext.20",
+						FromType:  TypeExtension,
+						FromName:  "Doctor",
+						ToType:    TypeOutboundRule,
+						FinalType: TypeOutboundRule,
+					},
+				},
+			},
+		},
+		{
+			Name: "internal transfer target",
+			I: CallLog{
+				Caller:         "anonymous",
+				TransferTarget: "30",
+				NumberQuality:  NumberQualityAnonymous,
+			},
+			E: CallLog{
+				TransferTarget: "30",
+				NumberQuality:  NumberQualityAnonymous,
+				AnonymizedAt:   now,
+			},
+		},
+	}
+
+	for _, c := range cases {
+		c.I.Anonymize(now)
+
+		if !reflect.DeepEqual(c.I, c.E) {
+			t.Errorf("%s: unexpected result\n got  %+v\n want %+v", c.Name, c.I, c.E)
+		}
+	}
+}
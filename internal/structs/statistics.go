@@ -0,0 +1,32 @@
+package structs
+
+// Call status values used by call statistics. They match the status reported
+// for call entries.
+const (
+	CallStatusInbound     = "inbound"
+	CallStatusOutbound    = "outbound"
+	CallStatusMissed      = "missed"
+	CallStatusNotAnswered = "notAnswered"
+)
+
+// CallStatistics holds aggregated statistics for a group of calls.
+type CallStatistics struct {
+	// Key is the value of the grouping field (e.g. the day or the inbound
+	// number). It's empty for the overall statistics.
+	Key string `json:"key"`
+	// Total is the number of calls in the group.
+	Total int `json:"total"`
+	// Inbound is the number of answered inbound calls.
+	Inbound int `json:"inbound"`
+	// Outbound is the number of outbound calls.
+	Outbound int `json:"outbound"`
+	// Missed is the number of missed inbound calls.
+	Missed int `json:"missed"`
+	// NotAnswered is the number of outbound calls that have not been answered.
+	NotAnswered int `json:"notAnswered"`
+	// AvgDurationSeconds is the average duration of all answered calls.
+	AvgDurationSeconds float64 `json:"avgDurationSeconds"`
+	// DurationPercentiles holds the requested duration percentiles of all
+	// answered calls, indexed by name (e.g. "p90").
+	DurationPercentiles map[string]float64 `json:"durationPercentiles,omitempty"`
+}
@@ -33,6 +33,9 @@ type (
 		FileName string `bson:"fileName,omitempty"`
 		// InboundNumber holds the inbound number that has been called.
 		InboundNumber string `bson:"inboundNumber,omitempty"`
+		// AnonymizedAt is set once the caller, the message and the recording
+		// have been removed due to a data-subject request.
+		AnonymizedAt time.Time `bson:"anonymizedAt,omitempty"`
 	}
 )
 
@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/cdr"
+	"github.com/tierklinik-dobersberg/3cx-support/internal/config"
+	"github.com/tierklinik-dobersberg/3cx-support/internal/database"
+)
+
+// maxDeadLetterAttempts is the number of processing attempts after which
+// dead letters are no longer retried automatically.
+const maxDeadLetterAttempts = 20
+
+// StartDeadLetterRetryWorker periodically retries dead letters that failed
+// due to a temporary error (e.g. a database timeout).
+func StartDeadLetterRetryWorker(ctx context.Context, providers *config.Providers, processor *cdr.ProcessorImpl) {
+	l := slog.Default().With("subsystem", "dead-letter-worker")
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			func() {
+				ctx, cancel := context.WithTimeout(ctx, time.Minute*5)
+				defer cancel()
+
+				query := new(database.DeadLetterQuery).
+					Transient().
+					RetryBefore(time.Now()).
+					MaxAttempts(maxDeadLetterAttempts)
+
+				dls, err := providers.DeadLetters.FindDeadLetters(ctx, query)
+				if err != nil {
+					l.Error("failed to find dead letters for retry", "error", err)
+					return
+				}
+
+				if len(dls) == 0 {
+					return
+				}
+
+				succeeded := 0
+				for idx := range dls {
+					if ctx.Err() != nil {
+						return
+					}
+
+					if err := processor.Replay(ctx, &dls[idx].CDR, l); err != nil {
+						l.Warn("dead letter retry failed", "id", dls[idx].ID.Hex(), "attempts", dls[idx].CDR.Attempts, "error", err)
+					} else {
+						succeeded++
+					}
+				}
+
+				l.Info("retried dead letters", "count", len(dls), "succeeded", succeeded)
+			}()
+		}
+	}()
+}
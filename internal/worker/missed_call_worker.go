@@ -0,0 +1,174 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/config"
+	"github.com/tierklinik-dobersberg/3cx-support/internal/structs"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// missedCallLookback limits how far back immediate and digest rules look for
+// missed calls so a longer downtime does not cause a flood of notifications.
+const missedCallLookback = 7 * 24 * time.Hour
+
+// StartMissedCallNotificationWorker periodically evaluates all missed-call
+// rules and sends notifications for missed calls that have not been called
+// back yet.
+func StartMissedCallNotificationWorker(ctx context.Context, providers *config.Providers) {
+	startTime := time.Now()
+	lastSentMap := make(map[string]time.Time)
+
+	l := slog.Default().With("subsystem", "missed-call-worker")
+
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			func() {
+				ctx, cancel := context.WithTimeout(ctx, time.Minute*5)
+				defer cancel()
+
+				rules, err := providers.MissedCallRules.ListMissedCallRules(ctx)
+				if err != nil {
+					l.Error("failed to load missed-call rules", "error", err)
+					return
+				}
+
+				if len(rules) == 0 {
+					return
+				}
+
+				queues, err := providers.InternalQueueExtensions(ctx)
+				if err != nil {
+					l.Error("failed to load internal queues", "error", err)
+					return
+				}
+
+				now := time.Now()
+				for idx := range rules {
+					rule := &rules[idx]
+					if rule.Disabled || rule.Settings == nil {
+						continue
+					}
+
+					lr := l.With("rule", rule.ID.Hex(), "inboundNumber", rule.InboundNumber, "mode", rule.Mode)
+
+					if rule.Mode == structs.MissedCallNotifyDigest && !digestDue(rule, now, startTime, lastSentMap) {
+						continue
+					}
+
+					if err := evaluateMissedCallRule(ctx, providers, rule, queues, now, lr); err != nil {
+						lr.Error("failed to evaluate missed-call rule", "error", err)
+					}
+				}
+			}()
+		}
+	}()
+}
+
+// digestDue reports whether one of the send times of a digest rule has passed
+// since the digest has been sent the last time.
+func digestDue(rule *structs.MissedCallRule, now time.Time, startTime time.Time, lastSentMap map[string]time.Time) bool {
+	now = now.Local()
+	due := false
+
+	for _, t := range rule.Settings.SendTimes {
+		sendTimeToday := time.Date(now.Year(), now.Month(), now.Day(), int(t.Hour), int(t.Minute), int(t.Second), 0, time.Local)
+
+		// Do not send digests for time-of-day entries that occured before the
+		// worker even started
+		if sendTimeToday.Before(startTime) || sendTimeToday.After(now) {
+			continue
+		}
+
+		key := rule.ID.Hex() + fmt.Sprintf("-%d:%d:%d", t.Hour, t.Minute, t.Second)
+		if lastSent, ok := lastSentMap[key]; !ok || lastSent.Before(sendTimeToday) {
+			lastSentMap[key] = sendTimeToday
+			due = true
+		}
+	}
+
+	return due
+}
+
+func evaluateMissedCallRule(ctx context.Context, providers *config.Providers, rule *structs.MissedCallRule, queues []string, now time.Time, log *slog.Logger) error {
+	since := now.Add(-missedCallLookback)
+	if rule.Mode == structs.MissedCallNotifyThreshold {
+		since = now.Add(-rule.Window())
+	}
+
+	if since.Before(rule.CreatedAt) {
+		since = rule.CreatedAt
+	}
+
+	calls, err := providers.CallLogDB.FindOpenCallbacks(ctx, []string{rule.InboundNumber}, since, queues)
+	if err != nil {
+		return fmt.Errorf("failed to find missed calls: %w", err)
+	}
+
+	ids := make([]primitive.ObjectID, len(calls))
+	for idx, c := range calls {
+		ids[idx] = c.ID
+	}
+
+	pending, err := providers.MissedCallRules.FilterNotified(ctx, rule.ID, ids)
+	if err != nil {
+		return fmt.Errorf("failed to filter notified calls: %w", err)
+	}
+
+	if len(pending) == 0 {
+		return nil
+	}
+
+	if rule.Mode == structs.MissedCallNotifyThreshold && len(pending) < rule.Threshold {
+		log.Debug("missed-call threshold not reached", "count", len(pending), "threshold", rule.Threshold)
+		return nil
+	}
+
+	pendingSet := make(map[primitive.ObjectID]struct{}, len(pending))
+	for _, id := range pending {
+		pendingSet[id] = struct{}{}
+	}
+
+	missed := make([]structs.CallLog, 0, len(pending))
+	for _, c := range calls {
+		if _, ok := pendingSet[c.ID]; ok {
+			missed = append(missed, c)
+		}
+	}
+
+	tCtx := map[string]any{
+		"count":         len(missed),
+		"name":          rule.Settings.Name,
+		"inboundNumber": rule.InboundNumber,
+		"calls":         missed,
+	}
+
+	reqs, err := newNotificationRequests(providers.Config.NotificationSenderId, rule.Settings, tCtx, log)
+	if err != nil {
+		return fmt.Errorf("failed to create notification requests: %w", err)
+	}
+
+	log.Info("sending missed-call notification", "count", len(missed))
+
+	if !sendNotifications(ctx, providers, reqs, log) {
+		return fmt.Errorf("not marking missed calls as notified, an error occured")
+	}
+
+	if err := providers.MissedCallRules.MarkNotified(ctx, rule.ID, pending); err != nil {
+		return fmt.Errorf("failed to mark missed calls as notified: %w", err)
+	}
+
+	return nil
+}
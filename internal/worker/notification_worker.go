@@ -77,7 +77,12 @@ func StartNotificationWorker(ctx context.Context, mng *voicemail.Manager, provid
 
 					lnfs.Info("found candiates for notifications", "count", len(candidates))
 
-					reqs, err := newNotificationRequests(providers.Config.NotificationSenderId, mb, nfs, len(candidates), lnfs)
+					tCtx := map[string]any{
+						"count": len(candidates),
+						"name":  mb.DisplayName,
+					}
+
+					reqs, err := newNotificationRequests(providers.Config.NotificationSenderId, nfs, tCtx, lnfs)
 					if err != nil {
 						lnfs.ErrorContext(ctx, "failed to create notification requests", slog.Any("error", err.Error()))
 						continue
@@ -99,25 +104,10 @@ func StartNotificationWorker(ctx context.Context, mng *voicemail.Manager, provid
 						key := mb.Id + fmt.Sprintf("-%d-%d:%d:%d", idx, t.Hour, t.Minute, t.Second)
 						lastSent, ok := lastSentMap[key]
 
-						success := true
-
 						if !ok || lastSent.Before(sendTimeToday) {
 							lnfs.InfoContext(ctx, "sending notification requests for time-of-day", slog.Any("key", key))
 
-							for _, r := range reqs {
-								res, err := providers.Notify.SendNotification(ctx, connect.NewRequest(r))
-								if err != nil {
-									lnfs.ErrorContext(ctx, "failed to send notification", slog.Any("key", key), slog.Any("error", err.Error()))
-									success = false
-								} else {
-									for _, d := range res.Msg.Deliveries {
-										if d.ErrorKind != idmv1.ErrorKind_ERROR_KIND_UNSPECIFIED {
-											lnfs.ErrorContext(ctx, "failed to send notification", slog.Any("key", key), slog.Any("error", d.Error), slog.Any("errorKind", d.ErrorKind.String()))
-											success = false
-										}
-									}
-								}
-							}
+							success := sendNotifications(ctx, providers, reqs, lnfs.With("key", key))
 
 							if success {
 								if err := providers.MailboxDatabase.MarkAsNotificationSent(ctx, mb.Id, nfs.Name, candidates); err != nil {
@@ -138,7 +128,32 @@ func StartNotificationWorker(ctx context.Context, mng *voicemail.Manager, provid
 	}()
 }
 
-func newNotificationRequests(sender string, mb *pbx3cxv1.Mailbox, nfs *pbx3cxv1.NotificationSettings, count int, log *slog.Logger) ([]*idmv1.SendNotificationRequest, error) {
+// sendNotifications sends all notification requests using the notify service
+// and reports whether all of them have been delivered successfully.
+func sendNotifications(ctx context.Context, providers *config.Providers, reqs []*idmv1.SendNotificationRequest, log *slog.Logger) bool {
+	success := true
+
+	for _, r := range reqs {
+		res, err := providers.Notify.SendNotification(ctx, connect.NewRequest(r))
+		if err != nil {
+			log.ErrorContext(ctx, "failed to send notification", slog.Any("error", err.Error()))
+			success = false
+		} else {
+			for _, d := range res.Msg.Deliveries {
+				if d.ErrorKind != idmv1.ErrorKind_ERROR_KIND_UNSPECIFIED {
+					log.ErrorContext(ctx, "failed to send notification", slog.Any("error", d.Error), slog.Any("errorKind", d.ErrorKind.String()))
+					success = false
+				}
+			}
+		}
+	}
+
+	return success
+}
+
+// newNotificationRequests renders the message and subject templates of nfs
+// using tCtx and returns one request per notification type.
+func newNotificationRequests(sender string, nfs *pbx3cxv1.NotificationSettings, tCtx map[string]any, log *slog.Logger) ([]*idmv1.SendNotificationRequest, error) {
 	// create and parse the message and subject templates
 	msgTmpl, err := template.New("").Parse(nfs.MessageTemplate)
 	if err != nil {
@@ -154,12 +169,6 @@ func newNotificationRequests(sender string, mb *pbx3cxv1.Mailbox, nfs *pbx3cxv1.
 	msg := new(strings.Builder)
 	sbj := new(strings.Builder)
 
-	// construct the context
-	tCtx := map[string]any{
-		"count": count,
-		"name":  mb.DisplayName,
-	}
-
 	// execute message and subject templates
 	if err := msgTmpl.Execute(msg, tCtx); err != nil {
 		return nil, fmt.Errorf("failed to execute message template: %w", err)
@@ -0,0 +1,53 @@
+package worker
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/tierklinik-dobersberg/3cx-support/internal/config"
+)
+
+// StartRetentionWorker periodically anonymizes and deletes call-log records
+// according to the configured retention policies. If the retention dry-run
+// mode is enabled, the worker only logs the affected records.
+func StartRetentionWorker(ctx context.Context, providers *config.Providers) {
+	if !providers.Config.RetentionEnabled() {
+		return
+	}
+
+	l := slog.Default().With("subsystem", "retention-worker")
+
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			func() {
+				ctx, cancel := context.WithTimeout(ctx, time.Minute*30)
+				defer cancel()
+
+				report, err := providers.ApplyRetention(ctx, time.Now(), providers.Config.RetentionDryRun)
+				if err != nil {
+					l.Error("failed to apply retention policy", "error", err)
+				}
+
+				if report == nil {
+					return
+				}
+
+				for _, p := range report.Policies {
+					l.Info("applied retention policy", "dryRun", report.DryRun, "inboundNumbers", p.InboundNumbers, "anonymized", p.Anonymized, "deleted", p.Deleted)
+				}
+
+				l.Info("applied retention policy to raw call-data-records", "dryRun", report.DryRun, "cdrs", report.RawCDRs, "deadLetters", report.DeadLetters)
+			}()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -2,11 +2,14 @@ package main
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
+	"time"
 
 	"github.com/bufbuild/connect-go"
 	"github.com/bufbuild/protovalidate-go"
@@ -29,7 +32,7 @@ import (
 )
 
 func main() {
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
 	var cfgFilePath string
@@ -91,6 +94,28 @@ func main() {
 
 	serveMux.Handle("/api/external/v1/calllog", http.HandlerFunc(callService.RecordCallHandler))
 
+	// plain HTTP endpoints are not covered by the connect interceptors so the
+	// remote user is authenticated separately.
+	httpAuth := services.NewHTTPAuth(auth.RemoteHeaderExtractor, cfg.AdminRoles)
+
+	serveMux.Handle("/api/calllog/v1/call", httpAuth.User(callService.GetCallLogHandler))
+	serveMux.Handle("/api/calllog/v1/search", httpAuth.User(callService.SearchCallLogsHandler))
+	serveMux.Handle("/api/calllog/v1/export", httpAuth.User(callService.ExportCallLogsHandler))
+	serveMux.Handle("/api/calllog/v1/customer", httpAuth.User(callService.GetLogsForCustomerHandler))
+	serveMux.Handle("/api/calllog/v1/timeline", httpAuth.User(callService.CustomerTimelineHandler))
+	serveMux.Handle("/api/calllog/v1/notes", httpAuth.User(callService.CallNotesHandler))
+	serveMux.Handle("/api/calllog/v1/note", httpAuth.User(callService.CallNoteHandler))
+	serveMux.Handle("/api/calllog/v1/tags", httpAuth.User(callService.CallTagsHandler))
+	serveMux.Handle("/api/calllog/v1/statistics", httpAuth.User(callService.CallStatisticsHandler))
+	serveMux.Handle("/api/calllog/v1/callbacks", httpAuth.User(callService.OpenCallbacksHandler))
+	serveMux.Handle("/api/calllog/v1/number-quality", httpAuth.User(callService.NumberQualityReportHandler))
+	serveMux.Handle("/api/calllog/v1/missed-call-rules", httpAuth.Admin(callService.MissedCallRulesHandler))
+	serveMux.Handle("/api/calllog/v1/missed-call-rule", httpAuth.Admin(callService.MissedCallRuleHandler))
+	serveMux.Handle("/api/calllog/v1/retention", httpAuth.Admin(callService.RetentionHandler))
+	serveMux.Handle("/api/privacy/v1/export", httpAuth.Admin(callService.DataSubjectExportHandler))
+	serveMux.Handle("/api/privacy/v1/erase", httpAuth.Admin(callService.DataSubjectEraseHandler))
+	serveMux.Handle("/api/privacy/v1/audit", httpAuth.Admin(callService.DataSubjectAuditHandler))
+
 	path, handler := pbx3cxv1connect.NewCallServiceHandler(callService, interceptors)
 	serveMux.Handle(path, handler)
 
@@ -104,9 +129,82 @@ func main() {
 
 	serveMux.HandleFunc("/voicemails/", voiceMailSerivce.ServeRecording)
 
+	// prepare the CDR processor, it's also used to replay archived records
+	// if CDR_MODE is OFF.
+	fieldOrder, err := cdr.ParseFieldOrder(cfg.CDRFields)
+	if err != nil {
+		logrus.Fatalf("invalid CDR field order: %s", err)
+	}
+
+	cdrProcessor, err := cdr.NewProcessor(fieldOrder, providers.CallLogDB, providers, providers, providers.CDRArchive).
+		WithDeadLetters(providers.DeadLetters).
+		WithCallbacks(providers).
+		WithVersions(cfg.CDRVersion, cfg.CDRPeerVersions)
+	if err != nil {
+		logrus.Fatalf("invalid CDR version: %s", err)
+	}
+
+	// rows received from the CDR socket are buffered and processed by a pool of
+	// workers.
+	var cdrQueue *cdr.Queue
+	if strings.ToLower(cfg.CDRMode) != "off" {
+		cdrQueue = cdr.NewQueue(cdrProcessor, cfg.CDRQueueSize, cfg.CDRWorkers)
+	}
+
+	// prepare the CDR server if CDR_MODE is not OFF
+	var (
+		cdrServer   cdr.Server
+		cdrListener *cdr.ListeningServer
+	)
+
+	switch strings.ToLower(cfg.CDRMode) {
+	case "active":
+		var opts []cdr.ListenerOption
+
+		if cfg.CDRTLSCert != "" {
+			tlsConfig, err := cdr.LoadTLSConfig(cfg.CDRTLSCert, cfg.CDRTLSKey, cfg.CDRTLSClientCA)
+			if err != nil {
+				logrus.Fatalf("failed to prepare CDR TLS configuration: %s", err)
+			}
+
+			opts = append(opts, cdr.WithTLS(tlsConfig))
+		}
+
+		if len(cfg.CDRAllowedPeers) > 0 {
+			allowed, err := cdr.ParseAllowedPeers(cfg.CDRAllowedPeers)
+			if err != nil {
+				logrus.Fatalf("invalid CDR peer allowlist: %s", err)
+			}
+
+			opts = append(opts, cdr.WithAllowedPeers(allowed))
+		}
+
+		cdrListener = cdr.NewListeningServer(cfg.CDRAddr, cdrQueue, slog.Default(), opts...)
+		cdrServer = cdrListener
+
+	case "passive":
+		cdrServer = cdr.NewClient(cfg.CDRAddr, cdrQueue, slog.Default())
+	}
+
+	cdrService := services.NewCDRService(providers, cdrProcessor, cdrQueue, cdrListener)
+	serveMux.Handle("/api/cdr/v1/listener", httpAuth.Admin(cdrService.ListenerStats))
+	serveMux.Handle("/api/cdr/v1/queue", httpAuth.Admin(cdrService.QueueStats))
+	serveMux.Handle("/api/cdr/v1/archive", httpAuth.Admin(cdrService.ListArchivedCDRs))
+	serveMux.Handle("/api/cdr/v1/replay", httpAuth.Admin(cdrService.ReplayCDRs))
+	serveMux.Handle("/api/cdr/v1/import", httpAuth.Admin(cdrService.ImportCDRs))
+	serveMux.Handle("/api/cdr/v1/dead-letters", httpAuth.Admin(cdrService.ListDeadLetters))
+	serveMux.Handle("/api/cdr/v1/dead-letters/retry", httpAuth.Admin(cdrService.RetryDeadLetters))
+	serveMux.Handle("/api/cdr/v1/dead-letter", httpAuth.Admin(cdrService.DeadLetterHandler))
+
+	// the webhook is authenticated using CDR_WEBHOOK_TOKEN.
+	if cfg.CDRWebhookToken != "" {
+		serveMux.HandleFunc("/api/cdr/v1/webhook", cdrService.CDRWebhook)
+	}
+
 	loggingHandler := func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			logrus.Infof("received request: %s %s%s", r.Method, r.Host, r.URL.String())
+			// query parameters are not logged as they may contain phone numbers.
+			logrus.Infof("received request: %s %s%s", r.Method, r.Host, r.URL.Path)
 
 			next.ServeHTTP(w, r)
 		})
@@ -139,26 +237,40 @@ func main() {
 	// Start notification worker for voicemails
 	worker.StartNotificationWorker(ctx, mng, providers)
 
-	// start the CDR server if CDR_MODE is not OFF
-	if strings.ToLower(cfg.CDRMode) != "off" {
-		p := cdr.NewProcessor(nil, providers.CallLogDB, providers, providers)
-
-		var srv cdr.Server
-		switch strings.ToLower(cfg.CDRMode) {
-		case "active":
-			srv = cdr.NewListeningServer(cfg.CDRAddr, p, slog.Default())
-		case "passive":
-			err = fmt.Errorf("3CX CDR in PASSIVE mode is not yet supported")
-		}
+	// Start background worker to retry call-data-records that failed due to
+	// temporary errors.
+	worker.StartDeadLetterRetryWorker(ctx, providers, cdrProcessor)
 
-		if srv != nil {
-			if err := srv.Start(ctx); err != nil {
-				logrus.Fatalf("failed to start CDR server: %s", err)
-			}
+	// Start notification worker for missed calls
+	worker.StartMissedCallNotificationWorker(ctx, providers)
+
+	// Start background worker to anonymize and delete old call-log records.
+	worker.StartRetentionWorker(ctx, providers)
+
+	// start the CDR server if CDR_MODE is not OFF
+	if cdrServer != nil {
+		if err := cdrServer.Start(ctx); err != nil {
+			logrus.Fatalf("failed to start CDR server: %s", err)
 		}
 	}
 
-	if err := server.Serve(ctx, srv); err != nil {
+	if err := server.Serve(ctx, srv); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		logrus.Fatalf("failed to serve: %s", err)
 	}
+
+	// stop reading from the CDR socket and process all rows that are still queued.
+	if cdrServer != nil {
+		cdrServer.Wait()
+	}
+
+	if cdrQueue != nil {
+		slog.Info("draining CDR queue", "depth", cdrQueue.Stats().Depth)
+
+		drainCtx, cancelDrain := context.WithTimeout(context.Background(), time.Minute)
+		defer cancelDrain()
+
+		if err := cdrQueue.Close(drainCtx); err != nil {
+			slog.Error("failed to drain CDR queue", "error", err, "depth", cdrQueue.Stats().Depth)
+		}
+	}
 }